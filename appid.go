@@ -0,0 +1,188 @@
+package u2fhost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// The AppID and facet rules are defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.0-id-20180227/fido-appid-and-facets-v2.0-id-20180227.html
+
+// The TrustedFacets version this client supports.
+const trustedFacetsMajorVersion = 1
+
+// The largest TrustedFacets list that will be read.
+const maxTrustedFacetsLength = 1 << 20
+
+// A TrustedFacetsFetcher returns the body of the TrustedFacets list at the HTTPS AppID URL.
+type TrustedFacetsFetcher func(appId string) ([]byte, error)
+
+// An AppIdValidator checks that a facet is allowed to use an AppID,
+// fetching the AppID's TrustedFacets list when the hosts differ.
+type AppIdValidator struct {
+	// Fetches the TrustedFacets list, if nil the list is fetched with HTTPFetcher(nil).
+	Fetcher TrustedFacetsFetcher
+}
+
+type trustedFacetsList struct {
+	TrustedFacets []trustedFacets `json:"trustedFacets"`
+}
+
+type trustedFacets struct {
+	Version struct {
+		Major int `json:"major"`
+		Minor int `json:"minor"`
+	} `json:"version"`
+	Ids []string `json:"ids"`
+}
+
+// Returns a TrustedFacetsFetcher that makes an anonymous GET request with the client,
+// or with a 10 second timeout if the client is nil.
+// Redirects are only followed if the response allows them with the
+// FIDO-AppID-Redirect-Authorized header.
+func HTTPFetcher(client *http.Client) TrustedFacetsFetcher {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	fetchClient := *client
+	fetchClient.Jar = nil
+	fetchClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("Too many redirects")
+		}
+		if req.Response.Header.Get("FIDO-AppID-Redirect-Authorized") != "true" {
+			return errors.New("Redirect is not authorized by FIDO-AppID-Redirect-Authorized")
+		}
+		return nil
+	}
+	return func(appId string) ([]byte, error) {
+		response, err := fetchClient.Get(appId)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Unexpected HTTP status %d", response.StatusCode)
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxTrustedFacetsLength+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > maxTrustedFacetsLength {
+			return nil, errors.New("TrustedFacets list is too large")
+		}
+		return body, nil
+	}
+}
+
+// Returns an InvalidAppIdError if the facet is not allowed to use the AppID.
+// An empty AppID is always valid, since the facet is used as the AppID.
+func (v *AppIdValidator) Validate(appId, facet string) error {
+	if appId == "" {
+		return nil
+	}
+	invalid := func(reason string, args ...interface{}) error {
+		return &InvalidAppIdError{AppId: appId, Facet: facet, Reason: fmt.Sprintf(reason, args...)}
+	}
+	appUrl, err := url.Parse(appId)
+	if err != nil || appUrl.Scheme != "https" || appUrl.Host == "" {
+		// AppIDs that are not https URLs must be the facet
+		if appId == facet {
+			return nil
+		}
+		return invalid("the AppID is not an https URL and does not match the facet")
+	}
+	facetUrl, err := url.Parse(facet)
+	if err == nil && isHttpsOrigin(facetUrl) && strings.EqualFold(facetUrl.Host, appUrl.Host) {
+		return nil
+	}
+
+	fetcher := v.Fetcher
+	if fetcher == nil {
+		fetcher = HTTPFetcher(nil)
+	}
+	body, err := fetcher(appId)
+	if err != nil {
+		return invalid("failed to fetch the TrustedFacets list: %s", err)
+	}
+	ids, err := trustedFacetIds(body, appUrl.Hostname())
+	if err != nil {
+		return invalid("%s", err)
+	}
+	for _, id := range ids {
+		if normalizeFacet(id) == normalizeFacet(facet) {
+			return nil
+		}
+	}
+	return invalid("the facet is not in the TrustedFacets list")
+}
+
+// Returns the facet ids from the TrustedFacets list for the highest supported version,
+// ignoring https facets that are not origins under the same eTLD+1 as the AppID host.
+func trustedFacetIds(body []byte, appHost string) ([]string, error) {
+	var list trustedFacetsList
+	err := json.Unmarshal(body, &list)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TrustedFacets list: %s", err)
+	}
+	var selected *trustedFacets
+	for i, facets := range list.TrustedFacets {
+		if facets.Version.Major != trustedFacetsMajorVersion {
+			continue
+		}
+		if selected == nil || facets.Version.Minor > selected.Version.Minor {
+			selected = &list.TrustedFacets[i]
+		}
+	}
+	if selected == nil {
+		return nil, errors.New("the TrustedFacets list has no supported version")
+	}
+	appSite, err := publicsuffix.EffectiveTLDPlusOne(appHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AppID host: %s", err)
+	}
+	ids := []string{}
+	for _, id := range selected.Ids {
+		idUrl, err := url.Parse(id)
+		if err != nil {
+			continue
+		}
+		if idUrl.Scheme == "https" {
+			site, err := publicsuffix.EffectiveTLDPlusOne(idUrl.Hostname())
+			if err != nil || !isHttpsOrigin(idUrl) || !strings.EqualFold(site, appSite) {
+				continue
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Returns true if the URL is an https origin, without a path, query or fragment.
+func isHttpsOrigin(u *url.URL) bool {
+	return u.Scheme == "https" && u.Host != "" && (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+func normalizeFacet(facet string) string {
+	if strings.HasPrefix(facet, "https://") {
+		return strings.ToLower(strings.TrimSuffix(facet, "/"))
+	}
+	return facet
+}
+
+// Validates the AppID if the validator is not nil.
+func validateAppId(validator *AppIdValidator, appId, facet string) error {
+	if validator == nil {
+		return nil
+	}
+	return validator.Validate(appId, facet)
+}
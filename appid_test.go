@@ -0,0 +1,178 @@
+package u2fhost
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testTrustedFacetsJson = `{
+	"trustedFacets": [{
+		"version": {"major": 1, "minor": 0},
+		"ids": [
+			"https://login.example.com",
+			"https://other.example.com/",
+			"https://path.example.com/login",
+			"https://example.org",
+			"android:apk-key-hash:2jmj7l5rSw0yVb/vlWAYkK/YBwk"
+		]
+	}, {
+		"version": {"major": 2, "minor": 0},
+		"ids": ["https://v2.example.com"]
+	}]
+}`
+
+func testFacetsFetcher(body string, fetches *int) TrustedFacetsFetcher {
+	return func(appId string) ([]byte, error) {
+		*fetches++
+		if appId != "https://example.com/appid.json" {
+			return nil, errors.New("not found")
+		}
+		return []byte(body), nil
+	}
+}
+
+func TestValidateAppId(t *testing.T) {
+	fetches := 0
+	validator := &AppIdValidator{Fetcher: testFacetsFetcher(testTrustedFacetsJson, &fetches)}
+	appId := "https://example.com/appid.json"
+	valid := []struct{ appId, facet string }{
+		{"", "https://example.com"},
+		{"http://example.com", "http://example.com"},
+		{"ios:bundle-id:com.example.app", "ios:bundle-id:com.example.app"},
+		{appId, "https://example.com"},
+		{appId, "https://login.example.com"},
+		{appId, "https://Other.example.com"},
+		{appId, "android:apk-key-hash:2jmj7l5rSw0yVb/vlWAYkK/YBwk"},
+	}
+	for _, test := range valid {
+		if err := validator.Validate(test.appId, test.facet); err != nil {
+			t.Errorf("Expected %s to be valid for %s, but got %s", test.facet, test.appId, err)
+		}
+	}
+	if fetches != 3 {
+		t.Errorf("Expected the TrustedFacets list to be fetched 3 times, but got %d", fetches)
+	}
+
+	invalid := []struct{ appId, facet string }{
+		{"http://example.com", "https://example.com"},
+		{appId, "https://evil.com"},
+		{appId, "http://login.example.com"},
+		// Facets that are not origins are ignored
+		{appId, "https://path.example.com"},
+		// Facets for a different eTLD+1 are ignored
+		{appId, "https://example.org"},
+		// Only the supported version is used
+		{appId, "https://v2.example.com"},
+		// The list could not be fetched
+		{"https://example.net/appid.json", "https://example.com"},
+	}
+	for _, test := range invalid {
+		err := validator.Validate(test.appId, test.facet)
+		if _, ok := err.(*InvalidAppIdError); !ok {
+			t.Errorf("Expected InvalidAppIdError for %s with %s, but got %#v", test.facet, test.appId, err)
+		}
+	}
+
+	validator.Fetcher = testFacetsFetcher(`{"trustedFacets": [{"version": {"major": 2}, "ids": []}]}`, &fetches)
+	if _, ok := validator.Validate(appId, "https://login.example.com").(*InvalidAppIdError); !ok {
+		t.Errorf("Expected InvalidAppIdError for a list without a supported version")
+	}
+	validator.Fetcher = testFacetsFetcher(`[]`, &fetches)
+	if _, ok := validator.Validate(appId, "https://login.example.com").(*InvalidAppIdError); !ok {
+		t.Errorf("Expected InvalidAppIdError for an invalid list")
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/appid.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "" || r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected an anonymous request")
+		}
+		w.Header().Set("Content-Type", "application/fido.trusted-apps+json")
+		w.Write([]byte(testTrustedFacetsJson))
+	})
+	mux.HandleFunc("/authorized", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("FIDO-AppID-Redirect-Authorized", "true")
+		http.Redirect(w, r, "/appid.json", http.StatusFound)
+	})
+	mux.HandleFunc("/unauthorized", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/appid.json", http.StatusFound)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	fetcher := HTTPFetcher(server.Client())
+
+	for _, path := range []string{"/appid.json", "/authorized"} {
+		body, err := fetcher(server.URL + path)
+		if err != nil || string(body) != testTrustedFacetsJson {
+			t.Errorf("Expected the TrustedFacets list from %s, but got %s %s", path, body, err)
+		}
+	}
+	for _, path := range []string{"/unauthorized", "/missing"} {
+		if _, err := fetcher(server.URL + path); err == nil {
+			t.Errorf("Expected error fetching %s", path)
+		}
+	}
+}
+
+func TestRegisterAppIdValidator(t *testing.T) {
+	testHid, dev := newTestDevice()
+	testHid.status = u2fStatusNoError
+	testHid.response = []byte{1, 2, 3, 4}
+	fetches := 0
+	req := sampleRegisterRequest()
+	req.AppId = "https://example.com/appid.json"
+	req.Facet = "https://evil.com"
+	req.AppIdValidator = &AppIdValidator{Fetcher: testFacetsFetcher(testTrustedFacetsJson, &fetches)}
+	_, err := dev.Register(req)
+	if _, ok := err.(*InvalidAppIdError); !ok {
+		t.Errorf("Expected InvalidAppIdError, but got %#v", err)
+	}
+	if testHid.request != nil {
+		t.Errorf("Expected the device not to be used")
+	}
+	req.Facet = "https://login.example.com"
+	if _, err = dev.Register(req); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestAuthenticateAppIdValidator(t *testing.T) {
+	testHid, dev := newTestDevice()
+	testHid.status = u2fStatusNoError
+	testHid.response = []byte{1, 0, 0, 0, 1, 5, 6}
+	fetches := 0
+	validator := &AppIdValidator{Fetcher: testFacetsFetcher(testTrustedFacetsJson, &fetches)}
+	req := sampleAuthenticateRequest()
+	req.AppId = "https://example.com/appid.json"
+	req.Facet = "https://evil.com"
+	req.AppIdValidator = validator
+	_, err := dev.Authenticate(req)
+	if _, ok := err.(*InvalidAppIdError); !ok {
+		t.Errorf("Expected InvalidAppIdError, but got %#v", err)
+	}
+	if testHid.request != nil {
+		t.Errorf("Expected the device not to be used")
+	}
+
+	// In WebAuthn mode the appid extension is validated
+	req = sampleAuthenticateRequest()
+	req.WebAuthn = true
+	req.Challenge = "AQID"
+	req.AppId = "evil.com"
+	req.Facet = "https://evil.com"
+	req.AppIdExtension = "https://example.com/appid.json"
+	req.AppIdValidator = validator
+	_, err = dev.Authenticate(req)
+	if _, ok := err.(*InvalidAppIdError); !ok {
+		t.Errorf("Expected InvalidAppIdError, but got %#v", err)
+	}
+	req.AppId = "example.com"
+	req.Facet = "https://login.example.com"
+	if _, err = dev.Authenticate(req); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
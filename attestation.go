@@ -0,0 +1,313 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	butil "github.com/marshallbrekka/go-u2fhost/bytes"
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The attestation statement formats are defined at the following url.
+// https://www.w3.org/TR/webauthn-3/#sctn-defined-attestation-formats
+
+// Attestation statement formats, in addition to attestationFormatFidoU2F.
+const (
+	attestationFormatPacked = "packed"
+	attestationFormatNone   = "none"
+)
+
+// Attestation types
+const (
+	// The attestation is signed by an attestation key shared by a batch of devices.
+	AttestationTypeBasic = "basic"
+	// The attestation is signed by the credential private key.
+	AttestationTypeSelf = "self"
+	// The authenticator did not provide an attestation.
+	AttestationTypeNone = "none"
+)
+
+// The subject organizational unit required in packed attestation certificates.
+const packedAttestationOrganizationalUnit = "Authenticator Attestation"
+
+// The id-fido-gen-ce-aaguid certificate extension, holding the authenticator AAGUID.
+var oidFidoGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// Signature algorithms for the COSE algorithms allowed in attestation statements.
+var coseSignatureAlgorithms = map[int64]x509.SignatureAlgorithm{
+	coseAlgES256: x509.ECDSAWithSHA256,
+	-35:          x509.ECDSAWithSHA384,
+	-36:          x509.ECDSAWithSHA512,
+	-8:           x509.PureEd25519,
+	-257:         x509.SHA256WithRSA,
+	-258:         x509.SHA384WithRSA,
+	-259:         x509.SHA512WithRSA,
+	-37:          x509.SHA256WithRSAPSS,
+}
+
+// The result of verifying an attestation statement.
+type AttestationResult struct {
+	// The attestation statement format, such as "packed" or "fido-u2f".
+	Format string
+	// AttestationTypeBasic, AttestationTypeSelf or AttestationTypeNone.
+	Type string
+	// The attestation certificates, leaf first, empty for self and none attestation.
+	TrustPath []*x509.Certificate
+	// The authenticator model, all zeros for U2F devices.
+	AAGUID            []byte
+	AuthenticatorData *AuthenticatorData
+}
+
+// Verifies the attestation statement of the credential over the authenticator data
+// and client data hash. If roots is not nil the attestation certificates must chain
+// to one of them, so self and none attestation are rejected, otherwise the trust
+// path is returned for the caller to evaluate.
+func VerifyAttestation(response *MakeCredentialResponse, clientDataHash []byte, roots *x509.CertPool) (*AttestationResult, error) {
+	authData := response.AuthenticatorData
+	if authData == nil {
+		parsed, err := ParseAuthenticatorData(response.AuthData)
+		if err != nil {
+			return nil, err
+		}
+		authData = parsed
+	}
+	if authData.CredentialPublicKey == nil {
+		return nil, &InvalidAttestationError{Format: response.Format, Reason: "the authenticator data has no attested credential"}
+	}
+	result := &AttestationResult{
+		Format:            response.Format,
+		AAGUID:            authData.AAGUID,
+		AuthenticatorData: authData,
+	}
+	signed := butil.Concat(response.AuthData, clientDataHash)
+	var err error
+	switch response.Format {
+	case attestationFormatPacked:
+		err = verifyPackedAttestation(result, response.AttestationStatement, signed)
+	case attestationFormatFidoU2F:
+		err = verifyFidoU2FAttestation(result, response.AttestationStatement, clientDataHash)
+	case attestationFormatNone:
+		if len(response.AttestationStatement) != 0 {
+			err = errors.New("the attestation statement is not empty")
+		}
+		result.Type = AttestationTypeNone
+	default:
+		err = errors.New("unsupported attestation format")
+	}
+	if err == nil && roots != nil {
+		if result.Type != AttestationTypeBasic {
+			err = fmt.Errorf("%s attestation can not be verified against the roots", result.Type)
+		} else {
+			err = verifyTrustPath(result.TrustPath, roots)
+		}
+	}
+	if err != nil {
+		return nil, &InvalidAttestationError{Format: response.Format, Reason: err.Error()}
+	}
+	return result, nil
+}
+
+// Verifies the attestation of a U2F RegisterResponse as fido-u2f attestation.
+func VerifyRegisterResponse(response *RegisterResponse, appId string, roots *x509.CertPool) (*AttestationResult, error) {
+	clientData, err := websafeDecode(response.ClientData)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid client data: %s", err)
+	}
+	credential, err := ParseRegisterResponse(response, appId)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyAttestation(credential, sha256(clientData), roots)
+}
+
+// Converts the registration data of a U2F RegisterResponse into a credential
+// with fido-u2f attestation for the appId, whose hash the attestation signs.
+func ParseRegisterResponse(response *RegisterResponse, appId string) (*MakeCredentialResponse, error) {
+	registrationData, err := websafeDecode(response.RegistrationData)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid registration data: %s", err)
+	}
+	return u2fMakeCredentialResponse(sha256([]byte(appId)), registrationData)
+}
+
+// Parses a WebAuthn attestation object, which holds the format, attestation
+// statement and authenticator data of a new credential.
+func ParseAttestationObject(data []byte) (*MakeCredentialResponse, error) {
+	object, err := cbor.UnmarshalMap(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid attestation object: %s", err)
+	}
+	format, _ := object.String("fmt")
+	statement, ok := object.Map("attStmt")
+	authData, ok2 := object.Bytes("authData")
+	if format == "" || !ok || !ok2 {
+		return nil, errors.New("Invalid attestation object: missing fmt, attStmt or authData")
+	}
+	parsed, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	return &MakeCredentialResponse{
+		Format:               format,
+		AuthData:             authData,
+		AuthenticatorData:    parsed,
+		AttestationStatement: statement,
+	}, nil
+}
+
+// https://www.w3.org/TR/webauthn-3/#sctn-packed-attestation
+func verifyPackedAttestation(result *AttestationResult, statement cbor.Map, signed []byte) error {
+	alg, ok := statement.Int("alg")
+	signature, ok2 := statement.Bytes("sig")
+	if !ok || !ok2 {
+		return errors.New("the attestation statement is missing alg or sig")
+	}
+	if _, ok := statement.Get("x5c"); !ok {
+		// Self attestation, signed by the credential key
+		coseKey, err := cbor.UnmarshalMap(result.AuthenticatorData.CredentialPublicKey)
+		if err != nil {
+			return err
+		}
+		keyAlg, _ := coseKey.Int(coseKeyAlg)
+		if keyAlg != alg || alg != coseAlgES256 {
+			return fmt.Errorf("unsupported self attestation algorithm %d", alg)
+		}
+		publicKey, err := ecdsaFromCOSEKey(coseKey)
+		if err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(publicKey, sha256(signed), signature) {
+			return errors.New("invalid self attestation signature")
+		}
+		result.Type = AttestationTypeSelf
+		return nil
+	}
+
+	certificates, err := attestationCertificates(statement)
+	if err != nil {
+		return err
+	}
+	algorithm, ok := coseSignatureAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported attestation algorithm %d", alg)
+	}
+	if err = certificates[0].CheckSignature(algorithm, signed, signature); err != nil {
+		return fmt.Errorf("invalid attestation signature: %s", err)
+	}
+	if err = checkPackedCertificate(certificates[0], result.AAGUID); err != nil {
+		return err
+	}
+	result.Type = AttestationTypeBasic
+	result.TrustPath = certificates
+	return nil
+}
+
+// Checks the requirements for packed attestation certificates.
+// https://www.w3.org/TR/webauthn-3/#sctn-packed-attestation-cert-requirements
+func checkPackedCertificate(certificate *x509.Certificate, aaguid []byte) error {
+	if certificate.Version != 3 {
+		return errors.New("the attestation certificate is not version 3")
+	}
+	subject := certificate.Subject
+	if len(subject.Country) == 0 || len(subject.Organization) == 0 || subject.CommonName == "" ||
+		len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != packedAttestationOrganizationalUnit {
+		return errors.New("the attestation certificate subject does not meet the packed requirements")
+	}
+	if certificate.BasicConstraintsValid && certificate.IsCA {
+		return errors.New("the attestation certificate is a CA certificate")
+	}
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidFidoGenCeAAGUID) {
+			continue
+		}
+		var value []byte
+		_, err := asn1.Unmarshal(extension.Value, &value)
+		if err != nil || extension.Critical || !bytes.Equal(value, aaguid) {
+			return errors.New("the attestation certificate AAGUID does not match the authenticator data")
+		}
+	}
+	return nil
+}
+
+// https://www.w3.org/TR/webauthn-3/#sctn-fido-u2f-attestation
+func verifyFidoU2FAttestation(result *AttestationResult, statement cbor.Map, clientDataHash []byte) error {
+	signature, ok := statement.Bytes("sig")
+	if !ok {
+		return errors.New("the attestation statement is missing sig")
+	}
+	certificates, err := attestationCertificates(statement)
+	if err != nil {
+		return err
+	}
+	if len(certificates) != 1 {
+		return errors.New("fido-u2f attestation must have exactly one certificate")
+	}
+	if key, ok := certificates[0].PublicKey.(*ecdsa.PublicKey); !ok || key.Curve != elliptic.P256() {
+		return errors.New("the attestation certificate key is not a P-256 key")
+	}
+	authData := result.AuthenticatorData
+	coseKey, err := cbor.UnmarshalMap(authData.CredentialPublicKey)
+	if err != nil {
+		return err
+	}
+	publicKey, err := ecdsaFromCOSEKey(coseKey)
+	if err != nil {
+		return err
+	}
+	signed := butil.Concat(
+		[]byte{0},
+		authData.RPIDHash,
+		clientDataHash,
+		authData.CredentialID,
+		elliptic.Marshal(elliptic.P256(), publicKey.X, publicKey.Y),
+	)
+	if err = certificates[0].CheckSignature(x509.ECDSAWithSHA256, signed, signature); err != nil {
+		return fmt.Errorf("invalid attestation signature: %s", err)
+	}
+	result.Type = AttestationTypeBasic
+	result.TrustPath = certificates
+	return nil
+}
+
+// Parses the x5c certificates of the attestation statement.
+func attestationCertificates(statement cbor.Map) ([]*x509.Certificate, error) {
+	x5c, _ := statement.Array("x5c")
+	if len(x5c) == 0 {
+		return nil, errors.New("the attestation statement has no certificates")
+	}
+	certificates := make([]*x509.Certificate, len(x5c))
+	for i, encoded := range x5c {
+		der, ok := encoded.([]byte)
+		if !ok {
+			return nil, errors.New("the attestation certificate is not a byte string")
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attestation certificate: %s", err)
+		}
+		certificates[i] = certificate
+	}
+	return certificates, nil
+}
+
+// Verifies the leaf certificate chains to the roots through the other certificates.
+func verifyTrustPath(certificates []*x509.Certificate, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("the attestation certificate is not trusted: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	butil "github.com/marshallbrekka/go-u2fhost/bytes"
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+var testAAGUID = []byte{0xcb, 0x69, 0x48, 0x1e, 0x8f, 0xf7, 0x40, 0x39, 0x93, 0xec, 0x0a, 0x27, 0x29, 0xa1, 0x54, 0xa8}
+
+// An attestation root and a packed attestation certificate issued by it.
+type testAttestationCA struct {
+	root        *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certificate []byte
+}
+
+func newTestAttestationCA(t *testing.T, aaguid []byte) *testAttestationCA {
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Attestation Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDer, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create root certificate: %s", err)
+	}
+	root, _ := x509.ParseCertificate(rootDer)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	aaguidExtension, _ := asn1.Marshal(aaguid)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"Test Vendor"},
+			OrganizationalUnit: []string{packedAttestationOrganizationalUnit},
+			CommonName:         "Test Attestation",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: oidFidoGenCeAAGUID, Value: aaguidExtension}},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create attestation certificate: %s", err)
+	}
+	return &testAttestationCA{root: root, key: key, certificate: certificate}
+}
+
+func (ca *testAttestationCA) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.root)
+	return roots
+}
+
+// Returns authenticator data for a new credential with the key.
+func testAttestedAuthData(aaguid []byte, key *ecdsa.PrivateKey) []byte {
+	publicKey, _ := cbor.Marshal(coseKeyFromECDSA(&key.PublicKey, coseAlgES256))
+	credentialID := []byte("credential id")
+	return butil.Concat(
+		sha256([]byte("example.com")),
+		[]byte{authDataFlagUserPresent | authDataFlagAttestedCredentialData},
+		[]byte{0, 0, 0, 1},
+		aaguid,
+		[]byte{0, byte(len(credentialID))},
+		credentialID,
+		publicKey,
+	)
+}
+
+func TestVerifyPackedAttestation(t *testing.T) {
+	ca := newTestAttestationCA(t, testAAGUID)
+	credentialKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientDataHash := sha256([]byte("client data"))
+	authData := testAttestedAuthData(testAAGUID, credentialKey)
+	signature, _ := ecdsa.SignASN1(rand.Reader, ca.key, sha256(butil.Concat(authData, clientDataHash)))
+	response := &MakeCredentialResponse{
+		Format:   attestationFormatPacked,
+		AuthData: authData,
+		AttestationStatement: cbor.Map{
+			"alg": coseAlgES256,
+			"sig": signature,
+			"x5c": []interface{}{ca.certificate},
+		},
+	}
+	result, err := VerifyAttestation(response, clientDataHash, ca.roots())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result.Type != AttestationTypeBasic || len(result.TrustPath) != 1 || string(result.AAGUID) != string(testAAGUID) {
+		t.Errorf("Unexpected result %#v", result)
+	}
+
+	// Untrusted roots, or the trust path is left to the caller
+	if _, err = VerifyAttestation(response, clientDataHash, x509.NewCertPool()); err == nil {
+		t.Errorf("Expected error for an untrusted attestation certificate")
+	}
+	if _, err = VerifyAttestation(response, clientDataHash, nil); err != nil {
+		t.Errorf("Unexpected error without roots: %s", err)
+	}
+
+	// Wrong client data
+	_, err = VerifyAttestation(response, sha256([]byte("other")), ca.roots())
+	if _, ok := err.(*InvalidAttestationError); !ok {
+		t.Errorf("Expected InvalidAttestationError, but got %#v", err)
+	}
+
+	// AAGUID that does not match the certificate
+	other := make([]byte, 16)
+	response.AuthData = testAttestedAuthData(other, credentialKey)
+	signature, _ = ecdsa.SignASN1(rand.Reader, ca.key, sha256(butil.Concat(response.AuthData, clientDataHash)))
+	response.AttestationStatement["sig"] = signature
+	if _, err = VerifyAttestation(response, clientDataHash, ca.roots()); err == nil {
+		t.Errorf("Expected error for a mismatched AAGUID")
+	}
+
+	// Self attestation
+	signature, _ = ecdsa.SignASN1(rand.Reader, credentialKey, sha256(butil.Concat(authData, clientDataHash)))
+	response = &MakeCredentialResponse{
+		Format:               attestationFormatPacked,
+		AuthData:             authData,
+		AttestationStatement: cbor.Map{"alg": coseAlgES256, "sig": signature},
+	}
+	result, err = VerifyAttestation(response, clientDataHash, nil)
+	if err != nil || result.Type != AttestationTypeSelf || len(result.TrustPath) != 0 {
+		t.Errorf("Expected self attestation, but got %#v %s", result, err)
+	}
+	if _, err = VerifyAttestation(response, clientDataHash, ca.roots()); err == nil {
+		t.Errorf("Expected error for self attestation with roots")
+	}
+	response.AttestationStatement["alg"] = -257
+	if _, err = VerifyAttestation(response, clientDataHash, nil); err == nil {
+		t.Errorf("Expected error for an algorithm that does not match the credential")
+	}
+}
+
+func TestVerifyNoneAttestation(t *testing.T) {
+	_, _, dev := newTestAuthenticator(t)
+	req := sampleMakeCredentialRequest()
+	response, err := dev.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	result, err := VerifyAttestation(response, req.ClientDataHash, nil)
+	if err != nil || result.Type != AttestationTypeNone || result.Format != attestationFormatNone {
+		t.Errorf("Expected none attestation, but got %#v %s", result, err)
+	}
+	if _, err = VerifyAttestation(response, req.ClientDataHash, x509.NewCertPool()); err == nil {
+		t.Errorf("Expected error for none attestation with roots")
+	}
+	response.AttestationStatement = cbor.Map{"sig": []byte{1}}
+	if _, err = VerifyAttestation(response, req.ClientDataHash, nil); err == nil {
+		t.Errorf("Expected error for a none attestation with a statement")
+	}
+	response.Format = "tpm"
+	if _, err = VerifyAttestation(response, req.ClientDataHash, nil); err == nil {
+		t.Errorf("Expected error for an unsupported format")
+	}
+}
+
+func TestVerifyFidoU2FAttestation(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	certificate, _ := x509.ParseCertificate(token.certificate)
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+
+	req := sampleMakeCredentialRequest()
+	response, err := authenticator.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	result, err := VerifyAttestation(response, req.ClientDataHash, roots)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result.Type != AttestationTypeBasic || len(result.TrustPath) != 1 || string(result.AAGUID) != string(make([]byte, 16)) {
+		t.Errorf("Unexpected result %#v", result)
+	}
+	if _, err = VerifyAttestation(response, sha256([]byte("other")), roots); err == nil {
+		t.Errorf("Expected error for the wrong client data hash")
+	}
+
+	// The attestation through the webauthn attestation object
+	credential, _ := NewRegistrationCredential([]byte("{}"), &PublicKeyCredentialCreationOptions{}, response)
+	parsed, err := ParseAttestationObject(credential.Response.AttestationObject)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err = VerifyAttestation(parsed, req.ClientDataHash, roots); err != nil {
+		t.Errorf("Unexpected error verifying the attestation object: %s", err)
+	}
+
+	// The output of Register
+	dev := authenticator.(*u2fAuthenticator).dev
+	registerRequest := sampleRegisterRequest()
+	registerResponse, err := dev.Register(registerRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err = VerifyRegisterResponse(registerResponse, registerRequest.AppId, roots); err != nil {
+		t.Errorf("Unexpected error verifying the register response: %s", err)
+	}
+	if _, err = VerifyRegisterResponse(registerResponse, "https://other.example.com", roots); err == nil {
+		t.Errorf("Expected error for a different AppID")
+	}
+	registration, err := ParseRegisterResponse(registerResponse, registerRequest.AppId)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if registration.Format != attestationFormatFidoU2F || !bytes.Equal(registration.AuthenticatorData.RPIDHash, sha256([]byte(registerRequest.AppId))) {
+		t.Errorf("Expected fido-u2f attestation for the AppID, but got %#v", registration)
+	}
+	if _, err = ParseRegisterResponse(&RegisterResponse{RegistrationData: "BQ"}, registerRequest.AppId); err == nil {
+		t.Errorf("Expected error for truncated registration data")
+	}
+}
@@ -0,0 +1,91 @@
+package u2fhost
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// Authenticator data flags
+const (
+	authDataFlagUserPresent             uint8 = 0x01
+	authDataFlagUserVerified            uint8 = 0x04
+	authDataFlagAttestedCredentialData  uint8 = 0x40
+	authDataFlagExtensionDataIncluded   uint8 = 0x80
+	authDataMinLength                         = 37
+	authDataAttestedCredentialMinLength       = 18
+)
+
+// AuthenticatorData is the parsed form of the authenticator data returned by
+// CTAP2 makeCredential and getAssertion requests.
+// For more information see https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+type AuthenticatorData struct {
+	// SHA-256 hash of the RP ID (or AppId) the credential is scoped to.
+	RPIDHash  []byte
+	Flags     uint8
+	SignCount uint32
+
+	// Attested credential data, only present when creating a credential.
+	AAGUID       []byte
+	CredentialID []byte
+	// The COSE_Key encoded credential public key.
+	CredentialPublicKey []byte
+
+	// Extension outputs, keyed by the extension identifier.
+	Extensions cbor.Map
+}
+
+// Parses the raw authenticator data.
+func ParseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < authDataMinLength {
+		return nil, errors.New("Authenticator data is too short")
+	}
+	authData := &AuthenticatorData{
+		RPIDHash:  data[0:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[authDataMinLength:]
+	if authData.Flags&authDataFlagAttestedCredentialData != 0 {
+		if len(rest) < authDataAttestedCredentialMinLength {
+			return nil, errors.New("Attested credential data is too short")
+		}
+		authData.AAGUID = rest[0:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[authDataAttestedCredentialMinLength:]
+		if len(rest) < idLength {
+			return nil, errors.New("Credential ID is longer than the attested credential data")
+		}
+		authData.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+		_, remaining, err := cbor.UnmarshalFirst(rest)
+		if err != nil {
+			return nil, err
+		}
+		authData.CredentialPublicKey = rest[:len(rest)-len(remaining)]
+		rest = remaining
+	}
+	if authData.Flags&authDataFlagExtensionDataIncluded != 0 {
+		extensions, err := cbor.UnmarshalMap(rest)
+		if err != nil {
+			return nil, err
+		}
+		authData.Extensions = extensions
+		rest = nil
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("Unexpected trailing bytes in authenticator data")
+	}
+	return authData, nil
+}
+
+// Returns true if the user presence flag is set.
+func (a *AuthenticatorData) UserPresent() bool {
+	return a.Flags&authDataFlagUserPresent != 0
+}
+
+// Returns true if the user verified flag is set.
+func (a *AuthenticatorData) UserVerified() bool {
+	return a.Flags&authDataFlagUserVerified != 0
+}
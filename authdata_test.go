@@ -0,0 +1,60 @@
+package u2fhost
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAuthenticatorData(t *testing.T) {
+	authenticator, _, _ := newTestAuthenticator(t)
+
+	// Assertion authenticator data
+	data := authenticator.authData("example.com", authDataFlagUserPresent|authDataFlagUserVerified, nil, nil)
+	authData, err := ParseAuthenticatorData(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(authData.RPIDHash, sha256([]byte("example.com"))) {
+		t.Errorf("Unexpected RP ID hash %x", authData.RPIDHash)
+	}
+	if !authData.UserPresent() || !authData.UserVerified() {
+		t.Errorf("Expected user present and verified flags, but got %#x", authData.Flags)
+	}
+	if authData.SignCount != 1 {
+		t.Errorf("Expected sign count 1, but got %d", authData.SignCount)
+	}
+	if authData.CredentialID != nil || authData.Extensions != nil {
+		t.Errorf("Expected no attested credential data or extensions, but got %#v", authData)
+	}
+
+	// Attested credential data and extensions
+	response := authenticator.makeCredential(sampleMakeCredentialParams(true))
+	data, _ = response.Bytes(makeCredentialResponseAuthData)
+	authData, err = ParseAuthenticatorData(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(authData.CredentialID, authenticator.credentialID) {
+		t.Errorf("Expected credential id %x, but got %x", authenticator.credentialID, authData.CredentialID)
+	}
+	if len(authData.AAGUID) != 16 || len(authData.CredentialPublicKey) == 0 {
+		t.Errorf("Expected AAGUID and credential public key, but got %#v", authData)
+	}
+	if hmacSecret, _ := authData.Extensions.Bool(extensionHmacSecret); !hmacSecret {
+		t.Errorf("Expected hmac-secret extension output, but got %#v", authData.Extensions)
+	}
+
+	// Malformed data
+	_, err = ParseAuthenticatorData(data[:20])
+	if err == nil {
+		t.Errorf("Expected error for short authenticator data")
+	}
+	_, err = ParseAuthenticatorData(data[:60])
+	if err == nil {
+		t.Errorf("Expected error for truncated attested credential data")
+	}
+	_, err = ParseAuthenticatorData(append(authenticator.authData("example.com", 0, nil, nil), 0))
+	if err == nil {
+		t.Errorf("Expected error for trailing bytes")
+	}
+}
@@ -11,6 +11,10 @@ import (
 // Authenticates with the device using the AuthenticateRequest,
 // returning an AuthenticateResponse.
 func (dev *HidDevice) Authenticate(req *AuthenticateRequest) (*AuthenticateResponse, error) {
+	err := validateAuthenticateRequest(req)
+	if err != nil {
+		return nil, err
+	}
 	clientData, request, err := authenticateRequest(req)
 	if err != nil {
 		return nil, err
@@ -26,42 +30,47 @@ func (dev *HidDevice) Authenticate(req *AuthenticateRequest) (*AuthenticateRespo
 		return nil, err
 	}
 
-	if status == u2fStatusNoError {
-		response := authenticateResponse(status, response, clientData, req)
-
-		// Clear out the authenticator data if the original request was not webauthn.
-		if !req.WebAuthn {
-			response.AuthenticatorData = ""
-		}
-		return response, nil
-	}
-
-	// If we are in webauthn mode, try a backwards compatible mode for u2f
-	if req.WebAuthn && status == u2fStatusWrongData {
-		u2fReq := *req
-		u2fReq.WebAuthn = false
-		u2fReq.AppId = "https://" + req.AppId
-		clientData, request, err = authenticateRequest(&u2fReq)
-
-		if err != nil {
-			return nil, err
-		}
-
+	// If we are in webauthn mode, try the U2F AppID from the appid extension
+	appId := req.AppId
+	if req.WebAuthn && status == u2fStatusWrongData && req.AppIdExtension != "" {
+		appId = req.AppIdExtension
+		copy(request[32:64], sha256([]byte(appId)))
 		status, response, err = dev.hidDevice.SendAPDU(u2fCommandAuthenticate, authModifier, 0, request)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		if status == u2fStatusNoError {
-			return authenticateResponse(status, response, clientData, &u2fReq), nil
-		}
+	if status != u2fStatusNoError {
+		return nil, u2ferror(status)
+	}
+	authResponse := authenticateResponse(status, response, clientData, req, appId)
+	authResponse.AppIdExtensionUsed = appId != req.AppId
+
+	// Clear out the authenticator data if the original request was not webauthn.
+	if !req.WebAuthn {
+		authResponse.AuthenticatorData = ""
 	}
+	return authResponse, nil
+}
 
-	return nil, u2ferror(status)
+// Validates the AppId, or in WebAuthn mode the RP ID and the AppIdExtension.
+func validateAuthenticateRequest(req *AuthenticateRequest) error {
+	if !req.WebAuthn {
+		return validateAppId(req.AppIdValidator, req.AppId, req.Facet)
+	}
+	err := ValidateRPID(req.AppId, req.Facet, req.PublicSuffixList)
+	if err != nil {
+		return err
+	}
+	if req.AppIdExtension != "" {
+		return validateAppId(req.AppIdValidator, req.AppIdExtension, req.Facet)
+	}
+	return nil
 }
 
-func authenticateResponse(status uint16, response, clientData []byte, req *AuthenticateRequest) *AuthenticateResponse {
-	authenticatorData := append(sha256([]byte(req.AppId)), response[0:5]...)
+func authenticateResponse(status uint16, response, clientData []byte, req *AuthenticateRequest, appId string) *AuthenticateResponse {
+	authenticatorData := append(sha256([]byte(appId)), response[0:5]...)
 	if req.WebAuthn {
 		return &AuthenticateResponse{
 			KeyHandle:         req.KeyHandle,
@@ -92,21 +101,31 @@ func authenticateRequest(req *AuthenticateRequest) ([]byte, []byte, error) {
 		return []byte{}, []byte{}, fmt.Errorf("base64 key handle: %s", err)
 	}
 
-	client := clientData{
-		Challenge:          req.Challenge,
-		Origin:             req.Facet,
-		ChannelIdPublicKey: cid,
-	}
-
+	var clientJson []byte
 	if req.WebAuthn {
-		client.Type = "webauthn.get"
+		challenge, err := decodeBase64URL(req.Challenge)
+		if err != nil {
+			return nil, nil, fmt.Errorf("WebAuthn challenge must be base64url encoded: %s", err)
+		}
+		client := CollectedClientData{
+			Type:        ClientDataTypeGet,
+			Challenge:   challenge,
+			Origin:      req.Facet,
+			CrossOrigin: req.TopOrigin != "",
+			TopOrigin:   req.TopOrigin,
+		}
+		clientJson = client.JSON()
 	} else {
-		client.Typ = "navigator.id.getAssertion"
-	}
-
-	clientJson, err := json.Marshal(client)
-	if err != nil {
-		return nil, nil, fmt.Errorf("Error marshaling clientData to json: %s", err)
+		client := clientData{
+			Typ:                ClientDataTypeAuthenticate,
+			Challenge:          req.Challenge,
+			Origin:             req.Facet,
+			ChannelIdPublicKey: cid,
+		}
+		clientJson, err = json.Marshal(client)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error marshaling clientData to json: %s", err)
+		}
 	}
 
 	// Pack into byte array
@@ -1,6 +1,7 @@
 package u2fhost
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"testing"
 )
@@ -67,6 +68,54 @@ func TestAuthenticate(t *testing.T) {
 	}
 }
 
+func TestAuthenticateWebAuthn(t *testing.T) {
+	testHid, dev := newTestDevice()
+	appIdHash := sha256([]byte("https://example.com/appid.json"))
+	testHid.apduHandler = func(instruction, p1, p2 uint8, request []byte) (uint16, []byte) {
+		if string(request[32:64]) != string(appIdHash) {
+			return u2fStatusWrongData, nil
+		}
+		return u2fStatusNoError, []byte{1, 0, 0, 0, 2, 3, 4}
+	}
+	authRequest := sampleAuthenticateRequest()
+	authRequest.WebAuthn = true
+	authRequest.AppId = "example.com"
+	authRequest.Facet = "https://example.com"
+
+	// The key handle is not registered for the RP ID
+	_, err := dev.Authenticate(authRequest)
+	if err == nil {
+		t.Errorf("Expected error for an unknown key handle")
+	}
+
+	// The appid extension is tried
+	authRequest.AppIdExtension = "https://example.com/appid.json"
+	response, err := dev.Authenticate(authRequest)
+	if err != nil {
+		t.Fatalf("Unexpected error calling Authenticate: %s", err)
+	}
+	if !response.AppIdExtensionUsed {
+		t.Errorf("Expected the appid extension to be used")
+	}
+	expectedClientData := `{"type":"webauthn.get","challenge":"opsXqUifDriAAmWclinfbS0e-USY0CgyJHe_Otd7z8o","origin":"https://example.com","crossOrigin":false}`
+	if response.ClientData != websafeEncode([]byte(expectedClientData)) {
+		t.Errorf("Expected client data %s, but got %s", expectedClientData, response.ClientData)
+	}
+	expectedAuthenticatorData := base64.StdEncoding.EncodeToString(append(appIdHash, 1, 0, 0, 0, 2))
+	if response.AuthenticatorData != expectedAuthenticatorData {
+		t.Errorf("Expected authenticator data with the AppID hash, but got %s", response.AuthenticatorData)
+	}
+	if string(testHid.request[:32]) != string(sha256([]byte(expectedClientData))) {
+		t.Errorf("Expected the client data hash to be signed")
+	}
+
+	// The challenge must be base64url
+	authRequest.Challenge = "not base64!"
+	if _, err = dev.Authenticate(authRequest); err == nil {
+		t.Errorf("Expected error for a non base64url challenge")
+	}
+}
+
 // Sample values are taken from the U2F spec examples
 // https://fidoalliance.org/specs/fido-u2f-v1.1-id-20160915/fido-u2f-raw-message-formats-v1.1-id-20160915.html#authentication-example
 var testAuthenticateClientDataJson = "{\"typ\":\"navigator.id.getAssertion\",\"challenge\":\"opsXqUifDriAAmWclinfbS0e-USY0CgyJHe_Otd7z8o\",\"cid_pubkey\":{\"kty\":\"EC\",\"crv\":\"P-256\",\"x\":\"HzQwlfXX7Q4S5MtCCnZUNBw3RMzPO9tOyWjBqRl4tJ8\",\"y\":\"XVguGFLIZx1fXg3wNqfdbn75hi4-_7-BxhMljw42Ht4\"},\"origin\":\"http://example.com\"}"
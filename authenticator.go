@@ -0,0 +1,263 @@
+package u2fhost
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	butil "github.com/marshallbrekka/go-u2fhost/bytes"
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
+
+// An Authenticator creates and signs with WebAuthn credentials, regardless of
+// whether the device speaks CTAP2 or only U2F.
+type Authenticator interface {
+	// Creates a new credential, the response has the same form for both protocols.
+	MakeCredential(*MakeCredentialRequest) (*MakeCredentialResponse, error)
+	// Signs with one of the credentials in the allow list, or a resident credential.
+	GetAssertion(*GetAssertionRequest) (*GetAssertionResponse, error)
+}
+
+// The attestation statement format of credentials created with U2F.
+const attestationFormatFidoU2F = "fido-u2f"
+
+// How often U2F devices are polled while waiting for the user to touch them,
+// and how long to wait before giving up.
+const (
+	u2fPollInterval        = 250 * time.Millisecond
+	u2fUserPresenceTimeout = 30 * time.Second
+)
+
+// Returns an Authenticator for the open device, using CTAP2 if the device
+// advertised CBOR support when it was opened and U2F otherwise.
+func NewAuthenticator(dev *HidDevice) Authenticator {
+	return NewAuthenticatorWithTimeout(dev, u2fUserPresenceTimeout)
+}
+
+// Returns an Authenticator like NewAuthenticator, but U2F requests wait up to the
+// timeout for the user to touch the device. CTAP2 requests wait for the device's
+// own timeout, and are stopped early with Cancel.
+func NewAuthenticatorWithTimeout(dev *HidDevice, timeout time.Duration) Authenticator {
+	if dev.SupportsCTAP2() {
+		return dev
+	}
+	return &u2fAuthenticator{
+		dev:          dev,
+		pollInterval: u2fPollInterval,
+		timeout:      timeout,
+	}
+}
+
+// Returns true if the open device supports CTAP2 commands.
+func (dev *HidDevice) SupportsCTAP2() bool {
+	return dev.Capabilities()&hid.CAPABILITY_CBOR != 0
+}
+
+// Translates WebAuthn requests into U2F messages for devices without CTAP2 support.
+type u2fAuthenticator struct {
+	dev          *HidDevice
+	pollInterval time.Duration
+	timeout      time.Duration
+}
+
+// Registers with the device and returns the result as a credential with
+// fido-u2f attestation.
+// Credentials in the exclude list are checked first, returning a
+// CredentialExcludedError if the device recognizes any of them.
+func (a *u2fAuthenticator) MakeCredential(req *MakeCredentialRequest) (*MakeCredentialResponse, error) {
+	if _, err := makeCredentialRequest(req); err != nil {
+		return nil, err
+	}
+	if req.ResidentKey {
+		return nil, errors.New("U2F devices do not support resident credentials")
+	}
+	if req.UserVerification || req.PinUvAuthToken != nil {
+		return nil, errors.New("U2F devices do not support user verification")
+	}
+	if len(req.Algorithms) > 0 && !containsInt(req.Algorithms, coseAlgES256) {
+		return nil, errors.New("U2F devices only support ES256 credentials")
+	}
+	if extensions, _ := req.Extensions.encode(); extensions != nil {
+		return nil, errors.New("U2F devices do not support CTAP2 extensions")
+	}
+	rpIDHash := sha256([]byte(req.RelyingParty.ID))
+	for _, credentialID := range req.ExcludeList {
+		found, err := a.checkCredential(rpIDHash, credentialID)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return nil, &CredentialExcludedError{}
+		}
+	}
+	response, err := a.poll(u2fCommandRegister, u2fAuthEnforce, butil.Concat(req.ClientDataHash, rpIDHash))
+	if err != nil {
+		return nil, err
+	}
+	return u2fMakeCredentialResponse(rpIDHash, response)
+}
+
+// Signs with the first credential in the allow list the device recognizes,
+// trying the AppID extension if none are found for the RP ID.
+func (a *u2fAuthenticator) GetAssertion(req *GetAssertionRequest) (*GetAssertionResponse, error) {
+	if _, err := getAssertionRequest(req, nil); err != nil {
+		return nil, err
+	}
+	if len(req.AllowList) == 0 {
+		return nil, errors.New("U2F devices require an allow list")
+	}
+	if req.UserVerification || req.PinUvAuthToken != nil {
+		return nil, errors.New("U2F devices do not support user verification")
+	}
+	// Only the AppID extension is handled by the client rather than the device
+	if req.Extensions.HmacSecret != nil || req.Extensions.CredBlob || req.Extensions.LargeBlobKey {
+		return nil, errors.New("U2F devices do not support CTAP2 extensions")
+	}
+	rpIDs := []string{req.RPID}
+	if req.Extensions.AppID != "" {
+		rpIDs = append(rpIDs, req.Extensions.AppID)
+	}
+	for i, rpID := range rpIDs {
+		rpIDHash := sha256([]byte(rpID))
+		for _, credentialID := range req.AllowList {
+			found, err := a.checkCredential(rpIDHash, credentialID)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+			request := butil.Concat(req.ClientDataHash, rpIDHash, []byte{byte(len(credentialID))}, credentialID)
+			response, err := a.poll(u2fCommandAuthenticate, u2fAuthEnforce, request)
+			if err != nil {
+				return nil, err
+			}
+			assertion, err := u2fGetAssertionResponse(rpIDHash, credentialID, response)
+			if err != nil {
+				return nil, err
+			}
+			assertion.Extensions.AppID = i > 0
+			return assertion, nil
+		}
+	}
+	return nil, &NoCredentialsError{}
+}
+
+// Returns true if the device recognizes the credential for the RP ID hash.
+func (a *u2fAuthenticator) checkCredential(rpIDHash, credentialID []byte) (bool, error) {
+	if len(credentialID) > 255 {
+		return false, nil
+	}
+	request := butil.Concat(make([]byte, 32), rpIDHash, []byte{byte(len(credentialID))}, credentialID)
+	status, _, err := a.dev.hidDevice.SendAPDU(u2fCommandAuthenticate, u2fAuthCheckOnly, 0, request)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case u2fStatusConditionsNotSatisfied:
+		return true, nil
+	case u2fStatusWrongData:
+		return false, nil
+	}
+	return false, u2ferror(status)
+}
+
+// Repeats the APDU until the user touches the device, or the timeout passes,
+// reporting each wait to the keep alive handler like a CTAP2 device would.
+func (a *u2fAuthenticator) poll(instruction, p1 uint8, request []byte) ([]byte, error) {
+	deadline := time.Now().Add(a.timeout)
+	for {
+		status, response, err := a.dev.hidDevice.SendAPDU(instruction, p1, 0, request)
+		if err != nil {
+			return nil, err
+		}
+		if status == u2fStatusNoError {
+			return response, nil
+		}
+		if status != u2fStatusConditionsNotSatisfied {
+			return nil, u2ferror(status)
+		}
+		if a.dev.keepAlive != nil {
+			a.dev.keepAlive(KeepAliveUserPresenceNeeded)
+		}
+		if time.Now().After(deadline) {
+			return nil, &UserActionTimeoutError{}
+		}
+		time.Sleep(a.pollInterval)
+	}
+}
+
+// Converts the U2F registration response into a credential with fido-u2f attestation.
+// The response is 0x05, the public key, the key handle length and key handle,
+// the attestation certificate and the signature.
+// https://fidoalliance.org/specs/fido-u2f-v1.2-ps-20170411/fido-u2f-raw-message-formats-v1.2-ps-20170411.html#registration-response-message-success
+func u2fMakeCredentialResponse(rpIDHash, response []byte) (*MakeCredentialResponse, error) {
+	if len(response) < 67 || response[0] != 0x05 {
+		return nil, errors.New("Invalid U2F registration response")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), response[1:66])
+	if x == nil {
+		return nil, errors.New("Invalid U2F public key")
+	}
+	keyHandleLength := int(response[66])
+	if len(response) < 67+keyHandleLength {
+		return nil, errors.New("Invalid U2F registration response")
+	}
+	keyHandle := response[67 : 67+keyHandleLength]
+	var certificate asn1.RawValue
+	signature, err := asn1.Unmarshal(response[67+keyHandleLength:], &certificate)
+	if err != nil {
+		return nil, errors.New("Invalid U2F attestation certificate")
+	}
+	publicKey, err := MarshalCOSEKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+	if err != nil {
+		return nil, err
+	}
+	credentialIDLength := make([]byte, 2)
+	binary.BigEndian.PutUint16(credentialIDLength, uint16(keyHandleLength))
+	authData := butil.Concat(
+		rpIDHash,
+		[]byte{authDataFlagUserPresent | authDataFlagAttestedCredentialData},
+		make([]byte, 4),
+		make([]byte, 16),
+		credentialIDLength,
+		keyHandle,
+		publicKey,
+	)
+	parsed, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	return &MakeCredentialResponse{
+		Format:            attestationFormatFidoU2F,
+		AuthData:          authData,
+		AuthenticatorData: parsed,
+		AttestationStatement: cbor.Map{
+			"sig": signature,
+			"x5c": []interface{}{certificate.FullBytes},
+		},
+	}, nil
+}
+
+// Converts the U2F authentication response, which is the user presence byte,
+// the counter and the signature, into an assertion.
+func u2fGetAssertionResponse(rpIDHash, credentialID, response []byte) (*GetAssertionResponse, error) {
+	if len(response) < 5 {
+		return nil, errors.New("Invalid U2F authentication response")
+	}
+	authData := butil.Concat(rpIDHash, response[:5])
+	parsed, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	return &GetAssertionResponse{
+		CredentialID:      credentialID,
+		AuthData:          authData,
+		AuthenticatorData: parsed,
+		Signature:         response[5:],
+	}, nil
+}
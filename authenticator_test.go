@@ -0,0 +1,261 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	butil "github.com/marshallbrekka/go-u2fhost/bytes"
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
+
+// Emulates a U2F only token, which remembers the key handles it registered
+// and requires a number of polls before it is touched.
+type testU2FToken struct {
+	t           *testing.T
+	key         *ecdsa.PrivateKey
+	certificate []byte
+	keyHandles  map[string][]byte
+	// The number of requests to reject before the user touches the device
+	touchAfter int
+	polls      int
+}
+
+func newTestU2FAuthenticator(t *testing.T) (*testU2FToken, *testDevice, Authenticator) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "U2F Test Attestation"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	token := &testU2FToken{t: t, key: key, certificate: certificate, keyHandles: map[string][]byte{}}
+	testHid, dev := newTestDevice()
+	testHid.apduHandler = token.handle
+	authenticator := NewAuthenticator(dev)
+	authenticator.(*u2fAuthenticator).pollInterval = time.Millisecond
+	return token, testHid, authenticator
+}
+
+func (u *testU2FToken) touched() bool {
+	u.polls++
+	return u.polls > u.touchAfter
+}
+
+func (u *testU2FToken) handle(instruction, p1, p2 uint8, request []byte) (uint16, []byte) {
+	switch instruction {
+	case u2fCommandRegister:
+		if !u.touched() {
+			return u2fStatusConditionsNotSatisfied, nil
+		}
+		keyHandle := []byte("key handle")
+		u.keyHandles[string(keyHandle)] = request[32:64]
+		publicKey := elliptic.Marshal(elliptic.P256(), u.key.X, u.key.Y)
+		signature, _ := ecdsa.SignASN1(rand.Reader, u.key, sha256(butil.Concat([]byte{0}, request[32:64], request[:32], keyHandle, publicKey)))
+		return u2fStatusNoError, butil.Concat([]byte{0x05}, publicKey, []byte{byte(len(keyHandle))}, keyHandle, u.certificate, signature)
+	case u2fCommandAuthenticate:
+		keyHandle := request[65 : 65+int(request[64])]
+		if appIDHash, ok := u.keyHandles[string(keyHandle)]; !ok || !bytes.Equal(appIDHash, request[32:64]) {
+			return u2fStatusWrongData, nil
+		}
+		if p1 == u2fAuthCheckOnly || !u.touched() {
+			return u2fStatusConditionsNotSatisfied, nil
+		}
+		counter := []byte{0x01, 0, 0, 0, 0x2a}
+		signature, _ := ecdsa.SignASN1(rand.Reader, u.key, sha256(butil.Concat(request[32:64], counter, request[:32])))
+		return u2fStatusNoError, butil.Concat(counter, signature)
+	}
+	return u2fStatusInsNotSupported, nil
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	testHid, dev := newTestDevice()
+	if _, ok := NewAuthenticator(dev).(*u2fAuthenticator); !ok {
+		t.Errorf("Expected a U2F authenticator for a device without CBOR support")
+	}
+	testHid.capabilities = hid.CAPABILITY_WINK | hid.CAPABILITY_CBOR
+	if authenticator, ok := NewAuthenticator(dev).(*HidDevice); !ok || authenticator != dev {
+		t.Errorf("Expected the CTAP2 device for a device with CBOR support")
+	}
+}
+
+func TestNewAuthenticatorWithTimeout(t *testing.T) {
+	_, dev := newTestDevice()
+	authenticator, ok := NewAuthenticatorWithTimeout(dev, time.Second).(*u2fAuthenticator)
+	if !ok || authenticator.timeout != time.Second {
+		t.Errorf("Expected a U2F authenticator with the timeout, but got %#v", authenticator)
+	}
+}
+
+func TestU2FMakeCredential(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	token.touchAfter = 2
+	req := sampleMakeCredentialRequest()
+	response, err := authenticator.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if response.Format != attestationFormatFidoU2F {
+		t.Errorf("Expected format %s, but got %s", attestationFormatFidoU2F, response.Format)
+	}
+	authData := response.AuthenticatorData
+	if !bytes.Equal(authData.RPIDHash, sha256([]byte(req.RelyingParty.ID))) {
+		t.Errorf("Expected the RP ID hash of %s", req.RelyingParty.ID)
+	}
+	if !authData.UserPresent() || !bytes.Equal(authData.CredentialID, []byte("key handle")) {
+		t.Errorf("Expected a user present credential with the key handle, but got %#v", authData)
+	}
+	coseKey, _ := cbor.UnmarshalMap(authData.CredentialPublicKey)
+	publicKey, err := ecdsaFromCOSEKey(coseKey)
+	if err != nil || publicKey.X.Cmp(token.key.X) != 0 || publicKey.Y.Cmp(token.key.Y) != 0 {
+		t.Errorf("Expected the credential public key to match, but got %s", err)
+	}
+	x5c, _ := response.AttestationStatement.Array("x5c")
+	if len(x5c) != 1 || !bytes.Equal(x5c[0].([]byte), token.certificate) {
+		t.Errorf("Expected the attestation certificate in x5c")
+	}
+	signature, _ := response.AttestationStatement.Bytes("sig")
+	signed := butil.Concat([]byte{0}, authData.RPIDHash, req.ClientDataHash, authData.CredentialID, elliptic.Marshal(elliptic.P256(), token.key.X, token.key.Y))
+	if !ecdsa.VerifyASN1(&token.key.PublicKey, sha256(signed), signature) {
+		t.Errorf("Expected the attestation signature to verify")
+	}
+
+	// The exclude list is checked before registering
+	req.ExcludeList = [][]byte{[]byte("other"), []byte("key handle")}
+	_, err = authenticator.MakeCredential(req)
+	if _, ok := err.(*CredentialExcludedError); !ok {
+		t.Errorf("Expected CredentialExcludedError, but got %#v", err)
+	}
+
+	// Options U2F can not satisfy
+	req = sampleMakeCredentialRequest()
+	req.ResidentKey = true
+	if _, err = authenticator.MakeCredential(req); err == nil {
+		t.Errorf("Expected error for a resident credential")
+	}
+	req = sampleMakeCredentialRequest()
+	req.Algorithms = []int{-8}
+	if _, err = authenticator.MakeCredential(req); err == nil {
+		t.Errorf("Expected error for a non ES256 credential")
+	}
+	req = sampleMakeCredentialRequest()
+	req.Extensions.HmacSecret = true
+	if _, err = authenticator.MakeCredential(req); err == nil {
+		t.Errorf("Expected error for the hmac-secret extension")
+	}
+}
+
+func TestU2FGetAssertion(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	token.keyHandles["key handle"] = sha256([]byte("https://example.com/appid.json"))
+	token.touchAfter = 1
+	req := sampleGetAssertionRequest()
+	req.AllowList = [][]byte{[]byte("unknown"), []byte("key handle")}
+
+	// Not found for the RP ID
+	_, err := authenticator.GetAssertion(req)
+	if _, ok := err.(*NoCredentialsError); !ok {
+		t.Errorf("Expected NoCredentialsError, but got %#v", err)
+	}
+
+	// Found with the AppID
+	req.Extensions.AppID = "https://example.com/appid.json"
+	response, err := authenticator.GetAssertion(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !response.Extensions.AppID {
+		t.Errorf("Expected the AppID extension output to be true")
+	}
+	if !bytes.Equal(response.CredentialID, []byte("key handle")) {
+		t.Errorf("Expected credential id \"key handle\", but got %s", response.CredentialID)
+	}
+	if response.AuthenticatorData.SignCount != 42 || !response.AuthenticatorData.UserPresent() {
+		t.Errorf("Expected a user present assertion with counter 42, but got %#v", response.AuthenticatorData)
+	}
+	if !ecdsa.VerifyASN1(&token.key.PublicKey, sha256(butil.Concat(response.AuthData, req.ClientDataHash)), response.Signature) {
+		t.Errorf("Expected the signature to verify over the authenticator data and client data hash")
+	}
+
+	// Found with the RP ID
+	token.keyHandles["key handle"] = sha256([]byte(req.RPID))
+	response, err = authenticator.GetAssertion(req)
+	if err != nil || response.Extensions.AppID {
+		t.Errorf("Expected the RP ID to be used, but got %s", err)
+	}
+
+	// Extensions other than the AppID need a CTAP2 device
+	req.Extensions.CredBlob = true
+	if _, err = authenticator.GetAssertion(req); err == nil {
+		t.Errorf("Expected error for the credBlob extension")
+	}
+	req.Extensions.CredBlob = false
+
+	// U2F devices can not find resident credentials
+	req.AllowList = nil
+	if _, err = authenticator.GetAssertion(req); err == nil {
+		t.Errorf("Expected error without an allow list")
+	}
+}
+
+func TestU2FKeepAlive(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	token.touchAfter = 2
+	statuses := []KeepAliveStatus{}
+	authenticator.(*u2fAuthenticator).dev.OnKeepAlive(func(status KeepAliveStatus) {
+		statuses = append(statuses, status)
+	})
+	_, err := authenticator.MakeCredential(sampleMakeCredentialRequest())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(statuses) != 2 || statuses[0] != KeepAliveUserPresenceNeeded {
+		t.Errorf("Expected user presence to be needed twice, but got %v", statuses)
+	}
+}
+
+func TestU2FTimeout(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	token.touchAfter = 1000
+	authenticator.(*u2fAuthenticator).timeout = 5 * time.Millisecond
+	_, err := authenticator.MakeCredential(sampleMakeCredentialRequest())
+	if _, ok := err.(*UserActionTimeoutError); !ok {
+		t.Errorf("Expected UserActionTimeoutError, but got %#v", err)
+	}
+}
+
+func TestGetAssertionAppID(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	appID := "https://example.com/appid.json"
+	authenticator.commands[ctap2CommandGetAssertion] = func(params cbor.Map) (cbor.Map, uint8) {
+		if rpID, _ := params.String(getAssertionRPID); rpID != appID {
+			return nil, ctap2StatusNoCredentials
+		}
+		return authenticator.getAssertion(params), ctap2StatusOK
+	}
+	req := sampleGetAssertionRequest()
+	req.AllowList = [][]byte{authenticator.credentialID}
+	_, err := dev.GetAssertion(req)
+	if _, ok := err.(*NoCredentialsError); !ok {
+		t.Errorf("Expected NoCredentialsError, but got %#v", err)
+	}
+	req.Extensions.AppID = appID
+	response, err := dev.GetAssertion(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !response.Extensions.AppID {
+		t.Errorf("Expected the AppID extension output to be true")
+	}
+}
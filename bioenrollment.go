@@ -0,0 +1,286 @@
+package u2fhost
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The authenticatorBioEnrollment command is defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorBioEnrollment
+
+// CTAP2 authenticatorBioEnrollment subcommands
+const (
+	bioSubCommandEnrollBegin              uint8 = 0x01
+	bioSubCommandEnrollCaptureNextSample  uint8 = 0x02
+	bioSubCommandCancelCurrentEnrollment  uint8 = 0x03
+	bioSubCommandEnumerateEnrollments     uint8 = 0x04
+	bioSubCommandSetFriendlyName          uint8 = 0x05
+	bioSubCommandRemoveEnrollment         uint8 = 0x06
+	bioSubCommandGetFingerprintSensorInfo uint8 = 0x07
+)
+
+// CTAP2 authenticatorBioEnrollment parameter keys
+const (
+	bioModality          = 0x01
+	bioSubCommand        = 0x02
+	bioSubCommandParams  = 0x03
+	bioPinUvAuthProtocol = 0x04
+	bioPinUvAuthParam    = 0x05
+	bioGetModality       = 0x06
+)
+
+// CTAP2 authenticatorBioEnrollment subcommand parameter keys
+const (
+	bioParamTemplateId           = 0x01
+	bioParamTemplateFriendlyName = 0x02
+	bioParamTimeoutMilliseconds  = 0x03
+)
+
+// CTAP2 authenticatorBioEnrollment response keys
+const (
+	bioResponseModality                           = 0x01
+	bioResponseFingerprintKind                    = 0x02
+	bioResponseMaxCaptureSamplesRequiredForEnroll = 0x03
+	bioResponseTemplateId                         = 0x04
+	bioResponseLastEnrollSampleStatus             = 0x05
+	bioResponseRemainingSamples                   = 0x06
+	bioResponseTemplateInfos                      = 0x07
+	bioResponseMaxTemplateFriendlyName            = 0x08
+)
+
+// A BioModality is the kind of biometric sensor of an authenticator.
+type BioModality int
+
+const (
+	BioModalityFingerprint BioModality = 0x01
+)
+
+// The capabilities of an authenticator's fingerprint sensor.
+type FingerprintSensorInfo struct {
+	// 1 for touch sensors, 2 for swipe sensors.
+	FingerprintKind int `json:"fingerprintKind"`
+	// The number of good samples needed to enroll a fingerprint.
+	MaxCaptureSamplesRequiredForEnroll int `json:"maxCaptureSamplesRequiredForEnroll"`
+	// The maximum length of an enrollment's friendly name, in bytes.
+	MaxTemplateFriendlyName int `json:"maxTemplateFriendlyName,omitempty"`
+}
+
+// A BioEnrollment is a fingerprint enrolled on the authenticator.
+type BioEnrollment struct {
+	TemplateId   []byte `json:"templateId"`
+	FriendlyName string `json:"friendlyName,omitempty"`
+}
+
+// A BioSampleStatus is the authenticator's feedback on a captured fingerprint sample.
+type BioSampleStatus int
+
+const (
+	BioSampleGood           BioSampleStatus = 0x00
+	BioSampleTooHigh        BioSampleStatus = 0x01
+	BioSampleTooLow         BioSampleStatus = 0x02
+	BioSampleTooLeft        BioSampleStatus = 0x03
+	BioSampleTooRight       BioSampleStatus = 0x04
+	BioSampleTooFast        BioSampleStatus = 0x05
+	BioSampleTooSlow        BioSampleStatus = 0x06
+	BioSamplePoorQuality    BioSampleStatus = 0x07
+	BioSampleTooSkewed      BioSampleStatus = 0x08
+	BioSampleTooShort       BioSampleStatus = 0x09
+	BioSampleMergeFailure   BioSampleStatus = 0x0A
+	BioSampleExists         BioSampleStatus = 0x0B
+	BioSampleNoUserActivity BioSampleStatus = 0x0D
+	BioSampleNoUpTransition BioSampleStatus = 0x0E
+)
+
+var bioSampleStatusMessages = map[BioSampleStatus]string{
+	BioSampleGood:           "Good sample",
+	BioSampleTooHigh:        "Finger was too high",
+	BioSampleTooLow:         "Finger was too low",
+	BioSampleTooLeft:        "Finger was too far left",
+	BioSampleTooRight:       "Finger was too far right",
+	BioSampleTooFast:        "Finger moved too fast",
+	BioSampleTooSlow:        "Finger moved too slow",
+	BioSamplePoorQuality:    "Poor quality sample",
+	BioSampleTooSkewed:      "Finger was too skewed",
+	BioSampleTooShort:       "Finger was not on the sensor long enough",
+	BioSampleMergeFailure:   "Sample could not be merged with the previous samples",
+	BioSampleExists:         "Fingerprint is already enrolled",
+	BioSampleNoUserActivity: "No finger was detected",
+	BioSampleNoUpTransition: "Finger was not lifted from the sensor",
+}
+
+func (s BioSampleStatus) String() string {
+	if message, ok := bioSampleStatusMessages[s]; ok {
+		return message
+	}
+	return fmt.Sprintf("Unknown sample status 0x%02x", int(s))
+}
+
+// The result of capturing a sample while enrolling a fingerprint.
+type BioEnrollmentSample struct {
+	Status BioSampleStatus
+	// The number of good samples still needed to complete the enrollment.
+	RemainingSamples int
+}
+
+// Returns the biometric modality supported by the device.
+func (dev *HidDevice) GetBioModality() (BioModality, error) {
+	command, err := dev.bioEnrollmentCommand()
+	if err != nil {
+		return 0, err
+	}
+	response, err := dev.callCTAP2(command, cbor.Map{bioGetModality: true})
+	if err != nil {
+		return 0, err
+	}
+	return BioModality(cborInt(response, bioResponseModality)), nil
+}
+
+// Returns the capabilities of the device's fingerprint sensor.
+func (dev *HidDevice) GetFingerprintSensorInfo() (*FingerprintSensorInfo, error) {
+	response, err := dev.callBioEnrollment(nil, bioSubCommandGetFingerprintSensorInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &FingerprintSensorInfo{
+		FingerprintKind:                    cborInt(response, bioResponseFingerprintKind),
+		MaxCaptureSamplesRequiredForEnroll: cborInt(response, bioResponseMaxCaptureSamplesRequiredForEnroll),
+		MaxTemplateFriendlyName:            cborInt(response, bioResponseMaxTemplateFriendlyName),
+	}, nil
+}
+
+// Enrolls a new fingerprint, returning its template id.
+// The user is asked to touch the sensor repeatedly, after each sample the feedback
+// function (which may be nil) is called with the status of the sample and the number
+// of samples remaining. The timeout for each sample defaults to the device's if zero.
+// The token must have the PermissionBioEnrollment permission.
+func (dev *HidDevice) EnrollFingerprint(token *PinUvAuthToken, timeout time.Duration, feedback func(BioEnrollmentSample)) ([]byte, error) {
+	params := cbor.Map{}
+	if timeout > 0 {
+		params[bioParamTimeoutMilliseconds] = int64(timeout / time.Millisecond)
+	}
+	response, err := dev.callBioEnrollment(token, bioSubCommandEnrollBegin, params)
+	if err != nil {
+		return nil, err
+	}
+	templateId, ok := response.Bytes(bioResponseTemplateId)
+	if !ok {
+		return nil, errors.New("Device did not return a template id")
+	}
+	for {
+		sample := BioEnrollmentSample{
+			Status:           BioSampleStatus(cborInt(response, bioResponseLastEnrollSampleStatus)),
+			RemainingSamples: cborInt(response, bioResponseRemainingSamples),
+		}
+		if feedback != nil {
+			feedback(sample)
+		}
+		if sample.RemainingSamples <= 0 {
+			return templateId, nil
+		}
+		params = cbor.Map{bioParamTemplateId: templateId}
+		if timeout > 0 {
+			params[bioParamTimeoutMilliseconds] = int64(timeout / time.Millisecond)
+		}
+		response, err = dev.callBioEnrollment(token, bioSubCommandEnrollCaptureNextSample, params)
+		if err != nil {
+			dev.CancelFingerprintEnrollment()
+			return nil, err
+		}
+	}
+}
+
+// Cancels an enrollment that is in progress.
+func (dev *HidDevice) CancelFingerprintEnrollment() error {
+	_, err := dev.callBioEnrollment(nil, bioSubCommandCancelCurrentEnrollment, nil)
+	return err
+}
+
+// Returns the fingerprints enrolled on the device.
+// The token must have the PermissionBioEnrollment permission.
+func (dev *HidDevice) EnumerateEnrollments(token *PinUvAuthToken) ([]BioEnrollment, error) {
+	response, err := dev.callBioEnrollment(token, bioSubCommandEnumerateEnrollments, nil)
+	if _, ok := err.(*InvalidOptionError); ok {
+		// Returned when there are no enrollments
+		return []BioEnrollment{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	templateInfos, _ := response.Array(bioResponseTemplateInfos)
+	enrollments := []BioEnrollment{}
+	for _, templateInfo := range templateInfos {
+		info, ok := templateInfo.(cbor.Map)
+		if !ok {
+			continue
+		}
+		enrollment := BioEnrollment{}
+		enrollment.TemplateId, _ = info.Bytes(bioParamTemplateId)
+		enrollment.FriendlyName, _ = info.String(bioParamTemplateFriendlyName)
+		enrollments = append(enrollments, enrollment)
+	}
+	return enrollments, nil
+}
+
+// Sets the friendly name of an enrolled fingerprint.
+// The token must have the PermissionBioEnrollment permission.
+func (dev *HidDevice) SetEnrollmentFriendlyName(token *PinUvAuthToken, templateId []byte, name string) error {
+	_, err := dev.callBioEnrollment(token, bioSubCommandSetFriendlyName, cbor.Map{
+		bioParamTemplateId:           templateId,
+		bioParamTemplateFriendlyName: name,
+	})
+	return err
+}
+
+// Removes an enrolled fingerprint.
+// The token must have the PermissionBioEnrollment permission.
+func (dev *HidDevice) RemoveEnrollment(token *PinUvAuthToken, templateId []byte) error {
+	_, err := dev.callBioEnrollment(token, bioSubCommandRemoveEnrollment, cbor.Map{
+		bioParamTemplateId: templateId,
+	})
+	return err
+}
+
+// Returns the bio enrollment command supported by the device, CTAP2.1
+// pre-release devices use a vendor command.
+func (dev *HidDevice) bioEnrollmentCommand() (uint8, error) {
+	info, err := dev.GetInfo()
+	if err != nil {
+		return 0, err
+	}
+	if supported, _ := info.Option("bioEnroll"); supported {
+		return ctap2CommandBioEnrollment, nil
+	}
+	if supported, _ := info.Option("userVerificationMgmtPreview"); supported {
+		return ctap2CommandBioEnrollmentPreview, nil
+	}
+	return 0, errors.New("Device does not support bio enrollment")
+}
+
+// Sends the bio enrollment subcommand for the fingerprint modality,
+// authenticated with the token if it is not nil.
+func (dev *HidDevice) callBioEnrollment(token *PinUvAuthToken, subCommand uint8, subCommandParams cbor.Map) (cbor.Map, error) {
+	command, err := dev.bioEnrollmentCommand()
+	if err != nil {
+		return nil, err
+	}
+	params := cbor.Map{
+		bioModality:   int(BioModalityFingerprint),
+		bioSubCommand: subCommand,
+	}
+	message := []byte{byte(BioModalityFingerprint), subCommand}
+	if len(subCommandParams) > 0 {
+		params[bioSubCommandParams] = subCommandParams
+		encoded, err := cbor.Marshal(subCommandParams)
+		if err != nil {
+			return nil, err
+		}
+		message = append(message, encoded...)
+	}
+	if token != nil {
+		params[bioPinUvAuthProtocol] = token.protocol.version()
+		params[bioPinUvAuthParam] = token.authenticate(message)
+	}
+	return dev.callCTAP2(command, params)
+}
@@ -0,0 +1,204 @@
+package u2fhost
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// Emulates fingerprint enrollment, the samples are returned in order
+// and every good sample reduces the remaining samples.
+type testBioEnrollment struct {
+	authenticator *testAuthenticator
+	samples       []BioSampleStatus
+	remaining     int
+	enrollments   map[string]string
+	subCommands   []uint8
+}
+
+func newTestBioEnrollment(t *testing.T) (*testBioEnrollment, *HidDevice) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	authenticator.pin = "1234"
+	authenticator.info[getInfoOptions] = map[string]bool{"clientPin": true, "pinUvAuthToken": true, "bioEnroll": false}
+	bio := &testBioEnrollment{authenticator: authenticator, enrollments: map[string]string{}}
+	authenticator.commands[ctap2CommandBioEnrollment] = bio.handle
+	return bio, dev
+}
+
+func (b *testBioEnrollment) handle(params cbor.Map) (cbor.Map, uint8) {
+	if getModality, _ := params.Bool(bioGetModality); getModality {
+		return cbor.Map{bioResponseModality: 1}, ctap2StatusOK
+	}
+	subCommand, _ := params.Int(bioSubCommand)
+	b.subCommands = append(b.subCommands, uint8(subCommand))
+	subCommandParams, _ := params.Map(bioSubCommandParams)
+	if uint8(subCommand) != bioSubCommandGetFingerprintSensorInfo && uint8(subCommand) != bioSubCommandCancelCurrentEnrollment {
+		message := []byte{1, uint8(subCommand)}
+		if subCommandParams != nil {
+			encoded, _ := cbor.Marshal(subCommandParams)
+			message = append(message, encoded...)
+		}
+		param, _ := params.Bytes(bioPinUvAuthParam)
+		if !b.authenticator.verifyPinUvAuthParam(param, message) {
+			return nil, ctap2StatusPinAuthInvalid
+		}
+	}
+	templateId, _ := subCommandParams.Bytes(bioParamTemplateId)
+	switch uint8(subCommand) {
+	case bioSubCommandGetFingerprintSensorInfo:
+		return cbor.Map{
+			bioResponseFingerprintKind:                    1,
+			bioResponseMaxCaptureSamplesRequiredForEnroll: 3,
+			bioResponseMaxTemplateFriendlyName:            32,
+		}, ctap2StatusOK
+	case bioSubCommandEnrollBegin, bioSubCommandEnrollCaptureNextSample:
+		if len(b.samples) == 0 {
+			return nil, ctap2StatusUserActionTimeout
+		}
+		status := b.samples[0]
+		b.samples = b.samples[1:]
+		if status == BioSampleGood {
+			b.remaining--
+		}
+		response := cbor.Map{
+			bioResponseLastEnrollSampleStatus: int(status),
+			bioResponseRemainingSamples:       b.remaining,
+		}
+		if uint8(subCommand) == bioSubCommandEnrollBegin {
+			response[bioResponseTemplateId] = []byte("template")
+		}
+		if b.remaining == 0 {
+			b.enrollments["template"] = ""
+		}
+		return response, ctap2StatusOK
+	case bioSubCommandEnumerateEnrollments:
+		if len(b.enrollments) == 0 {
+			return nil, ctap2StatusInvalidOption
+		}
+		infos := []interface{}{}
+		for id, name := range b.enrollments {
+			infos = append(infos, cbor.Map{bioParamTemplateId: []byte(id), bioParamTemplateFriendlyName: name})
+		}
+		return cbor.Map{bioResponseTemplateInfos: infos}, ctap2StatusOK
+	case bioSubCommandSetFriendlyName:
+		b.enrollments[string(templateId)], _ = subCommandParams.String(bioParamTemplateFriendlyName)
+	case bioSubCommandRemoveEnrollment:
+		delete(b.enrollments, string(templateId))
+	}
+	return cbor.Map{}, ctap2StatusOK
+}
+
+func TestBioSensorInfo(t *testing.T) {
+	_, dev := newTestBioEnrollment(t)
+	modality, err := dev.GetBioModality()
+	if err != nil || modality != BioModalityFingerprint {
+		t.Errorf("Expected fingerprint modality, but got %d %s", modality, err)
+	}
+	info, err := dev.GetFingerprintSensorInfo()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := FingerprintSensorInfo{FingerprintKind: 1, MaxCaptureSamplesRequiredForEnroll: 3, MaxTemplateFriendlyName: 32}
+	if *info != expected {
+		t.Errorf("Expected %#v, but got %#v", expected, *info)
+	}
+
+	// Devices without bio enrollment
+	authenticator, _, dev := newTestAuthenticator(t)
+	_, err = dev.GetFingerprintSensorInfo()
+	if err == nil {
+		t.Errorf("Expected error for device without bio enrollment")
+	}
+
+	// Pre-release devices use the vendor command
+	authenticator.info[getInfoOptions] = map[string]bool{"userVerificationMgmtPreview": true}
+	bio := &testBioEnrollment{authenticator: authenticator}
+	authenticator.commands[ctap2CommandBioEnrollmentPreview] = bio.handle
+	_, err = dev.GetFingerprintSensorInfo()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestEnrollFingerprint(t *testing.T) {
+	bio, dev := newTestBioEnrollment(t)
+	token, err := dev.GetPinUvAuthToken("1234", PermissionBioEnrollment, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// No enrollments
+	enrollments, err := dev.EnumerateEnrollments(token)
+	if err != nil || len(enrollments) != 0 {
+		t.Errorf("Expected no enrollments, but got %#v %s", enrollments, err)
+	}
+
+	bio.samples = []BioSampleStatus{BioSampleGood, BioSampleTooFast, BioSampleGood, BioSampleGood}
+	bio.remaining = 3
+	feedback := []BioEnrollmentSample{}
+	templateId, err := dev.EnrollFingerprint(token, 10*time.Second, func(sample BioEnrollmentSample) {
+		feedback = append(feedback, sample)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(templateId, []byte("template")) {
+		t.Errorf("Expected template id \"template\", but got %s", templateId)
+	}
+	expected := []BioEnrollmentSample{
+		{BioSampleGood, 2},
+		{BioSampleTooFast, 2},
+		{BioSampleGood, 1},
+		{BioSampleGood, 0},
+	}
+	if len(feedback) != len(expected) {
+		t.Fatalf("Expected feedback %v, but got %v", expected, feedback)
+	}
+	for i := range expected {
+		if feedback[i] != expected[i] {
+			t.Errorf("Expected feedback %v, but got %v", expected[i], feedback[i])
+		}
+	}
+	if timeout, _ := bio.authenticator.requests[ctap2CommandBioEnrollment].Map(bioSubCommandParams); timeout == nil {
+		t.Errorf("Expected sub command params")
+	} else if ms, _ := timeout.Int(bioParamTimeoutMilliseconds); ms != 10000 {
+		t.Errorf("Expected timeout 10000ms, but got %d", ms)
+	}
+
+	// Rename, enumerate and remove
+	err = dev.SetEnrollmentFriendlyName(token, templateId, "right index")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	enrollments, err = dev.EnumerateEnrollments(token)
+	if err != nil || len(enrollments) != 1 || enrollments[0].FriendlyName != "right index" {
+		t.Errorf("Expected one enrollment named \"right index\", but got %#v %s", enrollments, err)
+	}
+	err = dev.RemoveEnrollment(token, templateId)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(bio.enrollments) != 0 {
+		t.Errorf("Expected enrollment to be removed")
+	}
+
+	// A failed capture cancels the enrollment
+	bio.samples = []BioSampleStatus{BioSampleTooHigh}
+	bio.remaining = 3
+	bio.subCommands = nil
+	_, err = dev.EnrollFingerprint(token, 0, nil)
+	if _, ok := err.(*UserActionTimeoutError); !ok {
+		t.Errorf("Expected UserActionTimeoutError, but got %#v", err)
+	}
+	if bio.subCommands[len(bio.subCommands)-1] != bioSubCommandCancelCurrentEnrollment {
+		t.Errorf("Expected the enrollment to be cancelled, but got subcommands %v", bio.subCommands)
+	}
+
+	// Invalid token
+	_, err = dev.EnumerateEnrollments(nil)
+	if _, ok := err.(*PinAuthInvalidError); !ok {
+		t.Errorf("Expected PinAuthInvalidError, but got %#v", err)
+	}
+}
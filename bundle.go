@@ -0,0 +1,124 @@
+package u2fhost
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The version of the signature bundle format written by NewSignatureBundle.
+const SignatureBundleVersion = 1
+
+// A SignatureBundle is a detached signature over a SHA-256 digest, such as the
+// hash of a file, made by a U2F device signing the digest as the challenge of
+// an AuthenticateRequest.
+//
+// Its JSON form is the bundle format, version 1 of which has these members:
+//
+//	version        1
+//	digest         the base64url SHA-256 digest that was signed
+//	appId          the AppId the key handle was registered with
+//	facet          the facet in the client data
+//	keyHandle      the base64url key handle that signed
+//	publicKey      the base64url COSE_Key public key of the key handle
+//	clientData     the base64url U2F client data, whose challenge is the digest
+//	signatureData  the base64url U2F signature data: the user presence byte,
+//	               the counter and the signature
+//	counter        the counter from the signature data
+//
+// Binary members are unpadded base64url. Verifiers must reject versions they
+// do not support, and ignore members they do not recognise.
+type SignatureBundle struct {
+	Version       int       `json:"version"`
+	Digest        Base64URL `json:"digest"`
+	AppId         string    `json:"appId"`
+	Facet         string    `json:"facet"`
+	KeyHandle     string    `json:"keyHandle"`
+	PublicKey     Base64URL `json:"publicKey"`
+	ClientData    string    `json:"clientData"`
+	SignatureData string    `json:"signatureData"`
+	Counter       uint32    `json:"counter"`
+}
+
+// Returns the AuthenticateRequest that signs the SHA-256 digest with the key handle,
+// the challenge is the base64url encoded digest.
+func SignDigestRequest(digest []byte, appId, facet, keyHandle string) *AuthenticateRequest {
+	return &AuthenticateRequest{
+		Challenge: websafeEncode(digest),
+		AppId:     appId,
+		Facet:     facet,
+		KeyHandle: keyHandle,
+	}
+}
+
+// Creates the bundle from the response to a SignDigestRequest, checking the
+// signature with the COSE_Key encoded public key of the key handle.
+func NewSignatureBundle(req *AuthenticateRequest, response *AuthenticateResponse, publicKey []byte) (*SignatureBundle, error) {
+	digest, err := websafeDecode(req.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("The challenge is not a base64url digest: %s", err)
+	}
+	bundle := &SignatureBundle{
+		Version:       SignatureBundleVersion,
+		Digest:        digest,
+		AppId:         req.AppId,
+		Facet:         req.Facet,
+		KeyHandle:     response.KeyHandle,
+		PublicKey:     publicKey,
+		ClientData:    response.ClientData,
+		SignatureData: response.SignatureData,
+	}
+	authData, err := VerifyAuthenticateResponse(bundle.authenticateResponse(), req.AppId, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Counter = authData.SignCount
+	return bundle, nil
+}
+
+// Checks the bundle is a valid signature of the SHA-256 digest, returning an
+// InvalidSignatureError if not.
+// The signature is verified with the publicKey, which should be the COSE_Key of a
+// key handle you trust. If it is nil the public key in the bundle is used, which
+// only shows the bundle is consistent, not who signed it.
+func (b *SignatureBundle) Verify(digest, publicKey []byte) error {
+	if b.Version != SignatureBundleVersion {
+		return &InvalidSignatureError{Reason: fmt.Sprintf("unsupported bundle version %d", b.Version)}
+	}
+	if !bytes.Equal(b.Digest, digest) {
+		return &InvalidSignatureError{Reason: "the bundle is for a different digest"}
+	}
+	err := VerifyClientData(b.ClientData, ClientDataTypeAuthenticate, websafeEncode(digest), b.Facet)
+	if err != nil {
+		return invalidSignature(err)
+	}
+	if publicKey == nil {
+		publicKey = b.PublicKey
+	}
+	authData, err := VerifyAuthenticateResponse(b.authenticateResponse(), b.AppId, publicKey)
+	if err != nil {
+		return invalidSignature(err)
+	}
+	if !authData.UserPresent() {
+		return &InvalidSignatureError{Reason: "the user was not present"}
+	}
+	if authData.SignCount != b.Counter {
+		return &InvalidSignatureError{Reason: fmt.Sprintf("the counter is %d, not %d", authData.SignCount, b.Counter)}
+	}
+	return nil
+}
+
+func (b *SignatureBundle) authenticateResponse() *AuthenticateResponse {
+	return &AuthenticateResponse{
+		KeyHandle:     b.KeyHandle,
+		ClientData:    b.ClientData,
+		SignatureData: b.SignatureData,
+	}
+}
+
+// Returns an InvalidSignatureError with the reason the response was invalid.
+func invalidSignature(err error) error {
+	if invalid, ok := err.(*InvalidResponseError); ok {
+		return &InvalidSignatureError{Reason: invalid.Reason}
+	}
+	return &InvalidSignatureError{Reason: err.Error()}
+}
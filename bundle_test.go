@@ -0,0 +1,65 @@
+package u2fhost
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSignatureBundle(t *testing.T) {
+	dev := newTestU2FDevice(t)
+	appId := "https://example.com"
+	publicKey := testRegisteredKey(t, dev, appId)
+	digest := sha256([]byte("file contents"))
+
+	req := SignDigestRequest(digest, appId, appId, websafeEncode([]byte("key handle")))
+	response, err := dev.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Unexpected error authenticating: %s", err)
+	}
+	bundle, err := NewSignatureBundle(req, response, publicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the bundle: %s", err)
+	}
+	if bundle.Version != SignatureBundleVersion || bundle.Counter != 42 {
+		t.Errorf("Unexpected bundle %#v", bundle)
+	}
+
+	// Round trip through the JSON bundle format
+	bundleJson, _ := json.Marshal(bundle)
+	var parsed SignatureBundle
+	err = json.Unmarshal(bundleJson, &parsed)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the bundle: %s", err)
+	}
+	if err = parsed.Verify(digest, nil); err != nil {
+		t.Errorf("Unexpected error verifying with the bundle key: %s", err)
+	}
+	if err = parsed.Verify(digest, publicKey); err != nil {
+		t.Errorf("Unexpected error verifying with the trusted key: %s", err)
+	}
+
+	otherKey := testRegisteredKey(t, newTestU2FDevice(t), appId)
+	tests := []struct {
+		name      string
+		modify    func(b *SignatureBundle)
+		digest    []byte
+		publicKey []byte
+	}{
+		{"version", func(b *SignatureBundle) { b.Version = 2 }, digest, nil},
+		{"digest", func(b *SignatureBundle) {}, sha256([]byte("other contents")), nil},
+		{"bundle digest", func(b *SignatureBundle) { b.Digest = sha256([]byte("other contents")) }, sha256([]byte("other contents")), nil},
+		{"facet", func(b *SignatureBundle) { b.Facet = "https://evil.com" }, digest, nil},
+		{"app id", func(b *SignatureBundle) { b.AppId = "https://evil.com" }, digest, nil},
+		{"counter", func(b *SignatureBundle) { b.Counter = 43 }, digest, nil},
+		{"trusted key", func(b *SignatureBundle) {}, digest, otherKey},
+		{"bundle key", func(b *SignatureBundle) { b.PublicKey = otherKey }, digest, nil},
+	}
+	for _, test := range tests {
+		modified := parsed
+		test.modify(&modified)
+		err := modified.Verify(test.digest, test.publicKey)
+		if _, ok := err.(*InvalidSignatureError); !ok {
+			t.Errorf("%s: expected an InvalidSignatureError but got %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package cbor implements the subset of CBOR used by CTAP2 messages.
+//
+// Encoding always produces CTAP2 canonical CBOR, with map keys sorted by the
+// length and then the bytes of their encoding, and integers encoded in the
+// fewest bytes possible.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#ctap2-canonical-cbor-encoding-form
+package cbor
+
+// Major types
+const (
+	majorUnsigned uint8 = 0
+	majorNegative uint8 = 1
+	majorBytes    uint8 = 2
+	majorString   uint8 = 3
+	majorArray    uint8 = 4
+	majorMap      uint8 = 5
+	majorTag      uint8 = 6
+	majorSimple   uint8 = 7
+)
+
+// Simple values
+const (
+	simpleFalse uint8 = 20
+	simpleTrue  uint8 = 21
+	simpleNull  uint8 = 22
+)
+
+// A Map is a CBOR map.
+// When encoding, keys may be any integer type or a string.
+// Decoded maps have int64 (or uint64 if too large for an int64) and string keys.
+type Map map[interface{}]interface{}
+
+// RawMessage is an already encoded CBOR value, it is copied verbatim when encoding.
+type RawMessage []byte
+
+// Returns the value for the key, integer keys of any type are
+// treated as equal to a decoded integer key with the same value.
+func (m Map) Get(key interface{}) (interface{}, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+	value, ok := m[normalizeKey(key)]
+	return value, ok
+}
+
+// Returns the integer value for the key.
+// Values of any integer type that fit in an int64 are returned.
+func (m Map) Int(key interface{}) (int64, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return 0, false
+	}
+	i, ok := normalizeKey(value).(int64)
+	return i, ok
+}
+
+// Returns the byte string value for the key.
+func (m Map) Bytes(key interface{}) ([]byte, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return nil, false
+	}
+	b, ok := value.([]byte)
+	return b, ok
+}
+
+// Returns the text string value for the key.
+func (m Map) String(key interface{}) (string, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok
+}
+
+// Returns the boolean value for the key.
+func (m Map) Bool(key interface{}) (bool, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return false, false
+	}
+	b, ok := value.(bool)
+	return b, ok
+}
+
+// Returns the map value for the key.
+func (m Map) Map(key interface{}) (Map, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return nil, false
+	}
+	mv, ok := value.(Map)
+	return mv, ok
+}
+
+// Returns the array value for the key.
+func (m Map) Array(key interface{}) ([]interface{}, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return nil, false
+	}
+	a, ok := value.([]interface{})
+	return a, ok
+}
+
+// Converts integers to the int64 representation used by decoded maps.
+func normalizeKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case int:
+		return int64(k)
+	case int8:
+		return int64(k)
+	case int16:
+		return int64(k)
+	case int32:
+		return int64(k)
+	case uint:
+		return normalizeUint(uint64(k))
+	case uint8:
+		return int64(k)
+	case uint16:
+		return int64(k)
+	case uint32:
+		return int64(k)
+	case uint64:
+		return normalizeUint(k)
+	}
+	return key
+}
+
+func normalizeUint(u uint64) interface{} {
+	if u > 1<<63-1 {
+		return u
+	}
+	return int64(u)
+}
@@ -0,0 +1,286 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{-1, "20"},
+		{-25, "3818"},
+		{uint64(1000000), "1a000f4240"},
+		{"a", "6161"},
+		{[]byte{1, 2}, "420102"},
+		{true, "f5"},
+		{nil, "f6"},
+		{[]interface{}{1, "a"}, "82016161"},
+		{[]string{"a"}, "816161"},
+		// Keys are sorted by encoded length then bytes, regardless of type.
+		{Map{"aa": 1, "b": 2, 10: 3, -1: 4, 100: 5}, "a50a03200418640561620262616101"},
+	}
+	for _, test := range tests {
+		result, err := Marshal(test.value)
+		if err != nil {
+			t.Errorf("Unexpected error marshaling %#v: %s", test.value, err)
+		} else if hex.EncodeToString(result) != test.expected {
+			t.Errorf("Expected %#v to marshal to %s but got %x", test.value, test.expected, result)
+		}
+	}
+
+	_, err := Marshal(1.5)
+	if err == nil {
+		t.Errorf("Expected error marshaling a float")
+	}
+	_, err = Marshal(Map{1: 1, int64(1): 2})
+	if err == nil {
+		t.Errorf("Expected error marshaling duplicate keys")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	value := Map{
+		1:       "string",
+		2:       []byte{1, 2, 3},
+		3:       -7,
+		"array": []interface{}{true, false, nil},
+		"map":   Map{"up": true},
+	}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Unexpected error marshaling: %s", err)
+	}
+	m, err := UnmarshalMap(data)
+	if err != nil {
+		t.Fatalf("Unexpected error unmarshaling: %s", err)
+	}
+	if s, _ := m.String(1); s != "string" {
+		t.Errorf("Expected \"string\" but got %#v", s)
+	}
+	if b, _ := m.Bytes(2); !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Errorf("Expected [1 2 3] but got %#v", b)
+	}
+	if i, _ := m.Int(3); i != -7 {
+		t.Errorf("Expected -7 but got %d", i)
+	}
+	if a, _ := m.Array("array"); !reflect.DeepEqual(a, []interface{}{true, false, nil}) {
+		t.Errorf("Expected [true false nil] but got %#v", a)
+	}
+	if inner, _ := m.Map("map"); inner == nil {
+		t.Errorf("Expected inner map but got nil")
+	} else if up, _ := inner.Bool("up"); !up {
+		t.Errorf("Expected up to be true")
+	}
+
+	// Trailing bytes
+	_, err = Unmarshal([]byte{0x01, 0x02})
+	if err == nil {
+		t.Errorf("Expected error for trailing bytes")
+	}
+	value2, rest, err := UnmarshalFirst([]byte{0x01, 0x02})
+	if err != nil || value2 != int64(1) || !bytes.Equal(rest, []byte{0x02}) {
+		t.Errorf("Expected 1 with rest [2] but got %#v %#v %s", value2, rest, err)
+	}
+
+	// Truncated data
+	_, err = Unmarshal([]byte{0x43, 0x01})
+	if err == nil {
+		t.Errorf("Expected error for truncated data")
+	}
+	_, err = Unmarshal([]byte{0x9a, 0xff, 0xff, 0xff, 0xff})
+	if err == nil {
+		t.Errorf("Expected error for truncated array")
+	}
+}
+
+// Examples from RFC 8949 Appendix A, for the types used by CTAP2.
+// https://www.rfc-editor.org/rfc/rfc8949.html#name-examples-of-encoded-cbor-da
+var rfcExamples = []struct {
+	value   interface{}
+	encoded string
+}{
+	{int64(0), "00"},
+	{int64(1), "01"},
+	{int64(10), "0a"},
+	{int64(23), "17"},
+	{int64(24), "1818"},
+	{int64(25), "1819"},
+	{int64(100), "1864"},
+	{int64(1000), "1903e8"},
+	{int64(1000000), "1a000f4240"},
+	{int64(1000000000000), "1b000000e8d4a51000"},
+	{uint64(18446744073709551615), "1bffffffffffffffff"},
+	{int64(-1), "20"},
+	{int64(-10), "29"},
+	{int64(-100), "3863"},
+	{int64(-1000), "3903e7"},
+	{false, "f4"},
+	{true, "f5"},
+	{nil, "f6"},
+	{[]byte{}, "40"},
+	{[]byte{1, 2, 3, 4}, "4401020304"},
+	{"", "60"},
+	{"a", "6161"},
+	{"IETF", "6449455446"},
+	{"\"\\", "62225c"},
+	{"ü", "62c3bc"},
+	{"水", "63e6b0b4"},
+	{[]interface{}{}, "80"},
+	{[]interface{}{int64(1), int64(2), int64(3)}, "83010203"},
+	{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, "8301820203820405"},
+	{Map{}, "a0"},
+	{Map{int64(1): int64(2), int64(3): int64(4)}, "a201020304"},
+	{Map{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, "a26161016162820203"},
+	{[]interface{}{"a", Map{"b": "c"}}, "826161a161626163"},
+}
+
+func TestRFCExamples(t *testing.T) {
+	for _, example := range rfcExamples {
+		encoded, err := Marshal(example.value)
+		if err != nil {
+			t.Errorf("Unexpected error marshaling %#v: %s", example.value, err)
+		} else if hex.EncodeToString(encoded) != example.encoded {
+			t.Errorf("Expected %#v to marshal to %s but got %x", example.value, example.encoded, encoded)
+		}
+		data, _ := hex.DecodeString(example.encoded)
+		decoded, err := DecodeOptions{MaxDepth: 4, MaxItems: 16, RequireCanonical: true}.Unmarshal(data)
+		if err != nil {
+			t.Errorf("Unexpected error unmarshaling %s: %s", example.encoded, err)
+		} else if !reflect.DeepEqual(decoded, example.value) {
+			t.Errorf("Expected %s to unmarshal to %#v but got %#v", example.encoded, example.value, decoded)
+		}
+	}
+}
+
+// Keys sort by the length of their encoding and then by their bytes, as described in
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#ctap2-canonical-cbor-encoding-form
+func TestCanonicalKeyOrder(t *testing.T) {
+	encoded, err := Marshal(Map{"aa": 5, "z": 4, -1: 3, 100: 2, 10: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "a5" + "0a01" + "2003" + "186402" + "617a04" + "62616105"
+	if hex.EncodeToString(encoded) != expected {
+		t.Errorf("Expected %s but got %x", expected, encoded)
+	}
+}
+
+// The authenticatorGetInfo response example from the CTAP2 specification.
+func TestGetInfoExample(t *testing.T) {
+	example := "a6" +
+		"0182" + "6655" + "32465f5632" + "68" + "4649444f5f325f30" +
+		"0282" + "63" + "75766d" + "6b" + "686d61632d736563726574" +
+		"0350" + "f8a011f38c0a4d15800617111f9edc7d" +
+		"04a4" + "62726bf5" + "627570f5" + "64706c6174f4" + "69636c69656e7450696ef4" +
+		"051904b0" +
+		"068101"
+	data, _ := hex.DecodeString(example)
+	m, err := DecodeOptions{MaxDepth: 4, MaxItems: 64, RequireCanonical: true}.UnmarshalMap(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if versions, _ := m.Array(1); !reflect.DeepEqual(versions, []interface{}{"U2F_V2", "FIDO_2_0"}) {
+		t.Errorf("Unexpected versions %#v", versions)
+	}
+	if aaguid, _ := m.Bytes(3); hex.EncodeToString(aaguid) != "f8a011f38c0a4d15800617111f9edc7d" {
+		t.Errorf("Unexpected aaguid %x", aaguid)
+	}
+	if options, _ := m.Map(4); options == nil {
+		t.Errorf("Expected options map")
+	} else if plat, ok := options.Bool("plat"); !ok || plat {
+		t.Errorf("Expected plat option to be false")
+	}
+	if maxMsgSize, _ := m.Int(5); maxMsgSize != 1200 {
+		t.Errorf("Expected max message size 1200, but got %d", maxMsgSize)
+	}
+	// Encoding the decoded value reproduces the canonical example.
+	encoded, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if hex.EncodeToString(encoded) != example {
+		t.Errorf("Expected %s but got %x", example, encoded)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	canonical := DecodeOptions{MaxDepth: 2, MaxItems: 8, RequireCanonical: true}
+	tests := []struct {
+		name    string
+		encoded string
+		options DecodeOptions
+	}{
+		{"non-minimal integer", "1817", canonical},
+		{"non-minimal length", "580100", canonical},
+		{"unsorted keys", "a202010102", canonical},
+		{"longer key before shorter key", "a2186401" + "0102", canonical},
+		{"depth", "818181", canonical},
+		{"items", "89010101010101010101", canonical},
+		{"duplicate key", "a201010102", DefaultDecodeOptions},
+		{"indefinite length", "5f4101ff", DefaultDecodeOptions},
+		{"tag", "c11a514b67b0", DefaultDecodeOptions},
+		{"float", "f93c00", DefaultDecodeOptions},
+		{"undefined", "f7", DefaultDecodeOptions},
+		{"reserved", "1c", DefaultDecodeOptions},
+		{"invalid utf-8", "61ff", DefaultDecodeOptions},
+		{"array map key", "a18001", DefaultDecodeOptions},
+		{"negative overflow", "3bffffffffffffffff", DefaultDecodeOptions},
+		{"long byte string", "5affffffff00", DefaultDecodeOptions},
+		{"long map", "bbffffffffffffffff", DefaultDecodeOptions},
+	}
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.encoded)
+		_, err := test.options.Unmarshal(data)
+		if err == nil {
+			t.Errorf("Expected error decoding %s (%s)", test.name, test.encoded)
+		}
+	}
+
+	// Non-canonical data is accepted by default
+	for _, encoded := range []string{"1817", "a202010102"} {
+		data, _ := hex.DecodeString(encoded)
+		_, err := Unmarshal(data)
+		if err != nil {
+			t.Errorf("Unexpected error decoding %s: %s", encoded, err)
+		}
+	}
+}
+
+func TestZeroDecodeOptions(t *testing.T) {
+	// Zero limits use the defaults
+	data, _ := hex.DecodeString("a201820102026161")
+	m, err := DecodeOptions{}.UnmarshalMap(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if s, _ := m.String(2); s != "a" {
+		t.Errorf("Unexpected map %#v", m)
+	}
+	deep := make([]byte, DefaultDecodeOptions.MaxDepth+1)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+	if _, err = (DecodeOptions{RequireCanonical: true}).Unmarshal(append(deep, 0x01)); err == nil {
+		t.Errorf("Expected error for nesting deeper than the default limit")
+	}
+}
+
+func TestMarshalDepth(t *testing.T) {
+	var value interface{} = 1
+	for i := 0; i < maxEncodeDepth+1; i++ {
+		value = []interface{}{value}
+	}
+	_, err := Marshal(value)
+	if err == nil {
+		t.Errorf("Expected error marshaling deeply nested value")
+	}
+}
@@ -0,0 +1,264 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// DecodeOptions limits what the decoder accepts.
+type DecodeOptions struct {
+	// The maximum nesting depth of arrays and maps, a top level map has a depth of 1.
+	// Zero uses the limit of the DefaultDecodeOptions.
+	MaxDepth int
+	// The maximum number of items, including nested items, in the data.
+	// Zero uses the limit of the DefaultDecodeOptions.
+	MaxItems int
+	// Optional boolean (defaults to false) that when true, rejects data that is not
+	// CTAP2 canonical CBOR, such as integers not encoded in the fewest bytes possible
+	// and map keys that are not sorted.
+	RequireCanonical bool
+}
+
+// The options used by Unmarshal and UnmarshalFirst. The limits are well above what
+// CTAP2 messages need, while bounding the work done on malformed input.
+var DefaultDecodeOptions = DecodeOptions{
+	MaxDepth: 16,
+	MaxItems: 1 << 16,
+}
+
+// Decodes a single CBOR item which must span all of the data,
+// using the DefaultDecodeOptions.
+// Integers decode to int64 (or uint64 if too large), byte strings to []byte,
+// text strings to string, arrays to []interface{} and maps to Map.
+func Unmarshal(data []byte) (interface{}, error) {
+	return DefaultDecodeOptions.Unmarshal(data)
+}
+
+// Decodes the first CBOR item in the data, returning the item and the remaining bytes,
+// using the DefaultDecodeOptions.
+func UnmarshalFirst(data []byte) (interface{}, []byte, error) {
+	return DefaultDecodeOptions.UnmarshalFirst(data)
+}
+
+// Decodes a single CBOR item which must be a map, using the DefaultDecodeOptions.
+func UnmarshalMap(data []byte) (Map, error) {
+	return DefaultDecodeOptions.UnmarshalMap(data)
+}
+
+// Decodes a single CBOR item which must span all of the data.
+func (o DecodeOptions) Unmarshal(data []byte) (interface{}, error) {
+	value, rest, err := o.UnmarshalFirst(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("cbor: %d trailing bytes after item", len(rest))
+	}
+	return value, nil
+}
+
+// Decodes the first CBOR item in the data, returning the item and the remaining bytes.
+func (o DecodeOptions) UnmarshalFirst(data []byte) (interface{}, []byte, error) {
+	if o.MaxDepth == 0 {
+		o.MaxDepth = DefaultDecodeOptions.MaxDepth
+	}
+	if o.MaxItems == 0 {
+		o.MaxItems = DefaultDecodeOptions.MaxItems
+	}
+	d := &decoder{data: data, options: o}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, d.data[d.offset:], nil
+}
+
+// Decodes a single CBOR item which must be a map.
+func (o DecodeOptions) UnmarshalMap(data []byte) (Map, error) {
+	value, err := o.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := value.(Map)
+	if !ok {
+		return nil, errors.New("cbor: item is not a map")
+	}
+	return m, nil
+}
+
+var errUnexpectedEnd = errors.New("cbor: unexpected end of data")
+
+type decoder struct {
+	data    []byte
+	offset  int
+	options DecodeOptions
+	items   int
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	d.items++
+	if d.items > d.options.MaxItems {
+		return nil, fmt.Errorf("cbor: more than %d items", d.options.MaxItems)
+	}
+	start := d.offset
+	major, argument, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if d.options.RequireCanonical && d.offset-start != headLength(argument) && major != majorSimple {
+		return nil, errors.New("cbor: argument is not encoded in the fewest bytes possible")
+	}
+	switch major {
+	case majorUnsigned:
+		return normalizeUint(argument), nil
+	case majorNegative:
+		if argument > 1<<63-1 {
+			return nil, errors.New("cbor: negative integer overflows int64")
+		}
+		return -int64(argument) - 1, nil
+	case majorBytes:
+		b, err := d.read(argument)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case majorString:
+		b, err := d.read(argument)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("cbor: text string is not valid UTF-8")
+		}
+		return string(b), nil
+	case majorArray:
+		if depth >= d.options.MaxDepth {
+			return nil, fmt.Errorf("cbor: nesting depth exceeds %d", d.options.MaxDepth)
+		}
+		// Every item is at least one byte, so the length is bounded by the remaining data.
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, errUnexpectedEnd
+		}
+		array := make([]interface{}, argument)
+		for i := range array {
+			array[i], err = d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case majorMap:
+		if depth >= d.options.MaxDepth {
+			return nil, fmt.Errorf("cbor: nesting depth exceeds %d", d.options.MaxDepth)
+		}
+		if argument > uint64(len(d.data)-d.offset)/2 {
+			return nil, errUnexpectedEnd
+		}
+		return d.decodeMap(argument, depth)
+	case majorTag:
+		return nil, errors.New("cbor: tags are not supported")
+	case majorSimple:
+		switch {
+		case argument == uint64(simpleFalse) && d.offset-start == 1:
+			return false, nil
+		case argument == uint64(simpleTrue) && d.offset-start == 1:
+			return true, nil
+		case argument == uint64(simpleNull) && d.offset-start == 1:
+			return nil, nil
+		case d.offset-start > 2:
+			return nil, errors.New("cbor: floating point numbers are not supported")
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", argument)
+	}
+	return nil, fmt.Errorf("cbor: unsupported item with major type %d", major)
+}
+
+func (d *decoder) decodeMap(length uint64, depth int) (Map, error) {
+	m := Map{}
+	var previousKey []byte
+	for i := uint64(0); i < length; i++ {
+		keyStart := d.offset
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case int64, uint64, string:
+		default:
+			return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+		}
+		encodedKey := d.data[keyStart:d.offset]
+		if d.options.RequireCanonical && previousKey != nil && !keyLess(previousKey, encodedKey) {
+			return nil, errors.New("cbor: map keys are not in canonical order")
+		}
+		previousKey = encodedKey
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+		}
+		m[key], err = d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Reads the major type and argument of the next item.
+func (d *decoder) head() (uint8, uint64, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		b, err = d.read(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(b[0]), nil
+	case info == 25:
+		b, err = d.read(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err = d.read(4)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err = d.read(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, binary.BigEndian.Uint64(b), nil
+	case info == 31:
+		return 0, 0, errors.New("cbor: indefinite length items are not supported")
+	}
+	return 0, 0, fmt.Errorf("cbor: reserved additional information %d", info)
+}
+
+func (d *decoder) read(length uint64) ([]byte, error) {
+	if length > uint64(len(d.data)-d.offset) {
+		return nil, errUnexpectedEnd
+	}
+	b := d.data[d.offset : d.offset+int(length)]
+	d.offset += int(length)
+	return b, nil
+}
+
+// Returns the number of bytes used by the canonical encoding of an item head with the argument.
+func headLength(argument uint64) int {
+	buffer := &bytes.Buffer{}
+	encodeHead(buffer, 0, argument)
+	return buffer.Len()
+}
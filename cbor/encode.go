@@ -0,0 +1,182 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Returns the canonical CBOR encoding of the value.
+// Supported values are nil, booleans, integers, strings, byte slices,
+// RawMessage, slices and maps (including Map) of supported values.
+func Marshal(value interface{}) ([]byte, error) {
+	return marshal(value, 0)
+}
+
+// The maximum nesting depth when encoding, which guards against cyclic values.
+const maxEncodeDepth = 32
+
+func marshal(value interface{}, depth int) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	err := encode(buffer, value, depth)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func encode(buffer *bytes.Buffer, value interface{}, depth int) error {
+	if depth > maxEncodeDepth {
+		return fmt.Errorf("cbor: nesting depth exceeds %d", maxEncodeDepth)
+	}
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(majorSimple<<5 | simpleNull)
+	case bool:
+		if v {
+			buffer.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			buffer.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case int:
+		encodeInt(buffer, int64(v))
+	case int8:
+		encodeInt(buffer, int64(v))
+	case int16:
+		encodeInt(buffer, int64(v))
+	case int32:
+		encodeInt(buffer, int64(v))
+	case int64:
+		encodeInt(buffer, v)
+	case uint:
+		encodeHead(buffer, majorUnsigned, uint64(v))
+	case uint8:
+		encodeHead(buffer, majorUnsigned, uint64(v))
+	case uint16:
+		encodeHead(buffer, majorUnsigned, uint64(v))
+	case uint32:
+		encodeHead(buffer, majorUnsigned, uint64(v))
+	case uint64:
+		encodeHead(buffer, majorUnsigned, v)
+	case string:
+		encodeHead(buffer, majorString, uint64(len(v)))
+		buffer.WriteString(v)
+	case []byte:
+		encodeHead(buffer, majorBytes, uint64(len(v)))
+		buffer.Write(v)
+	case RawMessage:
+		buffer.Write(v)
+	default:
+		return encodeReflect(buffer, reflect.ValueOf(value), depth)
+	}
+	return nil
+}
+
+func encodeReflect(buffer *bytes.Buffer, value reflect.Value, depth int) error {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return encode(buffer, nil, depth)
+		}
+		return encode(buffer, value.Elem().Interface(), depth)
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			return encode(buffer, data, depth)
+		}
+		encodeHead(buffer, majorArray, uint64(value.Len()))
+		for i := 0; i < value.Len(); i++ {
+			err := encode(buffer, value.Index(i).Interface(), depth+1)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		return encodeMap(buffer, value, depth)
+	}
+	return fmt.Errorf("cbor: unsupported type %s", value.Type())
+}
+
+type encodedEntry struct {
+	key   []byte
+	value []byte
+}
+
+// Encodes the map with its keys in canonical order, shorter encoded keys
+// sort first, keys with the same length are sorted by their bytes.
+func encodeMap(buffer *bytes.Buffer, value reflect.Value, depth int) error {
+	entries := make([]encodedEntry, 0, value.Len())
+	iter := value.MapRange()
+	for iter.Next() {
+		key, err := marshal(iter.Key().Interface(), depth+1)
+		if err != nil {
+			return err
+		}
+		if key[0]>>5 != majorUnsigned && key[0]>>5 != majorNegative && key[0]>>5 != majorString {
+			return fmt.Errorf("cbor: unsupported map key type %s", iter.Key().Type())
+		}
+		entry, err := marshal(iter.Value().Interface(), depth+1)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, encodedEntry{key: key, value: entry})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return keyLess(entries[i].key, entries[j].key)
+	})
+	encodeHead(buffer, majorMap, uint64(len(entries)))
+	for i, entry := range entries {
+		if i > 0 && bytes.Equal(entries[i-1].key, entry.key) {
+			return fmt.Errorf("cbor: duplicate map key % x", entry.key)
+		}
+		buffer.Write(entry.key)
+		buffer.Write(entry.value)
+	}
+	return nil
+}
+
+// Reports whether the encoded key a sorts before b in canonical order.
+func keyLess(a, b []byte) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+func encodeInt(buffer *bytes.Buffer, i int64) {
+	if i < 0 {
+		encodeHead(buffer, majorNegative, uint64(-(i + 1)))
+	} else {
+		encodeHead(buffer, majorUnsigned, uint64(i))
+	}
+}
+
+// Writes the initial byte and argument of an item in the fewest bytes possible.
+func encodeHead(buffer *bytes.Buffer, major uint8, argument uint64) {
+	header := major << 5
+	switch {
+	case argument < 24:
+		buffer.WriteByte(header | uint8(argument))
+	case argument <= 0xff:
+		buffer.Write([]byte{header | 24, uint8(argument)})
+	case argument <= 0xffff:
+		b := make([]byte, 3)
+		b[0] = header | 25
+		binary.BigEndian.PutUint16(b[1:], uint16(argument))
+		buffer.Write(b)
+	case argument <= 0xffffffff:
+		b := make([]byte, 5)
+		b[0] = header | 26
+		binary.BigEndian.PutUint32(b[1:], uint32(argument))
+		buffer.Write(b)
+	default:
+		b := make([]byte, 9)
+		b[0] = header | 27
+		binary.BigEndian.PutUint64(b[1:], argument)
+		buffer.Write(b)
+	}
+}
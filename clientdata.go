@@ -0,0 +1,116 @@
+package u2fhost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// The WebAuthn client data is defined at the following url.
+// https://www.w3.org/TR/webauthn-3/#dictionary-client-data
+
+// WebAuthn client data types
+const (
+	ClientDataTypeCreate = "webauthn.create"
+	ClientDataTypeGet    = "webauthn.get"
+)
+
+// CollectedClientData is the WebAuthn client data that is hashed and signed
+// by the authenticator.
+type CollectedClientData struct {
+	// ClientDataTypeCreate or ClientDataTypeGet.
+	Type string
+	// The raw challenge bytes provided by the relying party.
+	Challenge []byte
+	// The origin of the caller, such as https://example.com.
+	Origin string
+	// True if the caller is in an iframe with a different origin to the top level.
+	CrossOrigin bool
+	// The top level origin, only included when CrossOrigin is true.
+	TopOrigin string
+}
+
+// Returns the client data JSON, serialised in the order the WebAuthn spec
+// requires so relying parties can use limited verification:
+// type, challenge, origin, crossOrigin and then topOrigin.
+// https://www.w3.org/TR/webauthn-3/#clientdatajson-serialization
+func (c *CollectedClientData) JSON() []byte {
+	var b strings.Builder
+	b.WriteString(`{"type":`)
+	b.WriteString(ccdToString(c.Type))
+	b.WriteString(`,"challenge":`)
+	b.WriteString(ccdToString(websafeEncode(c.Challenge)))
+	b.WriteString(`,"origin":`)
+	b.WriteString(ccdToString(c.Origin))
+	if c.CrossOrigin {
+		b.WriteString(`,"crossOrigin":true`)
+		if c.TopOrigin != "" {
+			b.WriteString(`,"topOrigin":`)
+			b.WriteString(ccdToString(c.TopOrigin))
+		}
+	} else {
+		b.WriteString(`,"crossOrigin":false`)
+	}
+	b.WriteString("}")
+	return []byte(b.String())
+}
+
+// Returns the SHA-256 hash of the client data JSON, which is sent to the authenticator.
+func (c *CollectedClientData) Hash() []byte {
+	return sha256(c.JSON())
+}
+
+// Parses client data JSON, such as the clientDataJSON of a credential.
+// Members are accepted in any order.
+func ParseCollectedClientData(data []byte) (*CollectedClientData, error) {
+	var parsed struct {
+		Type        string    `json:"type"`
+		Challenge   Base64URL `json:"challenge"`
+		Origin      string    `json:"origin"`
+		CrossOrigin bool      `json:"crossOrigin"`
+		TopOrigin   string    `json:"topOrigin"`
+	}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid client data: %s", err)
+	}
+	if parsed.Type != ClientDataTypeCreate && parsed.Type != ClientDataTypeGet {
+		return nil, fmt.Errorf("Invalid client data type: %q", parsed.Type)
+	}
+	if len(parsed.Challenge) == 0 || parsed.Origin == "" {
+		return nil, errors.New("Invalid client data: missing challenge or origin")
+	}
+	return &CollectedClientData{
+		Type:        parsed.Type,
+		Challenge:   parsed.Challenge,
+		Origin:      parsed.Origin,
+		CrossOrigin: parsed.CrossOrigin,
+		TopOrigin:   parsed.TopOrigin,
+	}, nil
+}
+
+// Encodes the string as JSON using the CCDToString algorithm, which only escapes
+// quotes, backslashes and control characters.
+func ccdToString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case r == utf8.RuneError:
+			// Invalid UTF-8 is replaced, as it is when a string is converted to USVString
+			b.WriteRune(utf8.RuneError)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package u2fhost
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestCollectedClientDataJSON(t *testing.T) {
+	client := &CollectedClientData{
+		Type:      ClientDataTypeGet,
+		Challenge: []byte{0xfb, 0xff, 0x01},
+		Origin:    "https://example.com",
+	}
+	expected := `{"type":"webauthn.get","challenge":"-_8B","origin":"https://example.com","crossOrigin":false}`
+	if string(client.JSON()) != expected {
+		t.Errorf("Expected %s, but got %s", expected, client.JSON())
+	}
+	if !bytes.Equal(client.Hash(), sha256([]byte(expected))) {
+		t.Errorf("Expected the hash of the client data JSON")
+	}
+
+	// The top origin follows crossOrigin
+	client.Type = ClientDataTypeCreate
+	client.CrossOrigin = true
+	client.TopOrigin = "https://top.example"
+	expected = `{"type":"webauthn.create","challenge":"-_8B","origin":"https://example.com","crossOrigin":true,"topOrigin":"https://top.example"}`
+	if string(client.JSON()) != expected {
+		t.Errorf("Expected %s, but got %s", expected, client.JSON())
+	}
+
+	// The top origin is only included for cross origin requests
+	client.CrossOrigin = false
+	expected = `{"type":"webauthn.create","challenge":"-_8B","origin":"https://example.com","crossOrigin":false}`
+	if string(client.JSON()) != expected {
+		t.Errorf("Expected %s, but got %s", expected, client.JSON())
+	}
+}
+
+func TestCCDToString(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com": `"https://example.com"`,
+		`a"b\c`:               `"a\"b\\c"`,
+		"tab\there\x01":       `"tab\u0009here\u0001"`,
+		"<&> é":               "\"<&> é\"",
+	}
+	for input, expected := range tests {
+		encoded := ccdToString(input)
+		if encoded != expected {
+			t.Errorf("Expected %s, but got %s", expected, encoded)
+		}
+		var decoded string
+		if err := json.Unmarshal([]byte(encoded), &decoded); err != nil || decoded != input {
+			t.Errorf("Expected %s to decode to %q, but got %q %s", encoded, input, decoded, err)
+		}
+	}
+}
+
+func TestParseCollectedClientData(t *testing.T) {
+	client, err := ParseCollectedClientData([]byte(`{"origin":"https://example.com","challenge":"-_8B","type":"webauthn.get","crossOrigin":true,"topOrigin":"https://top.example","other":1}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := CollectedClientData{
+		Type:        ClientDataTypeGet,
+		Challenge:   []byte{0xfb, 0xff, 0x01},
+		Origin:      "https://example.com",
+		CrossOrigin: true,
+		TopOrigin:   "https://top.example",
+	}
+	if client.Type != expected.Type || !bytes.Equal(client.Challenge, expected.Challenge) || client.Origin != expected.Origin ||
+		client.CrossOrigin != expected.CrossOrigin || client.TopOrigin != expected.TopOrigin {
+		t.Errorf("Expected %#v, but got %#v", expected, *client)
+	}
+
+	for _, input := range []string{
+		`{"type":"navigator.id.getAssertion","challenge":"-_8B","origin":"https://example.com"}`,
+		`{"type":"webauthn.get","origin":"https://example.com"}`,
+		`not json`,
+	} {
+		if _, err = ParseCollectedClientData([]byte(input)); err == nil {
+			t.Errorf("Expected error parsing %s", input)
+		}
+	}
+}
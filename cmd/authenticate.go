@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	u2f "github.com/marshallbrekka/go-u2fhost"
@@ -14,30 +17,67 @@ var authenticateChallenge string
 var authenticateAppId string
 var authenticateFacet string
 var authenticateKeyHandle string
+var authenticateRequestFile string
+var authenticateTimeout time.Duration
+var authenticateDevices deviceFlags
+var authenticateAccount string
 
 var authenticateCmd = &cobra.Command{
 	Use:   "authenticate",
 	Short: "Authenticate with the device",
 	Run: func(cmd *cobra.Command, args []string) {
-		if authenticateChallenge == "" {
-			log.Fatalf("Must specify challenge")
+		exitOnInterrupt()
+		requests := []*u2f.AuthenticateRequest{}
+		if authenticateRequestFile != "" {
+			data := readRequestFile(authenticateRequestFile)
+			if isWebAuthnOptions(data) {
+				printJson(authenticateWebAuthn(data, authenticateFacet, authenticateDevices.devices()))
+				return
+			}
+			requests = authenticateRequestsFromJson(data)
+		}
+		if authenticateKeyHandle != "" {
+			requests = append(requests, &u2f.AuthenticateRequest{KeyHandle: authenticateKeyHandle})
 		}
-		if authenticateAppId == "" {
-			log.Fatalf("Must specify app id")
+		if authenticateAccount != "" {
+			credentials := loadCredentialStore().find(authenticateAccount, authenticateAppId)
+			if len(credentials) == 0 {
+				exitWithError(exitError, "No credentials found for account %s", authenticateAccount)
+			}
+			for _, credential := range credentials {
+				requests = append(requests, &u2f.AuthenticateRequest{AppId: credential.AppId, KeyHandle: credential.KeyHandle})
+			}
 		}
-		if authenticateFacet == "" {
-			log.Fatalf("Must specify facet")
+		if len(requests) == 0 {
+			exitWithError(exitError, "Must specify key handle")
 		}
-		if authenticateKeyHandle == "" {
-			log.Fatalf("Must specify key handle")
+		for _, request := range requests {
+			if authenticateChallenge != "" {
+				request.Challenge = authenticateChallenge
+			}
+			if authenticateAppId != "" {
+				request.AppId = authenticateAppId
+			}
+			if authenticateFacet != "" {
+				request.Facet = authenticateFacet
+			}
+			if request.Challenge == "" {
+				exitWithError(exitError, "Must specify challenge")
+			}
+			if request.AppId == "" {
+				exitWithError(exitError, "Must specify app id")
+			}
+			if request.Facet == "" {
+				exitWithError(exitError, "Must specify facet")
+			}
+			if request.KeyHandle == "" {
+				exitWithError(exitError, "Must specify key handle")
+			}
 		}
-		request := &u2f.AuthenticateRequest{
-			Challenge: authenticateChallenge,
-			AppId:     authenticateAppId,
-			Facet:     authenticateFacet,
-			KeyHandle: authenticateKeyHandle,
+		response := authenticateHelper(requests, authenticateDevices.devices(), authenticateTimeout)
+		if authenticateAccount != "" {
+			updateStoredCounter(authenticateAccount, requests, response)
 		}
-		response := authenticateHelper(request, u2f.Devices())
 		responseJson, _ := json.Marshal(response)
 		fmt.Println(string(responseJson))
 	},
@@ -49,51 +89,186 @@ func init() {
 	authenticateCmd.Flags().StringVarP(&authenticateAppId, "app-id", "a", "", "App ID to authenticate with")
 	authenticateCmd.Flags().StringVarP(&authenticateFacet, "facet", "f", "", "The facet to authenticate with")
 	authenticateCmd.Flags().StringVarP(&authenticateKeyHandle, "key-handle", "k", "", "The key handle to authenticate with")
+	authenticateCmd.Flags().StringVarP(&authenticateRequestFile, "request", "r", "", "A u2f-api.js SignRequest or WebAuthn request options JSON file, or - for stdin")
+	authenticateCmd.Flags().DurationVarP(&authenticateTimeout, "timeout", "t", 25*time.Second, "How long to wait for the user to touch a device")
+	addDeviceFlags(authenticateCmd, &authenticateDevices)
+	authenticateCmd.Flags().StringVar(&authenticateAccount, "account", "", "Authenticate with the stored credentials of this account")
 }
 
-func authenticateHelper(req *u2f.AuthenticateRequest, devices []*u2f.HidDevice) *u2f.AuthenticateResponse {
-	log.Debugf("Authenticating with request %+v", req)
-	openDevices := []u2f.Device{}
-	for i, device := range devices {
-		err := device.Open()
-		if err == nil {
-			openDevices = append(openDevices, u2f.Device(devices[i]))
-			defer func(i int) {
-				devices[i].Close()
-			}(i)
-			version, err := device.Version()
-			if err != nil {
-				log.Debugf("Device version error: %s", err.Error())
-			} else {
-				log.Debugf("Device version: %s", version)
-			}
-		}
-	}
-	if len(openDevices) == 0 {
-		log.Fatalf("Failed to find any devices")
-	}
+// Tries each request with each device until the user touches a device that
+// recognises one of the key handles, exiting early if none of them do.
+func authenticateHelper(reqs []*u2f.AuthenticateRequest, devices []*u2f.HidDevice, timeout time.Duration) *u2f.AuthenticateResponse {
+	log.Debugf("Authenticating with %d requests", len(reqs))
+	openDevices, closeDevices := openAllDevices(devices)
+	defer closeDevices()
 	prompted := false
-	timeout := time.After(time.Second * 25)
+	timedOut := time.After(timeout)
 	interval := time.NewTicker(time.Millisecond * 250)
 	defer interval.Stop()
 	for {
 		select {
-		case <-timeout:
-			fmt.Println("Failed to get authentication response after 25 seconds")
-			return nil
+		case <-timedOut:
+			exitWithError(exitTimeout, "Failed to get authentication response after %s", timeout)
 		case <-interval.C:
+			badKeyHandles := 0
 			for _, device := range openDevices {
-				response, err := device.Authenticate(req)
-				if err == nil {
-					return response
-				} else if _, ok := err.(u2f.TestOfUserPresenceRequiredError); ok && !prompted {
-					fmt.Println("\nTouch the flashing U2F device to authenticate...")
-					prompted = true
-				} else {
-					log.Debugf("Got status response %s", err)
+				for _, req := range reqs {
+					response, err := device.Authenticate(req)
+					if err == nil {
+						return response
+					}
+					switch err.(type) {
+					case *u2f.TestOfUserPresenceRequiredError:
+						if !prompted {
+							fmt.Fprintln(os.Stderr, "\nTouch the flashing U2F device to authenticate...")
+							prompted = true
+						}
+					case *u2f.BadKeyHandleError:
+						log.Debugf("Got status response %s", err)
+						badKeyHandles++
+					default:
+						exitWithDeviceError(err, "Failed to authenticate")
+					}
 				}
 			}
+			if badKeyHandles == len(openDevices)*len(reqs) {
+				exitWithError(exitBadKeyHandle, "None of the devices recognise the key handles")
+			}
+		}
+	}
+}
+
+// Signs with one of the credentials allowed by the WebAuthn request options,
+// using CTAP2 if the device supports it. With --account the stored credentials
+// of the account are also allowed, and the counter of the one used is updated.
+func authenticateWebAuthn(data []byte, facet string, devices []*u2f.HidDevice) *u2f.AuthenticationCredential {
+	options, err := u2f.ParseRequestOptions(data)
+	if err != nil {
+		exitWithError(exitError, "Invalid WebAuthn options: %s", err)
+	}
+	options.RPID, facet = webAuthnRPID(options.RPID, facet)
+	err = u2f.ValidateRPID(options.RPID, facet, nil)
+	if err != nil {
+		exitWithError(exitError, "%s", err)
+	}
+	appId := ""
+	if options.Extensions != nil {
+		appId = options.Extensions.AppID
+	}
+	var requests []*u2f.AuthenticateRequest
+	if authenticateAccount != "" {
+		store := loadCredentialStore()
+		credentials := store.find(authenticateAccount, options.RPID)
+		if appId != "" {
+			credentials = append(credentials, store.find(authenticateAccount, appId)...)
+		}
+		for _, stored := range credentials {
+			id, err := base64.RawURLEncoding.DecodeString(stored.KeyHandle)
+			if err != nil {
+				continue
+			}
+			options.AllowCredentials = append(options.AllowCredentials, u2f.PublicKeyCredentialDescriptor{Type: "public-key", ID: id})
+			requests = append(requests, &u2f.AuthenticateRequest{AppId: options.RPID, KeyHandle: stored.KeyHandle, AppIdExtension: appId})
+		}
+		if len(requests) == 0 {
+			exitWithError(exitError, "No credentials found for account %s", authenticateAccount)
+		}
+	}
+	clientData := &u2f.CollectedClientData{
+		Type:      u2f.ClientDataTypeGet,
+		Challenge: options.Challenge,
+		Origin:    facet,
+	}
+	req, err := options.GetAssertionRequest(clientData.Hash())
+	if err != nil {
+		exitWithError(exitError, "Invalid WebAuthn options: %s", err)
+	}
+
+	openDevices, closeDevices := openAllDevices(devices)
+	defer closeDevices()
+	ctx, cancel := context.WithTimeout(context.Background(), authenticateTimeout)
+	defer cancel()
+	device := selectAuthenticateDevice(ctx, openDevices)
+	if req.UserVerification && device.SupportsCTAP2() {
+		token, err := device.GetPinUvAuthToken(readPin(), u2f.PermissionGetAssertion, options.RPID)
+		if err != nil {
+			exitWithDeviceError(err, "Failed to get PIN token")
+		}
+		req.PinUvAuthToken = token
+	}
+	promptOnTouch(device, "\nTouch the flashing device to authenticate...")
+	cancelOnTimeout(ctx, device)
+	response, err := authenticatorUntil(ctx, device).GetAssertion(req)
+	if ctx.Err() == context.DeadlineExceeded {
+		exitWithError(exitTimeout, "Failed to get authentication response after %s", authenticateTimeout)
+	} else if err != nil {
+		exitWithDeviceError(err, "Failed to authenticate")
+	}
+	credential := u2f.NewAuthenticationCredential(clientData.JSON(), options, response)
+	if authenticateAccount != "" {
+		updateStoredCounter(authenticateAccount, requests, authenticateResponseFromCredential(credential))
+	}
+	return credential
+}
+
+// Returns the WebAuthn credential as the AuthenticateResponse that a WebAuthn
+// mode AuthenticateRequest returns, so it can be verified the same way.
+func authenticateResponseFromCredential(credential *u2f.AuthenticationCredential) *u2f.AuthenticateResponse {
+	response := &u2f.AuthenticateResponse{
+		KeyHandle:         credential.ID,
+		ClientData:        base64.RawURLEncoding.EncodeToString(credential.Response.ClientDataJSON),
+		SignatureData:     base64.StdEncoding.EncodeToString(credential.Response.Signature),
+		AuthenticatorData: base64.StdEncoding.EncodeToString(credential.Response.AuthenticatorData),
+	}
+	if appId := credential.ClientExtensionResults.AppID; appId != nil {
+		response.AppIdExtensionUsed = *appId
+	}
+	return response
+}
+
+// Asks the user to touch the device to authenticate with if there is more than
+// one, exiting if the context is done first.
+func selectAuthenticateDevice(ctx context.Context, devices []*u2f.HidDevice) *u2f.HidDevice {
+	if len(devices) == 1 {
+		return devices[0]
+	}
+	fmt.Fprintln(os.Stderr, "\nTouch the device you wish to authenticate with...")
+	selected, err := u2f.SelectDevice(ctx, devices)
+	if err == context.DeadlineExceeded {
+		exitWithError(exitTimeout, "Failed to get authentication response after %s", authenticateTimeout)
+	} else if err != nil {
+		exitWithDeviceError(err, "Failed to select a device")
+	}
+	return selected
+}
+
+// Verifies the response with the stored public key and records the new counter,
+// warning if it did not increase as that can mean the key was cloned.
+func updateStoredCounter(account string, requests []*u2f.AuthenticateRequest, response *u2f.AuthenticateResponse) {
+	store := loadCredentialStore()
+	for _, req := range requests {
+		if req.KeyHandle != response.KeyHandle {
+			continue
+		}
+		appId := req.AppId
+		if response.AppIdExtensionUsed {
+			appId = req.AppIdExtension
+		}
+		for _, credential := range store.find(account, appId) {
+			if credential.KeyHandle != response.KeyHandle {
+				continue
+			}
+			authData, err := u2f.VerifyAuthenticateResponse(response, appId, credential.PublicKey)
+			if err != nil {
+				log.Warnf("The response does not match the stored credential: %s", err)
+				return
+			}
+			if authData.SignCount <= credential.Counter && authData.SignCount != 0 {
+				log.Warnf("The counter %d did not increase from %d, the key may be cloned", authData.SignCount, credential.Counter)
+			}
+			credential.Counter = authData.SignCount
+			store.save()
+			return
 		}
 	}
-	return nil
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var bioSerial string
+var bioName string
+var bioTimeout time.Duration
+
+// A fingerprint enrollment, the template id is base64 encoded.
+type bioEnrollmentOutput struct {
+	TemplateId   string `json:"templateId"`
+	FriendlyName string `json:"friendlyName,omitempty"`
+}
+
+var bioCmd = &cobra.Command{
+	Use:   "bio",
+	Short: "Manage the fingerprints enrolled on a biometric device.",
+}
+
+var bioInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the fingerprint sensor information.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		device := openBioDevice()
+		defer device.Close()
+		info, err := device.GetFingerprintSensorInfo()
+		if err != nil {
+			exitWithDeviceError(err, "Failed to get sensor info")
+		}
+		printJson(info)
+	},
+}
+
+var bioEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Enroll a new fingerprint.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		device := openBioDevice()
+		defer device.Close()
+		token := bioToken(device)
+		fmt.Fprintln(os.Stderr, "\nTouch the sensor to start the enrollment...")
+		templateId, err := device.EnrollFingerprint(token, bioTimeout, func(sample u2f.BioEnrollmentSample) {
+			if sample.RemainingSamples > 0 {
+				fmt.Fprintf(os.Stderr, "%s, touch the sensor again... %d samples remaining\n", sample.Status, sample.RemainingSamples)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s, enrollment complete.\n", sample.Status)
+			}
+		})
+		switch err.(type) {
+		case nil:
+		case *u2f.UserActionTimeoutError:
+			exitWithError(exitTimeout, "Timed out waiting for the sensor to be touched, the fingerprint was not enrolled")
+		default:
+			exitWithDeviceError(err, "Failed to enroll fingerprint")
+		}
+		if bioName != "" {
+			err = device.SetEnrollmentFriendlyName(token, templateId, bioName)
+			if err != nil {
+				exitWithDeviceError(err, "Failed to name the fingerprint")
+			}
+		}
+		printJson(bioEnrollmentOutput{
+			TemplateId:   base64.RawURLEncoding.EncodeToString(templateId),
+			FriendlyName: bioName,
+		})
+	},
+}
+
+var bioListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the enrolled fingerprints.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		device := openBioDevice()
+		defer device.Close()
+		enrollments, err := device.EnumerateEnrollments(bioToken(device))
+		if err != nil {
+			exitWithDeviceError(err, "Failed to list fingerprints")
+		}
+		output := []bioEnrollmentOutput{}
+		for _, enrollment := range enrollments {
+			output = append(output, bioEnrollmentOutput{
+				TemplateId:   base64.RawURLEncoding.EncodeToString(enrollment.TemplateId),
+				FriendlyName: enrollment.FriendlyName,
+			})
+		}
+		printJson(output)
+	},
+}
+
+var bioRenameCmd = &cobra.Command{
+	Use:   "rename TEMPLATE_ID NAME",
+	Short: "Set the friendly name of an enrolled fingerprint.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		templateId := decodeFlag("template id", args[0])
+		device := openBioDevice()
+		defer device.Close()
+		err := device.SetEnrollmentFriendlyName(bioToken(device), templateId, args[1])
+		if err != nil {
+			exitWithDeviceError(err, "Failed to rename fingerprint")
+		}
+		fmt.Fprintln(os.Stderr, "Fingerprint was renamed.")
+	},
+}
+
+var bioRemoveCmd = &cobra.Command{
+	Use:   "remove TEMPLATE_ID",
+	Short: "Remove an enrolled fingerprint.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		templateId := decodeFlag("template id", args[0])
+		device := openBioDevice()
+		defer device.Close()
+		err := device.RemoveEnrollment(bioToken(device), templateId)
+		if err != nil {
+			exitWithDeviceError(err, "Failed to remove fingerprint")
+		}
+		fmt.Fprintln(os.Stderr, "Fingerprint was removed.")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(bioCmd)
+	bioCmd.AddCommand(bioInfoCmd, bioEnrollCmd, bioListCmd, bioRenameCmd, bioRemoveCmd)
+	bioCmd.PersistentFlags().StringVarP(&bioSerial, "serial", "s", "", "The serial number of the device to use, required if more than one device is attached")
+	bioEnrollCmd.Flags().StringVarP(&bioName, "name", "n", "", "The friendly name of the new fingerprint")
+	bioEnrollCmd.Flags().DurationVar(&bioTimeout, "timeout", 0, "How long to wait for each sample, defaults to the device timeout")
+}
+
+// Opens the device, checking that it supports biometric enrollment.
+func openBioDevice() *u2f.HidDevice {
+	device := findDevice(u2f.Devices(), bioSerial)
+	err := device.Open()
+	if err != nil {
+		exitWithDeviceError(err, "Failed to open device")
+	}
+	_, err = device.GetBioModality()
+	if err != nil {
+		device.Close()
+		exitWithError(exitDeviceError, "Device does not support biometric enrollment: %s", err)
+	}
+	return device
+}
+
+// Prompts for the PIN and returns a token with the bio enrollment permission.
+func bioToken(device *u2f.HidDevice) *u2f.PinUvAuthToken {
+	token, err := device.GetPinUvAuthToken(readPin(), u2f.PermissionBioEnrollment, "")
+	switch err.(type) {
+	case nil:
+		return token
+	case *u2f.PinInvalidError:
+		exitWithError(exitError, "Incorrect PIN")
+	case *u2f.PinNotSetError:
+		exitWithError(exitDeviceError, "The device PIN must be set before enrolling fingerprints")
+	default:
+		exitWithDeviceError(err, "Failed to get PIN token")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var configSerial string
+var configRPIDs []string
+var configForceChangePin bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Configure CTAP2.1 authenticator features.",
+}
+
+var configEnterpriseAttestationCmd = &cobra.Command{
+	Use:   "enterprise-attestation",
+	Short: "Enable enterprise attestation.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		device := openConfigDevice()
+		defer device.Close()
+		err := device.EnableEnterpriseAttestation(configToken(device))
+		if err != nil {
+			exitWithDeviceError(err, "Failed to enable enterprise attestation")
+		}
+		fmt.Println("Enterprise attestation was enabled.")
+	},
+}
+
+var configAlwaysUvCmd = &cobra.Command{
+	Use:   "always-uv",
+	Short: "Toggle whether user verification is required for every operation.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		device := openConfigDevice()
+		defer device.Close()
+		enabled, err := device.ToggleAlwaysUv(configToken(device))
+		if err != nil {
+			exitWithDeviceError(err, "Failed to toggle alwaysUv")
+		}
+		if enabled {
+			fmt.Println("alwaysUv is now enabled.")
+		} else {
+			fmt.Println("alwaysUv is now disabled.")
+		}
+	},
+}
+
+var configMinPINLengthCmd = &cobra.Command{
+	Use:   "min-pin-length [LENGTH]",
+	Short: "Increase the minimum PIN length and set the RP IDs allowed to read it.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		options := u2f.MinPINLengthOptions{
+			RPIDs:          configRPIDs,
+			ForceChangePin: configForceChangePin,
+		}
+		if len(args) == 1 {
+			length, err := strconv.Atoi(args[0])
+			if err != nil || length <= 0 {
+				exitWithError(exitError, "Invalid PIN length: %s", args[0])
+			}
+			options.Length = length
+		}
+		device := openConfigDevice()
+		defer device.Close()
+		err := device.SetMinPINLength(configToken(device), options)
+		switch err.(type) {
+		case nil:
+			fmt.Println("Minimum PIN length was updated.")
+		case *u2f.PinPolicyViolationError:
+			exitWithError(exitError, "The minimum PIN length can only be increased")
+		default:
+			exitWithDeviceError(err, "Failed to set minimum PIN length")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configEnterpriseAttestationCmd, configAlwaysUvCmd, configMinPINLengthCmd)
+	configCmd.PersistentFlags().StringVarP(&configSerial, "serial", "s", "", "The serial number of the device to use, required if more than one device is attached")
+	configMinPINLengthCmd.Flags().StringSliceVarP(&configRPIDs, "rp-id", "r", nil, "An RP ID allowed to read the minimum PIN length, may be repeated")
+	configMinPINLengthCmd.Flags().BoolVar(&configForceChangePin, "force-change-pin", false, "Require the PIN to be changed before the device can be used again")
+}
+
+// Opens the device, checking that it supports authenticator config.
+func openConfigDevice() *u2f.HidDevice {
+	device := findDevice(u2f.Devices(), configSerial)
+	err := device.Open()
+	if err != nil {
+		exitWithDeviceError(err, "Failed to open device")
+	}
+	info, err := device.GetInfo()
+	if err != nil {
+		device.Close()
+		exitWithError(exitDeviceError, "Failed to get device info, the device may not support CTAP2: %s", err)
+	}
+	if supported, _ := info.Option("authnrCfg"); !supported {
+		device.Close()
+		exitWithError(exitDeviceError, "Device does not support authenticator config")
+	}
+	return device
+}
+
+// Prompts for the PIN and returns a token with the authenticator config permission,
+// or nil if the device does not have a PIN set.
+func configToken(device *u2f.HidDevice) *u2f.PinUvAuthToken {
+	info, err := device.GetInfo()
+	if err != nil {
+		exitWithDeviceError(err, "Failed to get device info")
+	}
+	if _, pinSet := info.Option("clientPin"); !pinSet {
+		return nil
+	}
+	token, err := device.GetPinUvAuthToken(readPin(), u2f.PermissionAuthenticatorConfig, "")
+	switch err.(type) {
+	case nil:
+		return token
+	case *u2f.PinInvalidError:
+		exitWithError(exitError, "Incorrect PIN")
+	default:
+		exitWithDeviceError(err, "Failed to get PIN token")
+	}
+	return nil
+}
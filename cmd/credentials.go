@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var credentialStorePath string
+var credentialsAccount string
+var credentialsKeyHandle string
+var credentialsJson bool
+
+// A credential recorded at registration, so it can be used again by account name.
+type storedCredential struct {
+	Account   string `json:"account"`
+	AppId     string `json:"appId"`
+	KeyHandle string `json:"keyHandle"`
+	// The COSE_Key encoded public key.
+	PublicKey  []byte    `json:"publicKey"`
+	Counter    uint32    `json:"counter"`
+	Serial     string    `json:"serial,omitempty"`
+	Registered time.Time `json:"registered"`
+}
+
+// The credentials saved in the store file.
+type credentialStore struct {
+	Credentials []*storedCredential `json:"credentials"`
+}
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage the credentials recorded with register --account.",
+}
+
+var credentialsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stored credentials.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store := loadCredentialStore()
+		credentials := store.find(credentialsAccount, "")
+		if credentialsJson {
+			printJson(credentials)
+			return
+		}
+		if len(credentials) == 0 {
+			fmt.Println("No credentials found")
+			return
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "ACCOUNT\tAPP ID\tKEY HANDLE\tCOUNTER\tSERIAL\tREGISTERED")
+		for _, credential := range credentials {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				credential.Account,
+				credential.AppId,
+				credential.KeyHandle,
+				credential.Counter,
+				orDash(credential.Serial),
+				credential.Registered.Format(time.RFC3339),
+			)
+		}
+		writer.Flush()
+	},
+}
+
+var credentialsRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Remove the stored credentials of an account.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if credentialsAccount == "" {
+			exitWithError(exitError, "Must specify account")
+		}
+		store := loadCredentialStore()
+		removed := store.remove(credentialsAccount, credentialsKeyHandle)
+		if removed == 0 {
+			exitWithError(exitError, "No credentials found for account %s", credentialsAccount)
+		}
+		store.save()
+		fmt.Printf("Removed %d credentials.\n", removed)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(credentialsCmd)
+	credentialsCmd.AddCommand(credentialsListCmd, credentialsRemoveCmd)
+	RootCmd.PersistentFlags().StringVar(&credentialStorePath, "credential-store", "", "The credential store file, defaults to u2fhost/credentials.json in the user config directory")
+	credentialsCmd.PersistentFlags().StringVar(&credentialsAccount, "account", "", "Only the credentials of the account")
+	credentialsListCmd.Flags().BoolVar(&credentialsJson, "json", false, "Print the credentials as JSON instead of a table")
+	credentialsRemoveCmd.Flags().StringVarP(&credentialsKeyHandle, "key-handle", "k", "", "Only remove the credential with the key handle")
+}
+
+// Returns the path of the credential store, which is under $XDG_CONFIG_HOME on Linux.
+func credentialStoreFile() string {
+	if credentialStorePath != "" {
+		return credentialStorePath
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		exitWithError(exitError, "Failed to find the credential store, specify one with --credential-store: %s", err)
+	}
+	return filepath.Join(configDir, "u2fhost", "credentials.json")
+}
+
+// Loads the credential store, which is empty if the file does not exist yet.
+func loadCredentialStore() *credentialStore {
+	store := &credentialStore{}
+	path := credentialStoreFile()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store
+	} else if err != nil {
+		exitWithError(exitError, "Failed to read the credential store: %s", err)
+	}
+	err = json.Unmarshal(data, store)
+	if err != nil {
+		exitWithError(exitError, "Invalid credential store %s: %s", path, err)
+	}
+	return store
+}
+
+func (s *credentialStore) save() {
+	data, _ := json.MarshalIndent(s, "", "  ")
+	path := credentialStoreFile()
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err == nil {
+		err = writeFileAtomic(path, data, 0600)
+	}
+	if err != nil {
+		exitWithError(exitError, "Failed to save the credential store: %s", err)
+	}
+}
+
+// Returns the credentials of the account, or all accounts if it is empty,
+// optionally only those for the AppID.
+func (s *credentialStore) find(account, appId string) []*storedCredential {
+	credentials := []*storedCredential{}
+	for _, credential := range s.Credentials {
+		if (account == "" || credential.Account == account) && (appId == "" || credential.AppId == appId) {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials
+}
+
+// Adds the credential, replacing any with the same AppID and key handle.
+func (s *credentialStore) add(credential *storedCredential) {
+	for i, existing := range s.Credentials {
+		if existing.AppId == credential.AppId && existing.KeyHandle == credential.KeyHandle {
+			s.Credentials[i] = credential
+			return
+		}
+	}
+	s.Credentials = append(s.Credentials, credential)
+}
+
+// Removes the credentials of the account, or only the one with the key handle
+// if it is set, returning how many were removed.
+func (s *credentialStore) remove(account, keyHandle string) int {
+	kept := []*storedCredential{}
+	for _, credential := range s.Credentials {
+		if credential.Account != account || keyHandle != "" && credential.KeyHandle != keyHandle {
+			kept = append(kept, credential)
+		}
+	}
+	removed := len(s.Credentials) - len(kept)
+	s.Credentials = kept
+	return removed
+}
+
+// Records a new credential for the account in the store.
+func storeCredential(account, appId string, authData *u2f.AuthenticatorData, device *u2f.HidDevice) {
+	store := loadCredentialStore()
+	store.add(&storedCredential{
+		Account:    account,
+		AppId:      appId,
+		KeyHandle:  base64.RawURLEncoding.EncodeToString(authData.CredentialID),
+		PublicKey:  authData.CredentialPublicKey,
+		Counter:    authData.SignCount,
+		Serial:     device.Info().Serial,
+		Registered: time.Now().UTC(),
+	})
+	store.save()
+}
+
+// Writes the data to a temporary file and renames it over the file, so the
+// file is never left half written.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// The flags that choose which of the attached devices to use.
+type deviceFlags struct {
+	path   string
+	serial string
+	vid    string
+	pid    string
+	choose bool
+}
+
+func addDeviceFlags(cmd *cobra.Command, flags *deviceFlags) {
+	cmd.Flags().StringVarP(&flags.path, "device", "d", "", "The path of the device to use")
+	cmd.Flags().StringVarP(&flags.serial, "serial", "s", "", "The serial number of the device to use")
+	cmd.Flags().StringVar(&flags.vid, "vid", "", "The vendor id of the devices to use, in hex")
+	cmd.Flags().StringVar(&flags.pid, "pid", "", "The product id of the devices to use, in hex")
+	cmd.Flags().BoolVar(&flags.choose, "choose", false, "Flash each device in turn and ask which one to use")
+}
+
+// Returns the attached devices that match the flags, asking the user to pick one if --choose is set.
+func (flags *deviceFlags) devices() []*u2f.HidDevice {
+	devices := u2f.FilterDevices(u2f.Devices(), flags.filter())
+	if len(devices) == 0 {
+		exitWithError(exitNoDevice, "Failed to find any devices")
+	}
+	if flags.choose {
+		return []*u2f.HidDevice{chooseDevice(devices)}
+	}
+	return devices
+}
+
+// Returns the filter matching the --device, --serial, --vid and --pid flags.
+func (flags *deviceFlags) filter() u2f.DeviceFilter {
+	return u2f.DeviceFilter{
+		Path:      flags.path,
+		Serial:    flags.serial,
+		VendorId:  parseUsbId("vid", flags.vid),
+		ProductId: parseUsbId("pid", flags.pid),
+	}
+}
+
+// Parses a USB vendor or product id in hex, with an optional 0x prefix.
+func parseUsbId(name, value string) uint16 {
+	if value == "" {
+		return 0
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(value), "0x"), 16, 16)
+	if err != nil {
+		exitWithError(exitError, "Invalid --%s %s, must be a hex number such as 1050", name, value)
+	}
+	return uint16(id)
+}
+
+// Flashes each device in turn and asks the user whether it is the one to use.
+func chooseDevice(devices []*u2f.HidDevice) *u2f.HidDevice {
+	reader := bufio.NewReader(os.Stdin)
+	for i, device := range devices {
+		info := device.Info()
+		fmt.Fprintf(os.Stderr, "\n[%d/%d] %s %s (serial %s, path %s)\n", i+1, len(devices), info.Manufacturer, info.Product, info.Serial, info.Path)
+		err := device.Open()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open the device: %s\n", err)
+			continue
+		}
+		err = device.Wink()
+		device.Close()
+		if err != nil {
+			log.Debugf("Failed to wink device: %s", err)
+			fmt.Fprint(os.Stderr, "Use this device? [y/N] ")
+		} else {
+			fmt.Fprint(os.Stderr, "Use the flashing device? [y/N] ")
+		}
+		answer, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) == "y" {
+			return device
+		}
+	}
+	exitWithError(exitUserCancelled, "No device was chosen")
+	return nil
+}
+
+// Returns the single device to use, optionally matching the serial number.
+func findDevice(devices []*u2f.HidDevice, serial string) *u2f.HidDevice {
+	candidates := u2f.FilterDevices(devices, u2f.DeviceFilter{Serial: serial})
+	if len(candidates) == 0 {
+		exitWithError(exitNoDevice, "Failed to find any devices")
+	}
+	if len(candidates) > 1 {
+		serials := []string{}
+		for _, device := range candidates {
+			serials = append(serials, device.Info().Serial)
+		}
+		exitWithError(exitError, "Found more than one device, specify one with --serial: %s", strings.Join(serials, ", "))
+	}
+	return candidates[0]
+}
+
+// Opens the devices that can be opened, returning them and a function to close them.
+func openAllDevices(devices []*u2f.HidDevice) ([]*u2f.HidDevice, func()) {
+	openDevices := []*u2f.HidDevice{}
+	for _, device := range devices {
+		err := device.Open()
+		if err != nil {
+			log.Debugf("Failed to open device %s: %s", device.Info().Path, err)
+			continue
+		}
+		openDevices = append(openDevices, device)
+		version, err := device.Version()
+		if err != nil {
+			log.Debugf("Device version error: %s", err)
+		} else {
+			log.Debugf("Device version: %s", version)
+		}
+	}
+	if len(openDevices) == 0 {
+		exitWithError(exitNoDevice, "Failed to find any devices")
+	}
+	return openDevices, func() {
+		for _, device := range openDevices {
+			device.Close()
+		}
+	}
+}
+
+// Cancels the CTAP2 request in progress on the device if the context times out.
+func cancelOnTimeout(ctx context.Context, device *u2f.HidDevice) {
+	if !device.SupportsCTAP2() {
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		if ctx.Err() == context.DeadlineExceeded {
+			device.Cancel()
+		}
+	}()
+}
+
+// Returns the Authenticator for the device, with U2F requests waiting until the
+// context's deadline for the user to touch it.
+func authenticatorUntil(ctx context.Context, device *u2f.HidDevice) u2f.Authenticator {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return u2f.NewAuthenticator(device)
+	}
+	return u2f.NewAuthenticatorWithTimeout(device, time.Until(deadline))
+}
+
+// Prints the message each time the device starts waiting for the user to touch it.
+func promptOnTouch(device *u2f.HidDevice, message string) {
+	waiting := false
+	device.OnKeepAlive(func(status u2f.KeepAliveStatus) {
+		if status == u2f.KeepAliveUserPresenceNeeded && !waiting {
+			fmt.Fprintln(os.Stderr, message)
+		}
+		waiting = status == u2f.KeepAliveUserPresenceNeeded
+	})
+}
+
+// Prompts for the device PIN on the terminal without echoing it. The terminal is
+// opened directly when stdin is redirected, and the PIN is only read from stdin
+// when there is no terminal.
+func readPin() string {
+	fmt.Fprint(os.Stderr, "Enter the device PIN: ")
+	input := os.Stdin
+	if !term.IsTerminal(int(input.Fd())) {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			defer tty.Close()
+			input = tty
+		}
+	}
+	var pin string
+	if fd := int(input.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			exitWithError(exitError, "Failed to read PIN: %s", err)
+		}
+		pin = string(password)
+	} else if stdinRequest {
+		exitWithError(exitError, "Can not read the PIN from stdin after the request, pass the request in a file")
+	} else {
+		pin, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+		pin = strings.TrimRight(pin, "\r\n")
+	}
+	if pin == "" {
+		exitWithError(exitError, "Must enter a PIN")
+	}
+	return pin
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/marshallbrekka/go-u2fhost/hid"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var devicesJson bool
+
+// What was found for an attached device, the error is set if it failed to open.
+type deviceOutput struct {
+	Path         string                 `json:"path"`
+	VendorId     uint16                 `json:"vendorId"`
+	ProductId    uint16                 `json:"productId"`
+	Manufacturer string                 `json:"manufacturer,omitempty"`
+	Product      string                 `json:"product,omitempty"`
+	Serial       string                 `json:"serial,omitempty"`
+	Version      string                 `json:"version,omitempty"`
+	Capabilities []string               `json:"capabilities"`
+	Info         *u2f.AuthenticatorInfo `json:"info,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// The names of the U2FHID capability flags.
+var capabilityNames = []struct {
+	flag uint8
+	name string
+}{
+	{hid.CAPABILITY_WINK, "wink"},
+	{hid.CAPABILITY_CBOR, "cbor"},
+	{hid.CAPABILITY_NMSG, "nmsg"},
+}
+
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "List the attached devices and what they support.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputs := []deviceOutput{}
+		for _, device := range u2f.Devices() {
+			outputs = append(outputs, describeDevice(device))
+		}
+		if devicesJson {
+			printJson(outputs)
+			return
+		}
+		if len(outputs) == 0 {
+			fmt.Println("No devices found")
+			return
+		}
+		printDevicesTable(outputs)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(devicesCmd)
+	devicesCmd.Flags().BoolVar(&devicesJson, "json", false, "Print the devices as JSON instead of a table")
+}
+
+// Opens the device to read its U2F version, capabilities and CTAP2 info.
+func describeDevice(device *u2f.HidDevice) deviceOutput {
+	info := device.Info()
+	output := deviceOutput{
+		Path:         info.Path,
+		VendorId:     info.VendorId,
+		ProductId:    info.ProductId,
+		Manufacturer: info.Manufacturer,
+		Product:      info.Product,
+		Serial:       info.Serial,
+		Capabilities: []string{},
+	}
+	err := device.Open()
+	if err != nil {
+		output.Error = err.Error()
+		return output
+	}
+	defer device.Close()
+	for _, capability := range capabilityNames {
+		if device.Capabilities()&capability.flag != 0 {
+			output.Capabilities = append(output.Capabilities, capability.name)
+		}
+	}
+	// CTAP2 only devices may not respond to U2F messages
+	if device.Capabilities()&hid.CAPABILITY_NMSG == 0 {
+		output.Version, err = device.Version()
+		if err != nil {
+			log.Debugf("Device version error: %s", err)
+		}
+	}
+	if device.SupportsCTAP2() {
+		output.Info, err = device.GetInfo()
+		if err != nil {
+			log.Debugf("Device info error: %s", err)
+		}
+	}
+	return output
+}
+
+func printDevicesTable(outputs []deviceOutput) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "PATH\tVID:PID\tPRODUCT\tSERIAL\tVERSION\tCAPABILITIES\tCTAP2\tAAGUID\tSTATUS")
+	for _, output := range outputs {
+		versions, aaguid := "-", "-"
+		if output.Info != nil {
+			versions = strings.Join(output.Info.Versions, ",")
+			aaguid = hex.EncodeToString(output.Info.AAGUID)
+		}
+		status := "ok"
+		if output.Error != "" {
+			status = "failed to open: " + output.Error
+		}
+		fmt.Fprintf(writer, "%s\t%04x:%04x\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			output.Path,
+			output.VendorId,
+			output.ProductId,
+			orDash(strings.TrimSpace(output.Manufacturer+" "+output.Product)),
+			orDash(output.Serial),
+			orDash(output.Version),
+			orDash(strings.Join(output.Capabilities, ",")),
+			versions,
+			aaguid,
+			status,
+		)
+	}
+	writer.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	log "github.com/sirupsen/logrus"
+)
+
+// The exit status of each kind of failure, so wrapper scripts can tell them apart.
+const (
+	exitError         = 1
+	exitNoDevice      = 2
+	exitTimeout       = 3
+	exitBadKeyHandle  = 4
+	exitUserCancelled = 5
+	exitDeviceError   = 6
+)
+
+// The names of the exit statuses used in the JSON errors.
+var exitCodeNames = map[int]string{
+	exitError:         "error",
+	exitNoDevice:      "no-device",
+	exitTimeout:       "timeout",
+	exitBadKeyHandle:  "bad-key-handle",
+	exitUserCancelled: "user-cancelled",
+	exitDeviceError:   "device-error",
+}
+
+// The error written to stderr in --json-errors mode.
+type jsonError struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message"`
+}
+
+// Reports the error and exits with the code, writing it as JSON to stderr
+// in --json-errors mode.
+func exitWithError(code int, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if JsonErrors {
+		errorJson, _ := json.Marshal(jsonError{
+			Error:    exitCodeNames[code],
+			ExitCode: code,
+			Message:  message,
+		})
+		fmt.Fprintln(os.Stderr, string(errorJson))
+	} else {
+		log.Error(message)
+	}
+	os.Exit(code)
+}
+
+// Returns the exit code for an error returned by the device.
+func exitCodeForError(err error) int {
+	switch err.(type) {
+	case *u2f.BadKeyHandleError, *u2f.NoCredentialsError:
+		return exitBadKeyHandle
+	case *u2f.UserActionTimeoutError:
+		return exitTimeout
+	case *u2f.OperationDeniedError, *u2f.KeepAliveCancelError, *u2f.NotAllowedError:
+		return exitUserCancelled
+	case *u2f.InvalidAppIdError, *u2f.InvalidRPIDError:
+		return exitError
+	}
+	return exitDeviceError
+}
+
+// Exits with the code for the device error, prefixing the message.
+func exitWithDeviceError(err error, message string) {
+	exitWithError(exitCodeForError(err), "%s: %s", message, err)
+}
+
+// Exits with the user cancelled code when the user interrupts the command.
+func exitOnInterrupt() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		exitWithError(exitUserCancelled, "Cancelled by the user")
+	}()
+}
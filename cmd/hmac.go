@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var hmacRPID string
+var hmacSerial string
+var hmacCredentialId string
+var hmacSalt string
+var hmacSalt2 string
+
+// The secrets derived with the hmac-secret extension, base64 encoded.
+type hmacOutput struct {
+	CredentialId string `json:"credentialId"`
+	Output1      string `json:"output1,omitempty"`
+	Output2      string `json:"output2,omitempty"`
+}
+
+var hmacCmd = &cobra.Command{
+	Use:   "hmac",
+	Short: "Derive a secret from a credential and salt with the hmac-secret extension.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if hmacRPID == "" {
+			exitWithError(exitError, "Must specify rp id")
+		}
+		if hmacCredentialId == "" {
+			exitWithError(exitError, "Must specify credential id")
+		}
+		if hmacSalt == "" {
+			exitWithError(exitError, "Must specify salt")
+		}
+		credentialId := decodeFlag("credential id", hmacCredentialId)
+		input := &u2f.HmacSecretInput{Salt1: decodeFlag("salt", hmacSalt)}
+		if hmacSalt2 != "" {
+			input.Salt2 = decodeFlag("salt2", hmacSalt2)
+		}
+		device := openHmacDevice()
+		defer device.Close()
+		promptOnTouch(device, "\nTouch the flashing device to derive the secret...")
+		response, err := device.GetAssertion(&u2f.GetAssertionRequest{
+			RPID:           hmacRPID,
+			ClientDataHash: randomBytes(32),
+			AllowList:      [][]byte{credentialId},
+			Extensions:     u2f.GetAssertionExtensions{HmacSecret: input},
+		})
+		if err != nil {
+			exitWithDeviceError(err, "Failed to derive secret")
+		}
+		printJson(hmacOutput{
+			CredentialId: hmacCredentialId,
+			Output1:      base64.RawURLEncoding.EncodeToString(response.Extensions.HmacSecret.Output1),
+			Output2:      base64.RawURLEncoding.EncodeToString(response.Extensions.HmacSecret.Output2),
+		})
+	},
+}
+
+var hmacCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new credential with the hmac-secret extension enabled.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if hmacRPID == "" {
+			exitWithError(exitError, "Must specify rp id")
+		}
+		device := openHmacDevice()
+		defer device.Close()
+		promptOnTouch(device, "\nTouch the flashing device to create the credential...")
+		response, err := device.MakeCredential(&u2f.MakeCredentialRequest{
+			ClientDataHash: randomBytes(32),
+			RelyingParty:   u2f.RelyingPartyEntity{ID: hmacRPID},
+			User:           u2f.UserEntity{ID: randomBytes(32), Name: "u2fhost"},
+			Extensions:     u2f.MakeCredentialExtensions{HmacSecret: true},
+		})
+		if err != nil {
+			exitWithDeviceError(err, "Failed to create credential")
+		}
+		if !response.Extensions.HmacSecret {
+			exitWithError(exitDeviceError, "Device did not enable hmac-secret for the credential")
+		}
+		printJson(hmacOutput{
+			CredentialId: base64.RawURLEncoding.EncodeToString(response.AuthenticatorData.CredentialID),
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(hmacCmd)
+	hmacCmd.AddCommand(hmacCreateCmd)
+	hmacCmd.PersistentFlags().StringVarP(&hmacRPID, "rp-id", "r", "", "The RP ID the credential is scoped to")
+	hmacCmd.PersistentFlags().StringVarP(&hmacSerial, "serial", "s", "", "The serial number of the device to use, required if more than one device is attached")
+	hmacCmd.Flags().StringVarP(&hmacCredentialId, "credential-id", "k", "", "The base64 encoded credential id created with hmac create")
+	hmacCmd.Flags().StringVar(&hmacSalt, "salt", "", "The base64 encoded 32 byte salt")
+	hmacCmd.Flags().StringVar(&hmacSalt2, "salt2", "", "An optional second base64 encoded 32 byte salt")
+}
+
+// Opens the device, checking that it supports the hmac-secret extension.
+func openHmacDevice() *u2f.HidDevice {
+	device := findDevice(u2f.Devices(), hmacSerial)
+	err := device.Open()
+	if err != nil {
+		exitWithDeviceError(err, "Failed to open device")
+	}
+	info, err := device.GetInfo()
+	if err != nil {
+		device.Close()
+		exitWithError(exitDeviceError, "Failed to get device info, the device may not support CTAP2: %s", err)
+	}
+	if !info.HasExtension("hmac-secret") {
+		device.Close()
+		exitWithError(exitDeviceError, "Device does not support the hmac-secret extension")
+	}
+	return device
+}
+
+func decodeFlag(name, value string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		exitWithError(exitError, "Invalid base64 %s: %s", name, err)
+	}
+	return decoded
+}
+
+func randomBytes(length int) []byte {
+	b := make([]byte, length)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		exitWithError(exitError, "Failed to generate random bytes: %s", err)
+	}
+	return b
+}
+
+func printJson(value interface{}) {
+	valueJson, _ := json.Marshal(value)
+	fmt.Println(string(valueJson))
+}
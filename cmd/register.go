@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	u2f "github.com/marshallbrekka/go-u2fhost"
@@ -13,26 +15,63 @@ import (
 var registerChallenge string
 var registerAppId string
 var registerFacet string
+var registerRequestFile string
+var registerTimeout time.Duration
+var registerDevices deviceFlags
+var registerAccount string
 
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register the U2F device.",
 	Run: func(cmd *cobra.Command, args []string) {
-		if registerChallenge == "" {
-			log.Fatalf("Must specify challenge")
+		request := &u2f.RegisterRequest{}
+		excluded := []*u2f.AuthenticateRequest{}
+		exitOnInterrupt()
+		if registerRequestFile != "" {
+			data := readRequestFile(registerRequestFile)
+			if isWebAuthnOptions(data) {
+				credential, rpId, device := registerWebAuthn(data, registerFacet, registerDevices.devices())
+				if registerAccount != "" {
+					authData, err := u2f.ParseAuthenticatorData(credential.Response.AuthenticatorData)
+					if err != nil {
+						exitWithError(exitError, "Invalid authenticator data: %s", err)
+					}
+					storeCredential(registerAccount, rpId, authData, device)
+				}
+				printJson(credential)
+				return
+			}
+			request, excluded = registerRequestFromJson(data)
+		}
+		if registerChallenge != "" {
+			request.Challenge = registerChallenge
+		}
+		if registerAppId != "" {
+			request.AppId = registerAppId
+		}
+		if registerFacet != "" {
+			request.Facet = registerFacet
 		}
-		if registerAppId == "" {
-			log.Fatalf("Must specify app id")
+		for _, req := range excluded {
+			req.Facet = request.Facet
 		}
-		if registerFacet == "" {
-			log.Fatalf("Must specify facet")
+		if request.Challenge == "" {
+			exitWithError(exitError, "Must specify challenge")
 		}
-		request := &u2f.RegisterRequest{
-			Challenge: registerChallenge,
-			AppId:     registerAppId,
-			Facet:     registerFacet,
+		if request.AppId == "" {
+			exitWithError(exitError, "Must specify app id")
+		}
+		if request.Facet == "" {
+			exitWithError(exitError, "Must specify facet")
+		}
+		response, device := registerHelper(request, excluded, registerDevices.devices())
+		if registerAccount != "" {
+			result, err := u2f.VerifyRegisterResponse(response, request.AppId, nil)
+			if err != nil {
+				exitWithError(exitDeviceError, "Invalid register response: %s", err)
+			}
+			storeCredential(registerAccount, request.AppId, result.AuthenticatorData, device)
 		}
-		response := registerHelper(request, u2f.Devices())
 		responseJson, _ := json.Marshal(response)
 		fmt.Println(string(responseJson))
 	},
@@ -43,48 +82,132 @@ func init() {
 	registerCmd.Flags().StringVarP(&registerChallenge, "challenge", "c", "", "The registration challenge")
 	registerCmd.Flags().StringVarP(&registerAppId, "app-id", "a", "", "App ID to register with")
 	registerCmd.Flags().StringVarP(&registerFacet, "facet", "f", "", "The facet to register with")
+	registerCmd.Flags().StringVarP(&registerRequestFile, "request", "r", "", "A u2f-api.js RegisterRequest or WebAuthn creation options JSON file, or - for stdin")
+	registerCmd.Flags().DurationVarP(&registerTimeout, "timeout", "t", 25*time.Second, "How long to wait for the user to touch a device")
+	addDeviceFlags(registerCmd, &registerDevices)
+	registerCmd.Flags().StringVar(&registerAccount, "account", "", "Record the new credential in the credential store under this account name")
 }
 
-func registerHelper(req *u2f.RegisterRequest, devices []*u2f.HidDevice) *u2f.RegisterResponse {
+// Registers with the device the user touches, returning the response and the device.
+func registerHelper(req *u2f.RegisterRequest, excluded []*u2f.AuthenticateRequest, devices []*u2f.HidDevice) (*u2f.RegisterResponse, *u2f.HidDevice) {
 	log.Debugf("Registing with request %+v", req)
-	openDevices := []u2f.Device{}
-	for i, device := range devices {
-		err := device.Open()
-		if err == nil {
-			openDevices = append(openDevices, devices[i])
-			defer func(i int) {
-				devices[i].Close()
-			}(i)
-			version, err := device.Version()
-			if err != nil {
-				log.Debugf("Device version error: %s", err)
-			} else {
-				log.Debugf("Device version: %s", version)
-			}
-		}
-	}
+	openDevices, closeDevices := openAllDevices(devices)
+	defer closeDevices()
+	openDevices = unregisteredDevices(openDevices, excluded)
 	if len(openDevices) == 0 {
-		log.Fatalf("Failed to find any devices")
+		exitWithError(exitError, "All of the devices are already registered")
 	}
-	fmt.Println("\nTouch the U2F device you wish to register...")
-	timeout := time.After(time.Second * 25)
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+	device := selectRegisterDevice(ctx, openDevices, registerTimeout)
 	interval := time.NewTicker(time.Millisecond * 250)
+	defer interval.Stop()
 	for {
 		select {
-		case <-timeout:
-			interval.Stop()
-			fmt.Println("Failed to get registration response after 25 seconds")
-			return nil
+		case <-ctx.Done():
+			exitWithError(exitTimeout, "Failed to get registration response after %s", registerTimeout)
 		case <-interval.C:
-			for _, device := range openDevices {
-				response, err := device.Register(req)
-				if err != nil {
-					log.Debugf("Got error from device, skipping: %s", err.Error())
-				} else {
-					return response
-				}
+			response, err := device.Register(req)
+			if err == nil {
+				return response, device
+			} else if _, ok := err.(*u2f.TestOfUserPresenceRequiredError); ok {
+				log.Debugf("Waiting for the user to touch the device")
+			} else {
+				exitWithDeviceError(err, "Failed to register")
 			}
 		}
 	}
-	return nil
+}
+
+// Creates a credential from the WebAuthn creation options, using CTAP2 if the device supports it.
+// Returns the credential, its RP ID and the device it was created on.
+func registerWebAuthn(data []byte, facet string, devices []*u2f.HidDevice) (*u2f.RegistrationCredential, string, *u2f.HidDevice) {
+	options, err := u2f.ParseCreationOptions(data)
+	if err != nil {
+		exitWithError(exitError, "Invalid WebAuthn options: %s", err)
+	}
+	options.RP.ID, facet = webAuthnRPID(options.RP.ID, facet)
+	err = u2f.ValidateRPID(options.RP.ID, facet, nil)
+	if err != nil {
+		exitWithError(exitError, "%s", err)
+	}
+	clientData := &u2f.CollectedClientData{
+		Type:      u2f.ClientDataTypeCreate,
+		Challenge: options.Challenge,
+		Origin:    facet,
+	}
+
+	openDevices, closeDevices := openAllDevices(devices)
+	defer closeDevices()
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+	device := selectRegisterDevice(ctx, openDevices, registerTimeout)
+	// The device info decides whether a preferred resident credential is requested
+	var info *u2f.AuthenticatorInfo
+	if device.SupportsCTAP2() {
+		info, err = device.GetInfo()
+		if err != nil {
+			exitWithDeviceError(err, "Failed to get device info")
+		}
+	}
+	req, err := options.MakeCredentialRequest(clientData.Hash(), info)
+	if err != nil {
+		exitWithError(exitError, "Invalid WebAuthn options: %s", err)
+	}
+	if req.UserVerification && device.SupportsCTAP2() {
+		token, err := device.GetPinUvAuthToken(readPin(), u2f.PermissionMakeCredential, options.RP.ID)
+		if err != nil {
+			exitWithDeviceError(err, "Failed to get PIN token")
+		}
+		req.PinUvAuthToken = token
+	}
+	cancelOnTimeout(ctx, device)
+	response, err := authenticatorUntil(ctx, device).MakeCredential(req)
+	if ctx.Err() == context.DeadlineExceeded {
+		exitWithError(exitTimeout, "Failed to get registration response after %s", registerTimeout)
+	} else if err != nil {
+		exitWithDeviceError(err, "Failed to create credential")
+	}
+	credential, err := u2f.NewRegistrationCredential(clientData.JSON(), options, response)
+	if err != nil {
+		exitWithError(exitError, "Failed to encode credential: %s", err)
+	}
+	return credential, options.RP.ID, device
+}
+
+// Asks the user to touch the device to register, exiting if the context is done first.
+func selectRegisterDevice(ctx context.Context, devices []*u2f.HidDevice, timeout time.Duration) *u2f.HidDevice {
+	fmt.Fprintln(os.Stderr, "\nTouch the U2F device you wish to register...")
+	if len(devices) == 1 {
+		return devices[0]
+	}
+	selected, err := u2f.SelectDevice(ctx, devices)
+	if err == context.DeadlineExceeded {
+		exitWithError(exitTimeout, "Failed to get registration response after %s", timeout)
+	} else if err != nil {
+		exitWithDeviceError(err, "Failed to select a device")
+	}
+	fmt.Fprintln(os.Stderr, "\nTouch the device again to confirm the registration...")
+	return selected
+}
+
+// Returns the devices that do not recognise any of the registered key handles.
+func unregisteredDevices(devices []*u2f.HidDevice, registered []*u2f.AuthenticateRequest) []*u2f.HidDevice {
+	unregistered := []*u2f.HidDevice{}
+	for _, device := range devices {
+		known := false
+		for _, req := range registered {
+			_, err := device.Authenticate(req)
+			if _, ok := err.(*u2f.TestOfUserPresenceRequiredError); ok {
+				known = true
+				break
+			}
+		}
+		if known {
+			log.Infof("Skipping device %s, it is already registered", device.Info().Path)
+		} else {
+			unregistered = append(unregistered, device)
+		}
+	}
+	return unregistered
 }
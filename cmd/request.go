@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	log "github.com/sirupsen/logrus"
+)
+
+// The U2F protocol version of register requests and registered keys.
+const u2fVersion = "U2F_V2"
+
+// A u2f-api.js register or sign request, also accepting the older single request
+// forms and signRequests lists. The facet and channel id settings are not part of
+// u2f-api.js, and map onto the RegisterRequest and AuthenticateRequest fields.
+// https://fidoalliance.org/specs/fido-u2f-v1.2-ps-20170411/fido-u2f-javascript-api-v1.2-ps-20170411.html
+type u2fRequestJson struct {
+	AppId              string              `json:"appId,omitempty"`
+	Challenge          string              `json:"challenge,omitempty"`
+	Version            string              `json:"version,omitempty"`
+	KeyHandle          string              `json:"keyHandle,omitempty"`
+	RegisterRequests   []u2fRequestJson    `json:"registerRequests,omitempty"`
+	SignRequests       []registeredKeyJson `json:"signRequests,omitempty"`
+	RegisteredKeys     []registeredKeyJson `json:"registeredKeys,omitempty"`
+	Facet              string              `json:"facet,omitempty"`
+	ChannelIdPublicKey *u2f.JSONWebKey     `json:"channelIdPublicKey,omitempty"`
+	ChannelIdUnused    bool                `json:"channelIdUnused,omitempty"`
+}
+
+// A key handle the user has already registered, with an optional AppID if it
+// differs from the request's. The challenge is only set in the older signRequests form.
+type registeredKeyJson struct {
+	Version    string   `json:"version,omitempty"`
+	KeyHandle  string   `json:"keyHandle,omitempty"`
+	AppId      string   `json:"appId,omitempty"`
+	Challenge  string   `json:"challenge,omitempty"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// Set once a request has been read from stdin, which leaves nothing else to read there.
+var stdinRequest bool
+
+// Reads the request JSON from the file, or from stdin if the path is "-".
+func readRequestFile(path string) []byte {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+		stdinRequest = true
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		exitWithError(exitError, "Failed to read request: %s", err)
+	}
+	return data
+}
+
+// Returns true if the JSON is WebAuthn options rather than a u2f-api.js request.
+// WebAuthn options are either wrapped in a publicKey member, or have a challenge
+// without any of the members that only u2f-api.js requests have.
+func isWebAuthnOptions(data []byte) bool {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(data, &members) != nil {
+		return false
+	}
+	if _, ok := members["publicKey"]; ok {
+		return true
+	}
+	if _, ok := members["challenge"]; !ok {
+		return false
+	}
+	for _, member := range []string{"appId", "version", "keyHandle", "registerRequests", "registeredKeys", "signRequests"} {
+		if _, ok := members[member]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+func parseU2FRequest(data []byte) *u2fRequestJson {
+	var request u2fRequestJson
+	err := json.Unmarshal(data, &request)
+	if err != nil {
+		exitWithError(exitError, "Invalid request JSON: %s", err)
+	}
+	return &request
+}
+
+// Returns the RegisterRequest, and check only requests for the registered keys
+// so devices that are already registered can be skipped.
+func registerRequestFromJson(data []byte) (*u2f.RegisterRequest, []*u2f.AuthenticateRequest) {
+	request := parseU2FRequest(data)
+	challenge := request.Challenge
+	for _, registerRequest := range request.RegisterRequests {
+		if registerRequest.Version == u2fVersion {
+			challenge = registerRequest.Challenge
+			if registerRequest.AppId != "" {
+				request.AppId = registerRequest.AppId
+			}
+			break
+		}
+	}
+	registerRequest := &u2f.RegisterRequest{
+		Challenge:          challenge,
+		AppId:              request.AppId,
+		Facet:              request.Facet,
+		ChannelIdPublicKey: request.ChannelIdPublicKey,
+		ChannelIdUnused:    request.ChannelIdUnused,
+	}
+	excluded := signRequestsFromJson(request)
+	for _, req := range excluded {
+		req.CheckOnly = true
+	}
+	return registerRequest, excluded
+}
+
+// Returns an AuthenticateRequest for each registered key of the sign request.
+func authenticateRequestsFromJson(data []byte) []*u2f.AuthenticateRequest {
+	return signRequestsFromJson(parseU2FRequest(data))
+}
+
+func signRequestsFromJson(request *u2fRequestJson) []*u2f.AuthenticateRequest {
+	keys := append(append([]registeredKeyJson{}, request.RegisteredKeys...), request.SignRequests...)
+	if request.KeyHandle != "" {
+		keys = append(keys, registeredKeyJson{Version: request.Version, KeyHandle: request.KeyHandle})
+	}
+	requests := []*u2f.AuthenticateRequest{}
+	for _, key := range keys {
+		if key.Version != "" && key.Version != u2fVersion {
+			log.Debugf("Skipping key handle %s with unsupported version %s", key.KeyHandle, key.Version)
+			continue
+		}
+		req := &u2f.AuthenticateRequest{
+			Challenge:          request.Challenge,
+			AppId:              request.AppId,
+			Facet:              request.Facet,
+			KeyHandle:          key.KeyHandle,
+			ChannelIdPublicKey: request.ChannelIdPublicKey,
+			ChannelIdUnused:    request.ChannelIdUnused,
+		}
+		if key.Challenge != "" {
+			req.Challenge = key.Challenge
+		}
+		if key.AppId != "" {
+			req.AppId = key.AppId
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// Returns the RP ID and facet of WebAuthn options, the RP ID defaults to the host
+// of the facet, and the facet defaults to the https origin of the RP ID.
+func webAuthnRPID(rpId, facet string) (string, string) {
+	if rpId == "" && facet == "" {
+		exitWithError(exitError, "Must specify facet")
+	}
+	if facet == "" {
+		facet = "https://" + rpId
+	}
+	if rpId == "" {
+		origin, err := url.Parse(facet)
+		if err != nil {
+			exitWithError(exitError, "Invalid facet %s: %s", facet, err)
+		}
+		rpId = origin.Hostname()
+	}
+	return rpId, facet
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var resetSerial string
+
+var resetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the device back to factory settings, deleting all credentials.",
+	Run: func(cmd *cobra.Command, args []string) {
+		device := findDevice(u2f.Devices(), resetSerial)
+		info := device.Info()
+		fmt.Printf("Device: %s %s (serial %s, path %s)\n", info.Manufacturer, info.Product, info.Serial, info.Path)
+		fmt.Println("Resetting will permanently delete all credentials on the device and remove its PIN.")
+		fmt.Print("Type \"yes\" to continue: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			exitWithError(exitUserCancelled, "Reset aborted")
+		}
+		resetHelper(device)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(resetCmd)
+	resetCmd.Flags().StringVarP(&resetSerial, "serial", "s", "", "The serial number of the device to reset, required if more than one device is attached")
+}
+
+func resetHelper(device *u2f.HidDevice) {
+	err := device.Open()
+	if err != nil {
+		exitWithDeviceError(err, "Failed to open device")
+	}
+	defer device.Close()
+	promptOnTouch(device, "\nTouch the flashing device to confirm the reset...")
+	err = device.Reset()
+	switch err.(type) {
+	case nil:
+		fmt.Println("Device was reset.")
+	case *u2f.NotAllowedError:
+		exitWithError(exitDeviceError, "The device only allows a reset shortly after it is plugged in, re-insert it and try again")
+	case *u2f.UserActionTimeoutError:
+		exitWithError(exitTimeout, "Timed out waiting for the device to be touched, the device was not reset")
+	default:
+		exitWithDeviceError(err, "Failed to reset device")
+	}
+}
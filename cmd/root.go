@@ -9,6 +9,7 @@ import (
 )
 
 var Verbose bool
+var JsonErrors bool
 
 var RootCmd = &cobra.Command{
 	Use:   "u2fhost",
@@ -25,6 +26,7 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initCli)
 	RootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "v", false, "Turn on verbose logging")
+	RootCmd.PersistentFlags().BoolVar(&JsonErrors, "json-errors", false, "Write errors to stderr as JSON objects")
 }
 
 func initCli() {
@@ -33,6 +35,9 @@ func initCli() {
 	} else {
 		log.SetLevel(log.InfoLevel)
 	}
+	if JsonErrors {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
 }
 
 func main() {
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var serveListen string
+var serveStorePath string
+var serveAppId string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run a local relying party to test register and authenticate against.",
+	Long: `Runs a U2F relying party on localhost that issues register and sign challenges,
+stores registrations in a JSON file and verifies the responses.
+
+  curl -s 'http://localhost:8080/register/begin?user=alice' | u2fhost register -r - > register.json
+  curl -s -d @register.json 'http://localhost:8080/register/finish?user=alice'
+  curl -s 'http://localhost:8080/sign/begin?user=alice' | u2fhost authenticate -r - > sign.json
+  curl -s -d @sign.json 'http://localhost:8080/sign/finish?user=alice'`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		appId := serveAppId
+		if appId == "" {
+			appId = "http://" + serveListen
+		}
+		server, err := newRelyingParty(appId, serveStorePath)
+		if err != nil {
+			exitWithError(exitError, "%s", err)
+		}
+		log.Infof("Serving AppID %s on http://%s, storing registrations in %s", server.appId, serveListen, serveStorePath)
+		err = http.ListenAndServe(serveListen, server.handler())
+		exitWithError(exitError, "%s", err)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVarP(&serveListen, "listen", "l", "localhost:8080", "The address to listen on")
+	serveCmd.Flags().StringVar(&serveStorePath, "store", "u2fhost-registrations.json", "The JSON file to store registrations in")
+	serveCmd.Flags().StringVarP(&serveAppId, "app-id", "a", "", "The AppID to use, defaults to the http origin of the listen address")
+}
+
+// A registered key, as stored by the relying party.
+type registration struct {
+	KeyHandle string `json:"keyHandle"`
+	// The COSE_Key encoded public key.
+	PublicKey  []byte    `json:"publicKey"`
+	Counter    uint32    `json:"counter"`
+	Format     string    `json:"attestationFormat"`
+	Registered time.Time `json:"registered"`
+}
+
+// The result returned for each finished request.
+type serveResult struct {
+	Status    string `json:"status"`
+	User      string `json:"user"`
+	KeyHandle string `json:"keyHandle,omitempty"`
+	Counter   uint32 `json:"counter,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// A U2F relying party with registrations stored in a JSON file, and the
+// challenges issued to each user kept in memory until they are used.
+type relyingParty struct {
+	appId         string
+	facet         string
+	storePath     string
+	mutex         sync.Mutex
+	registrations map[string][]*registration
+	challenges    map[string]string
+}
+
+func newRelyingParty(appId, storePath string) (*relyingParty, error) {
+	appIdUrl, err := url.Parse(appId)
+	if err != nil || appIdUrl.Host == "" {
+		return nil, fmt.Errorf("Invalid AppID %s, must be a URL", appId)
+	}
+	server := &relyingParty{
+		appId:         appId,
+		facet:         appIdUrl.Scheme + "://" + appIdUrl.Host,
+		storePath:     storePath,
+		registrations: map[string][]*registration{},
+		challenges:    map[string]string{},
+	}
+	data, err := ioutil.ReadFile(storePath)
+	if os.IsNotExist(err) {
+		return server, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read registrations: %s", err)
+	}
+	err = json.Unmarshal(data, &server.registrations)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid registrations file %s: %s", storePath, err)
+	}
+	return server, nil
+}
+
+func (s *relyingParty) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register/begin", s.registerBegin)
+	mux.HandleFunc("/register/finish", s.registerFinish)
+	mux.HandleFunc("/sign/begin", s.signBegin)
+	mux.HandleFunc("/sign/finish", s.signFinish)
+	return mux
+}
+
+// Returns a u2f-api.js register request, with the user's keys as registeredKeys.
+func (s *relyingParty) registerBegin(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := r.URL.Query().Get("user")
+	if user == "" {
+		writeJson(w, http.StatusBadRequest, serveResult{Status: "error", Error: "Missing user"})
+		return
+	}
+	challenge := s.newChallenge(user)
+	writeJson(w, http.StatusOK, u2fRequestJson{
+		AppId:            s.appId,
+		Facet:            s.facet,
+		RegisterRequests: []u2fRequestJson{{Version: u2fVersion, Challenge: challenge}},
+		RegisteredKeys:   s.registeredKeys(user),
+	})
+}
+
+// Verifies the RegisterResponse and stores the new key.
+func (s *relyingParty) registerFinish(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := r.URL.Query().Get("user")
+	var response u2f.RegisterResponse
+	challenge, err := s.readResponse(r, user, &response)
+	if err == nil {
+		err = u2f.VerifyClientData(response.ClientData, u2f.ClientDataTypeRegister, challenge, s.facet)
+	}
+	var result *u2f.AttestationResult
+	if err == nil {
+		result, err = u2f.VerifyRegisterResponse(&response, s.appId, nil)
+	}
+	if err != nil {
+		s.reject(w, user, err)
+		return
+	}
+	keyHandle := base64.RawURLEncoding.EncodeToString(result.AuthenticatorData.CredentialID)
+	if s.findRegistration(user, keyHandle) != nil {
+		s.reject(w, user, errors.New("The key is already registered"))
+		return
+	}
+	s.registrations[user] = append(s.registrations[user], &registration{
+		KeyHandle:  keyHandle,
+		PublicKey:  result.AuthenticatorData.CredentialPublicKey,
+		Format:     result.Format,
+		Registered: time.Now().UTC(),
+	})
+	err = s.save()
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, serveResult{Status: "error", User: user, Error: err.Error()})
+		return
+	}
+	log.Infof("Registered key %s for %s", keyHandle, user)
+	writeJson(w, http.StatusOK, serveResult{Status: "ok", User: user, KeyHandle: keyHandle})
+}
+
+// Returns a u2f-api.js sign request for the user's keys.
+func (s *relyingParty) signBegin(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := r.URL.Query().Get("user")
+	if len(s.registrations[user]) == 0 {
+		writeJson(w, http.StatusNotFound, serveResult{Status: "error", User: user, Error: "The user has no registered keys"})
+		return
+	}
+	writeJson(w, http.StatusOK, u2fRequestJson{
+		AppId:          s.appId,
+		Facet:          s.facet,
+		Challenge:      s.newChallenge(user),
+		RegisteredKeys: s.registeredKeys(user),
+	})
+}
+
+// Verifies the AuthenticateResponse with the stored key, and that its counter increased.
+func (s *relyingParty) signFinish(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	user := r.URL.Query().Get("user")
+	var response u2f.AuthenticateResponse
+	challenge, err := s.readResponse(r, user, &response)
+	if err == nil {
+		err = u2f.VerifyClientData(response.ClientData, u2f.ClientDataTypeAuthenticate, challenge, s.facet)
+	}
+	var key *registration
+	if err == nil {
+		key = s.findRegistration(user, response.KeyHandle)
+		if key == nil {
+			err = errors.New("The key handle is not registered for the user")
+		}
+	}
+	var authData *u2f.AuthenticatorData
+	if err == nil {
+		authData, err = u2f.VerifyAuthenticateResponse(&response, s.appId, key.PublicKey)
+	}
+	if err == nil && !authData.UserPresent() {
+		err = errors.New("The user was not present")
+	}
+	if err == nil && authData.SignCount <= key.Counter && authData.SignCount != 0 {
+		err = fmt.Errorf("The counter %d did not increase from %d, the key may be cloned", authData.SignCount, key.Counter)
+	}
+	if err != nil {
+		s.reject(w, user, err)
+		return
+	}
+	key.Counter = authData.SignCount
+	err = s.save()
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, serveResult{Status: "error", User: user, Error: err.Error()})
+		return
+	}
+	log.Infof("Authenticated %s with key %s, counter %d", user, key.KeyHandle, key.Counter)
+	writeJson(w, http.StatusOK, serveResult{Status: "ok", User: user, KeyHandle: key.KeyHandle, Counter: key.Counter})
+}
+
+// Decodes the response JSON from the request body, returning the challenge issued
+// to the user. The challenge can only be used once.
+func (s *relyingParty) readResponse(r *http.Request, user string, response interface{}) (string, error) {
+	if r.Method != http.MethodPost {
+		return "", errors.New("The response must be POSTed")
+	}
+	challenge, ok := s.challenges[user]
+	if !ok {
+		return "", errors.New("No challenge was issued to the user")
+	}
+	delete(s.challenges, user)
+	err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(response)
+	if err != nil {
+		return "", fmt.Errorf("Invalid response JSON: %s", err)
+	}
+	return challenge, nil
+}
+
+func (s *relyingParty) reject(w http.ResponseWriter, user string, err error) {
+	log.Infof("Rejected response from %s: %s", user, err)
+	writeJson(w, http.StatusBadRequest, serveResult{Status: "rejected", User: user, Error: err.Error()})
+}
+
+func (s *relyingParty) newChallenge(user string) string {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		exitWithError(exitError, "Failed to generate a challenge: %s", err)
+	}
+	s.challenges[user] = base64.RawURLEncoding.EncodeToString(challenge)
+	return s.challenges[user]
+}
+
+func (s *relyingParty) registeredKeys(user string) []registeredKeyJson {
+	keys := []registeredKeyJson{}
+	for _, key := range s.registrations[user] {
+		keys = append(keys, registeredKeyJson{Version: u2fVersion, KeyHandle: key.KeyHandle})
+	}
+	return keys
+}
+
+func (s *relyingParty) findRegistration(user, keyHandle string) *registration {
+	for _, key := range s.registrations[user] {
+		if key.KeyHandle == keyHandle {
+			return key
+		}
+	}
+	return nil
+}
+
+// Writes the registrations to a temporary file and renames it over the store,
+// so the store is not left half written.
+func (s *relyingParty) save() error {
+	data, err := json.MarshalIndent(s.registrations, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(s.storePath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to save registrations: %s", err)
+	}
+	return nil
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// The extension of signature bundles written next to the signed file.
+const signatureBundleExtension = ".u2fsig"
+
+var signFile string
+var signOutput string
+var signAccount string
+var signAppId string
+var signFacet string
+var signKeyHandle string
+var signPublicKey string
+var signTimeout time.Duration
+var signDevices deviceFlags
+
+var verifySignatureFile string
+var verifySignatureBundle string
+var verifySignaturePublicKey string
+var verifySignatureAccount string
+
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign the SHA-256 hash of a file, writing a detached signature bundle.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnInterrupt()
+		if signFile == "" {
+			exitWithError(exitError, "Must specify file")
+		}
+		digest := hashFile(signFile)
+		requests := []*u2f.AuthenticateRequest{}
+		publicKeys := map[string][]byte{}
+		if signAccount != "" {
+			credentials := loadCredentialStore().find(signAccount, signAppId)
+			if len(credentials) == 0 {
+				exitWithError(exitError, "No credentials found for account %s", signAccount)
+			}
+			for _, credential := range credentials {
+				requests = append(requests, u2f.SignDigestRequest(digest, credential.AppId, signFacetFor(credential.AppId), credential.KeyHandle))
+				publicKeys[credential.KeyHandle] = credential.PublicKey
+			}
+		} else {
+			if signKeyHandle == "" || signPublicKey == "" || signAppId == "" {
+				exitWithError(exitError, "Must specify account, or the key handle, public key and app id")
+			}
+			requests = append(requests, u2f.SignDigestRequest(digest, signAppId, signFacetFor(signAppId), signKeyHandle))
+			publicKeys[signKeyHandle] = parsePublicKey(signPublicKey)
+		}
+
+		response := authenticateHelper(requests, signDevices.devices(), signTimeout)
+		var bundle *u2f.SignatureBundle
+		var err error
+		for _, req := range requests {
+			if req.KeyHandle == response.KeyHandle {
+				bundle, err = u2f.NewSignatureBundle(req, response, publicKeys[req.KeyHandle])
+				break
+			}
+		}
+		if err != nil {
+			exitWithError(exitDeviceError, "The signature does not match the public key: %s", err)
+		} else if bundle == nil {
+			exitWithError(exitDeviceError, "The response is for an unknown key handle %s", response.KeyHandle)
+		}
+		if signAccount != "" {
+			updateStoredCounter(signAccount, requests, response)
+		}
+		bundleJson, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			exitWithError(exitError, "Failed to encode the signature: %s", err)
+		}
+		bundleJson = append(bundleJson, '\n')
+		output := signOutput
+		if output == "" {
+			output = signFile + signatureBundleExtension
+		}
+		if output == "-" {
+			os.Stdout.Write(bundleJson)
+			return
+		}
+		err = ioutil.WriteFile(output, bundleJson, 0644)
+		if err != nil {
+			exitWithError(exitError, "Failed to write the signature: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote signature to %s\n", output)
+	},
+}
+
+var verifySignatureCmd = &cobra.Command{
+	Use:   "verify-signature",
+	Short: "Verify a signature bundle written by sign.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if verifySignatureFile == "" {
+			exitWithError(exitError, "Must specify file")
+		}
+		bundlePath := verifySignatureBundle
+		if bundlePath == "" {
+			bundlePath = verifySignatureFile + signatureBundleExtension
+		}
+		var bundle u2f.SignatureBundle
+		err := json.Unmarshal(readRequestFile(bundlePath), &bundle)
+		if err != nil {
+			exitWithError(exitError, "Invalid signature bundle: %s", err)
+		}
+		var publicKey []byte
+		if verifySignaturePublicKey != "" {
+			publicKey = parsePublicKey(verifySignaturePublicKey)
+		} else if verifySignatureAccount != "" {
+			for _, credential := range loadCredentialStore().find(verifySignatureAccount, bundle.AppId) {
+				if credential.KeyHandle == bundle.KeyHandle {
+					publicKey = credential.PublicKey
+				}
+			}
+			if publicKey == nil {
+				exitWithError(exitError, "The signing key handle is not stored for account %s", verifySignatureAccount)
+			}
+		} else {
+			log.Warnf("Using the public key in the bundle, pass --public-key or --account to check who signed it")
+		}
+		err = bundle.Verify(hashFile(verifySignatureFile), publicKey)
+		if err != nil {
+			exitWithError(exitError, "%s", err)
+		}
+		fmt.Printf("Good signature from key handle %s for %s, counter %d\n", bundle.KeyHandle, bundle.AppId, bundle.Counter)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(signCmd, verifySignatureCmd)
+	signCmd.Flags().StringVar(&signFile, "file", "", "The file to sign")
+	signCmd.Flags().StringVarP(&signOutput, "output", "o", "", "Where to write the signature bundle, defaults to the file name with "+signatureBundleExtension+", or - for stdout")
+	signCmd.Flags().StringVar(&signAccount, "account", "", "Sign with the stored credentials of this account")
+	signCmd.Flags().StringVarP(&signAppId, "app-id", "a", "", "The App ID the key handle was registered with")
+	signCmd.Flags().StringVarP(&signFacet, "facet", "f", "", "The facet to sign with, defaults to the App ID")
+	signCmd.Flags().StringVarP(&signKeyHandle, "key-handle", "k", "", "The key handle to sign with")
+	signCmd.Flags().StringVarP(&signPublicKey, "public-key", "p", "", "The public key of the key handle, as a base64 COSE key or uncompressed P-256 point")
+	signCmd.Flags().DurationVarP(&signTimeout, "timeout", "t", 25*time.Second, "How long to wait for the user to touch a device")
+	addDeviceFlags(signCmd, &signDevices)
+	verifySignatureCmd.Flags().StringVar(&verifySignatureFile, "file", "", "The signed file")
+	verifySignatureCmd.Flags().StringVar(&verifySignatureBundle, "signature", "", "The signature bundle, defaults to the file name with "+signatureBundleExtension)
+	verifySignatureCmd.Flags().StringVarP(&verifySignaturePublicKey, "public-key", "p", "", "The trusted public key, as a base64 COSE key or uncompressed P-256 point")
+	verifySignatureCmd.Flags().StringVar(&verifySignatureAccount, "account", "", "Trust the stored credentials of this account")
+}
+
+func signFacetFor(appId string) string {
+	if signFacet != "" {
+		return signFacet
+	}
+	return appId
+}
+
+// Returns the SHA-256 hash of the file, or of stdin if the path is "-".
+func hashFile(path string) []byte {
+	var file io.ReadCloser = os.Stdin
+	if path != "-" {
+		var err error
+		file, err = os.Open(path)
+		if err != nil {
+			exitWithError(exitError, "Failed to read %s: %s", path, err)
+		}
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err := io.Copy(hash, file)
+	if err != nil {
+		exitWithError(exitError, "Failed to read %s: %s", path, err)
+	}
+	return hash.Sum(nil)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var sshKeygenFile string
+var sshKeygenApplication string
+var sshKeygenComment string
+var sshKeygenForce bool
+var sshKeygenTimeout time.Duration
+var sshKeygenDevices deviceFlags
+
+var sshKeygenCmd = &cobra.Command{
+	Use:   "ssh-keygen",
+	Short: "Generate an OpenSSH sk-ecdsa-sha2-nistp256@openssh.com key on a device.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitOnInterrupt()
+		path := sshKeygenFile
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				exitWithError(exitError, "Failed to find the home directory, specify the key file with --file: %s", err)
+			}
+			path = filepath.Join(home, ".ssh", "id_ecdsa_sk")
+		}
+		if _, err := os.Stat(path); err == nil && !sshKeygenForce {
+			exitWithError(exitError, "%s already exists, pass --force to overwrite it", path)
+		}
+		comment := sshKeygenComment
+		if comment == "" {
+			comment = defaultSSHComment()
+		}
+
+		openDevices, closeDevices := openAllDevices(sshKeygenDevices.devices())
+		defer closeDevices()
+		ctx, cancel := context.WithTimeout(context.Background(), sshKeygenTimeout)
+		defer cancel()
+		device := selectRegisterDevice(ctx, openDevices, sshKeygenTimeout)
+		cancelOnTimeout(ctx, device)
+		key, err := u2f.GenerateSSHKey(authenticatorUntil(ctx, device), sshKeygenApplication, comment)
+		if ctx.Err() == context.DeadlineExceeded {
+			exitWithError(exitTimeout, "Failed to generate the key after %s", sshKeygenTimeout)
+		} else if err != nil {
+			exitWithDeviceError(err, "Failed to generate the key")
+		}
+
+		privateKey, err := key.MarshalPrivateKey()
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0700)
+		}
+		if err == nil {
+			err = writeFileAtomic(path, privateKey, 0600)
+		}
+		if err != nil {
+			exitWithError(exitError, "Failed to write the key: %s", err)
+		}
+		authorizedKey, err := key.AuthorizedKey()
+		if err == nil {
+			err = writeFileAtomic(path+".pub", authorizedKey, 0644)
+		}
+		if err != nil {
+			exitWithError(exitError, "Failed to write the public key: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote the key handle to %s and the public key to %s.pub\n", path, path)
+		fmt.Print(string(authorizedKey))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(sshKeygenCmd)
+	sshKeygenCmd.Flags().StringVarP(&sshKeygenFile, "file", "f", "", "The private key file to write, defaults to ~/.ssh/id_ecdsa_sk")
+	sshKeygenCmd.Flags().StringVar(&sshKeygenApplication, "application", u2f.SSHApplication, "The application to create the key for, which must start with ssh:")
+	sshKeygenCmd.Flags().StringVarP(&sshKeygenComment, "comment", "C", "", "The key comment, defaults to user@hostname")
+	sshKeygenCmd.Flags().BoolVar(&sshKeygenForce, "force", false, "Overwrite an existing key file")
+	sshKeygenCmd.Flags().DurationVarP(&sshKeygenTimeout, "timeout", "t", 25*time.Second, "How long to wait for the user to touch a device")
+	addDeviceFlags(sshKeygenCmd, &sshKeygenDevices)
+}
+
+// Returns user@hostname, as ssh-keygen uses for the comment.
+func defaultSSHComment() string {
+	hostname, _ := os.Hostname()
+	current, err := user.Current()
+	if err != nil {
+		return hostname
+	}
+	return current.Username + "@" + hostname
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var sshAgentSocket string
+var sshAgentTimeout time.Duration
+var sshAgentDevices deviceFlags
+
+var sshAgentCmd = &cobra.Command{
+	Use:   "ssh-agent [KEY_FILE...]",
+	Short: "Run an SSH agent that signs with sk-ecdsa keys on the attached devices.",
+	Long: `Runs an SSH agent on a Unix socket serving the sk-ecdsa keys in the key files,
+which default to ~/.ssh/id_ecdsa_sk. Each sign request waits for the user to
+touch the device that holds the key. Point SSH at the agent's socket:
+
+  u2fhost ssh-agent -a ~/.ssh/u2fhost-agent.sock ~/.ssh/id_ecdsa_sk &
+  export SSH_AUTH_SOCK=~/.ssh/u2fhost-agent.sock`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if sshAgentDevices.choose {
+			exitWithError(exitError, "--choose can not be used with ssh-agent")
+		}
+		paths := args
+		if len(paths) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				exitWithError(exitError, "Failed to find the home directory, pass the key files: %s", err)
+			}
+			paths = []string{filepath.Join(home, ".ssh", "id_ecdsa_sk")}
+		}
+		sshAgent := &u2fAgent{filter: sshAgentDevices.filter(), timeout: sshAgentTimeout}
+		for _, path := range paths {
+			sshAgent.addKeyFile(path)
+		}
+
+		socket, cleanup := listenAgentSocket(sshAgentSocket)
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-interrupt
+			cleanup()
+			os.Exit(0)
+		}()
+		fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", socket.Addr())
+		log.Infof("Serving %d keys on %s", len(sshAgent.keys), socket.Addr())
+		for {
+			conn, err := socket.Accept()
+			if err != nil {
+				cleanup()
+				exitWithError(exitError, "Failed to accept agent connection: %s", err)
+			}
+			go func() {
+				err := agent.ServeAgent(sshAgent, conn)
+				if err != nil && err != io.EOF {
+					log.Debugf("Agent connection closed: %s", err)
+				}
+				conn.Close()
+			}()
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(sshAgentCmd)
+	sshAgentCmd.Flags().StringVarP(&sshAgentSocket, "socket", "a", "", "The Unix socket to listen on, defaults to a new temporary directory")
+	sshAgentCmd.Flags().DurationVarP(&sshAgentTimeout, "timeout", "t", 25*time.Second, "How long to wait for the user to touch a device")
+	addDeviceFlags(sshAgentCmd, &sshAgentDevices)
+}
+
+// Listens on the socket, or one in a new temporary directory if it is empty,
+// returning the listener and a function that removes the socket.
+func listenAgentSocket(path string) (net.Listener, func()) {
+	cleanup := func() {}
+	if path == "" {
+		dir, err := ioutil.TempDir("", "u2fhost-agent")
+		if err != nil {
+			exitWithError(exitError, "Failed to create the socket directory: %s", err)
+		}
+		path = filepath.Join(dir, "agent.sock")
+		cleanup = func() { os.RemoveAll(dir) }
+	} else if _, err := os.Stat(path); err == nil {
+		// Replace the socket of an agent that is no longer running.
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			exitWithError(exitError, "An agent is already listening on %s", path)
+		}
+		os.Remove(path)
+		cleanup = func() { os.Remove(path) }
+	} else {
+		cleanup = func() { os.Remove(path) }
+	}
+	socket, err := net.Listen("unix", path)
+	if err == nil {
+		err = os.Chmod(path, 0600)
+	}
+	if err != nil {
+		cleanup()
+		exitWithError(exitError, "Failed to listen on %s: %s", path, err)
+	}
+	return socket, cleanup
+}
+
+// An SSH agent serving sk-ecdsa keys, signing with whichever attached device holds the key.
+type u2fAgent struct {
+	keys       []*u2f.SSHKey
+	publicKeys []ssh.PublicKey
+	filter     u2f.DeviceFilter
+	timeout    time.Duration
+	// Held while a device is in use, so only one sign request waits for a touch at a time.
+	signMutex sync.Mutex
+	mutex     sync.Mutex
+	// The passphrase the agent was locked with, nil when it is unlocked.
+	passphrase []byte
+}
+
+func (a *u2fAgent) addKeyFile(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		exitWithError(exitError, "Failed to read the key: %s", err)
+	}
+	key, err := u2f.ParseSSHKey(data)
+	if err != nil {
+		exitWithError(exitError, "Invalid key %s: %s", path, err)
+	}
+	publicKey, err := key.SSHPublicKey()
+	if err != nil {
+		exitWithError(exitError, "Invalid key %s: %s", path, err)
+	}
+	a.keys = append(a.keys, key)
+	a.publicKeys = append(a.publicKeys, publicKey)
+}
+
+func (a *u2fAgent) List() ([]*agent.Key, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	keys := []*agent.Key{}
+	if a.passphrase != nil {
+		return keys, nil
+	}
+	for i, key := range a.keys {
+		keys = append(keys, &agent.Key{
+			Format:  a.publicKeys[i].Type(),
+			Blob:    a.publicKeys[i].Marshal(),
+			Comment: key.Comment,
+		})
+	}
+	return keys, nil
+}
+
+// Signs with the first attached device that holds the key, any error is
+// returned to the client as an agent failure.
+func (a *u2fAgent) Sign(publicKey ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	a.mutex.Lock()
+	locked := a.passphrase != nil
+	a.mutex.Unlock()
+	if locked {
+		return nil, errors.New("The agent is locked")
+	}
+	var key *u2f.SSHKey
+	for i, candidate := range a.keys {
+		if bytes.Equal(a.publicKeys[i].Marshal(), publicKey.Marshal()) {
+			key = candidate
+		}
+	}
+	if key == nil {
+		return nil, errors.New("The agent does not have the key")
+	}
+
+	a.signMutex.Lock()
+	defer a.signMutex.Unlock()
+	opened := 0
+	for _, device := range u2f.FilterDevices(u2f.Devices(), a.filter) {
+		err := device.Open()
+		if err != nil {
+			log.Debugf("Failed to open device %s: %s", device.Info().Path, err)
+			continue
+		}
+		opened++
+		signature, err := a.signWithDevice(device, key, data)
+		device.Close()
+		if _, ok := err.(*u2f.NoCredentialsError); ok {
+			continue
+		}
+		if err != nil {
+			log.Errorf("Failed to sign with %s: %s", key.Comment, err)
+		} else {
+			log.Infof("Signed with %s", key.Comment)
+		}
+		return signature, err
+	}
+	if opened == 0 {
+		log.Errorf("Failed to sign with %s: no device is attached", key.Comment)
+		return nil, errors.New("No device is attached")
+	}
+	log.Errorf("Failed to sign with %s: no attached device holds the key", key.Comment)
+	return nil, errors.New("No attached device holds the key")
+}
+
+// Signs with the key on the device, prompting the user to touch it.
+func (a *u2fAgent) signWithDevice(device *u2f.HidDevice, key *u2f.SSHKey, data []byte) (*ssh.Signature, error) {
+	promptOnTouch(device, fmt.Sprintf("\nTouch the flashing device to sign with %s...", key.Comment))
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	cancelOnTimeout(ctx, device)
+	signature, err := key.Sign(authenticatorUntil(ctx, device), data)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("Timed out after %s waiting for the device to be touched", a.timeout)
+	}
+	return signature, err
+}
+
+func (a *u2fAgent) Add(key agent.AddedKey) error {
+	return errors.New("Adding keys is not supported, pass the key files to ssh-agent")
+}
+
+func (a *u2fAgent) Remove(key ssh.PublicKey) error {
+	return errors.New("Removing keys is not supported")
+}
+
+func (a *u2fAgent) RemoveAll() error {
+	return errors.New("Removing keys is not supported")
+}
+
+func (a *u2fAgent) Lock(passphrase []byte) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.passphrase != nil {
+		return errors.New("The agent is already locked")
+	}
+	a.passphrase = append([]byte{}, passphrase...)
+	return nil
+}
+
+func (a *u2fAgent) Unlock(passphrase []byte) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.passphrase == nil || subtle.ConstantTimeCompare(a.passphrase, passphrase) != 1 {
+		return errors.New("Incorrect passphrase")
+	}
+	a.passphrase = nil
+	return nil
+}
+
+func (a *u2fAgent) Signers() ([]ssh.Signer, error) {
+	return nil, errors.New("Signers are not supported, use Sign")
+}
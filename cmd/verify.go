@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+	"github.com/spf13/cobra"
+)
+
+var verifyRequestFile string
+var verifyResponseFile string
+var verifyChallenge string
+var verifyAppId string
+var verifyFacet string
+var verifyPublicKey string
+var verifyRegistrationFile string
+var verifyCounter int64
+var verifyJson bool
+
+// The decoded fields of a response and the result of each check.
+type verifyReport struct {
+	Fields []verifyField `json:"fields"`
+	Checks []verifyCheck `json:"checks"`
+}
+
+type verifyField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type verifyCheck struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// A U2F register response or WebAuthn registration credential, as a credential
+// that VerifyAttestation can check.
+type verifyRegistration struct {
+	credential     *u2f.MakeCredentialResponse
+	clientDataJSON []byte
+	// WebAuthn credentials include the RP ID hash, U2F responses are rebuilt with the app id.
+	webAuthn bool
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Decode and verify stored register and authenticate responses.",
+}
+
+var verifyRegisterCmd = &cobra.Command{
+	Use:   "register",
+	Short: "Verify a register response against its request.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var challenge, appId, facet string
+		if verifyRequestFile != "" {
+			challenge, appId, facet = verifyRegisterRequest(readRequestFile(verifyRequestFile))
+		}
+		overrideVerifyRequest(&challenge, &appId, &facet)
+		registration := parseVerifyRegistration(readVerifyResponse(), appId)
+
+		report := &verifyReport{}
+		clientData := report.clientData(registration.clientDataJSON)
+		typ := u2f.ClientDataTypeRegister
+		if registration.webAuthn {
+			typ = u2f.ClientDataTypeCreate
+		}
+		report.checkClientData(clientData, typ, challenge, facet)
+		report.credential(registration.credential)
+		_, err := u2f.VerifyAttestation(registration.credential, sha256Sum(registration.clientDataJSON), nil)
+		report.checkAppIdHash(appId, registration.credential.AuthenticatorData.RPIDHash, registration.webAuthn, err)
+		report.checkSignature(appId, registration.webAuthn, err)
+		if err == nil {
+			report.field("publicKey (COSE)", base64.RawURLEncoding.EncodeToString(registration.credential.AuthenticatorData.CredentialPublicKey))
+		}
+		report.print()
+	},
+}
+
+var verifyAuthenticateCmd = &cobra.Command{
+	Use:   "authenticate",
+	Short: "Verify an authenticate response against its request and the registered public key.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		response := parseVerifyAuthentication(readVerifyResponse())
+		request := &u2f.AuthenticateRequest{KeyHandle: response.KeyHandle}
+		if verifyRequestFile != "" {
+			request = matchingAuthenticateRequest(readRequestFile(verifyRequestFile), response.KeyHandle)
+		}
+		overrideVerifyRequest(&request.Challenge, &request.AppId, &request.Facet)
+		appId := request.AppId
+		if response.AppIdExtensionUsed {
+			appId = request.AppIdExtension
+		}
+		publicKey := verifyRegisteredKey(appId)
+
+		report := &verifyReport{}
+		report.field("keyHandle", response.KeyHandle)
+		webAuthn := response.AuthenticatorData != ""
+		clientDataJSON, err := base64.RawURLEncoding.DecodeString(response.ClientData)
+		if err != nil {
+			report.check("clientData encoding", false, err.Error())
+		} else {
+			typ := u2f.ClientDataTypeAuthenticate
+			if webAuthn {
+				typ = u2f.ClientDataTypeGet
+			}
+			report.checkClientData(report.clientData(clientDataJSON), typ, request.Challenge, request.Facet)
+		}
+		_, err = u2f.VerifyAuthenticateResponse(response, appId, publicKey)
+		authData := report.authenticatorData(response, appId)
+		if authData != nil {
+			report.checkAppIdHash(appId, authData.RPIDHash, webAuthn, err)
+			report.check("user presence flag", authData.UserPresent(), fmt.Sprintf("flags 0x%02x", authData.Flags))
+			if verifyCounter < 0 {
+				report.check("counter", true, fmt.Sprintf("%d, no stored counter to compare with", authData.SignCount))
+			} else {
+				increased := int64(authData.SignCount) > verifyCounter || authData.SignCount == 0 && verifyCounter == 0
+				report.check("counter", increased, fmt.Sprintf("%d, stored counter %d", authData.SignCount, verifyCounter))
+			}
+		}
+		report.checkSignature(appId, webAuthn, err)
+		report.print()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+	verifyCmd.AddCommand(verifyRegisterCmd, verifyAuthenticateCmd)
+	verifyCmd.PersistentFlags().StringVarP(&verifyRequestFile, "request", "r", "", "The u2f-api.js request or WebAuthn options JSON the response is for")
+	verifyCmd.PersistentFlags().StringVar(&verifyResponseFile, "response", "-", "The response or WebAuthn credential JSON printed by register or authenticate, or - for stdin")
+	verifyCmd.PersistentFlags().StringVarP(&verifyChallenge, "challenge", "c", "", "The challenge of the request")
+	verifyCmd.PersistentFlags().StringVarP(&verifyAppId, "app-id", "a", "", "The App ID of the request")
+	verifyCmd.PersistentFlags().StringVarP(&verifyFacet, "facet", "f", "", "The facet of the request")
+	verifyCmd.PersistentFlags().BoolVar(&verifyJson, "json", false, "Print the report as JSON")
+	verifyAuthenticateCmd.Flags().StringVarP(&verifyPublicKey, "public-key", "p", "", "The registered public key, as a base64 COSE key or uncompressed P-256 point")
+	verifyAuthenticateCmd.Flags().StringVar(&verifyRegistrationFile, "registration", "", "The register response or WebAuthn registration credential JSON to take the public key from")
+	verifyAuthenticateCmd.Flags().Int64Var(&verifyCounter, "counter", -1, "The counter stored from the previous authentication")
+}
+
+func overrideVerifyRequest(challenge, appId, facet *string) {
+	if verifyChallenge != "" {
+		*challenge = verifyChallenge
+	}
+	if verifyAppId != "" {
+		*appId = verifyAppId
+	}
+	if verifyFacet != "" {
+		*facet = verifyFacet
+	}
+	if *challenge == "" || *appId == "" || *facet == "" {
+		exitWithError(exitError, "Must specify the challenge, app id and facet, with --request or flags")
+	}
+}
+
+func readVerifyResponse() []byte {
+	if verifyRequestFile == "-" && verifyResponseFile == "-" {
+		exitWithError(exitError, "Only one of --request and --response can be read from stdin")
+	}
+	return readRequestFile(verifyResponseFile)
+}
+
+// Returns true if the JSON is a WebAuthn credential rather than a U2F response.
+func isWebAuthnCredential(data []byte) bool {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(data, &members) != nil {
+		return false
+	}
+	_, ok := members["rawId"]
+	return ok
+}
+
+// Returns the challenge, app id and facet of a u2f-api.js register request or
+// WebAuthn creation options.
+func verifyRegisterRequest(data []byte) (string, string, string) {
+	if isWebAuthnOptions(data) {
+		options, err := u2f.ParseCreationOptions(data)
+		if err != nil {
+			exitWithError(exitError, "Invalid WebAuthn options: %s", err)
+		}
+		rpId, facet := webAuthnRPID(options.RP.ID, verifyFacet)
+		return base64.RawURLEncoding.EncodeToString(options.Challenge), rpId, facet
+	}
+	request, _ := registerRequestFromJson(data)
+	return request.Challenge, request.AppId, request.Facet
+}
+
+// Parses a U2F RegisterResponse for the app id, or the registration credential
+// printed for WebAuthn creation options.
+func parseVerifyRegistration(data []byte, appId string) *verifyRegistration {
+	if isWebAuthnCredential(data) {
+		credential, err := u2f.ParseRegistrationCredential(data)
+		if err != nil {
+			exitWithError(exitError, "%s", err)
+		}
+		response, err := u2f.ParseAttestationObject(credential.Response.AttestationObject)
+		if err != nil {
+			exitWithError(exitError, "%s", err)
+		}
+		return &verifyRegistration{response, credential.Response.ClientDataJSON, true}
+	}
+	var response u2f.RegisterResponse
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		exitWithError(exitError, "Invalid response JSON: %s", err)
+	}
+	clientData, err := base64.RawURLEncoding.DecodeString(response.ClientData)
+	if err != nil {
+		exitWithError(exitError, "Invalid client data: %s", err)
+	}
+	credential, err := u2f.ParseRegisterResponse(&response, appId)
+	if err != nil {
+		exitWithError(exitError, "%s", err)
+	}
+	return &verifyRegistration{credential, clientData, false}
+}
+
+// Parses a U2F AuthenticateResponse, or the authentication credential printed
+// for WebAuthn request options.
+func parseVerifyAuthentication(data []byte) *u2f.AuthenticateResponse {
+	if isWebAuthnCredential(data) {
+		credential, err := u2f.ParseAuthenticationCredential(data)
+		if err != nil {
+			exitWithError(exitError, "%s", err)
+		}
+		return authenticateResponseFromCredential(credential)
+	}
+	var response u2f.AuthenticateResponse
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		exitWithError(exitError, "Invalid response JSON: %s", err)
+	}
+	return &response
+}
+
+// Returns the request for the key handle of the response, or the first request.
+func matchingAuthenticateRequest(data []byte, keyHandle string) *u2f.AuthenticateRequest {
+	if isWebAuthnOptions(data) {
+		return authenticateRequestFromOptions(data, keyHandle)
+	}
+	requests := authenticateRequestsFromJson(data)
+	if len(requests) == 0 {
+		return &u2f.AuthenticateRequest{KeyHandle: keyHandle}
+	}
+	for _, request := range requests {
+		if request.KeyHandle == keyHandle {
+			return request
+		}
+	}
+	return requests[0]
+}
+
+// Returns a WebAuthn mode AuthenticateRequest for the key handle from the request options.
+func authenticateRequestFromOptions(data []byte, keyHandle string) *u2f.AuthenticateRequest {
+	options, err := u2f.ParseRequestOptions(data)
+	if err != nil {
+		exitWithError(exitError, "Invalid WebAuthn options: %s", err)
+	}
+	rpId, facet := webAuthnRPID(options.RPID, verifyFacet)
+	request := &u2f.AuthenticateRequest{
+		Challenge: base64.RawURLEncoding.EncodeToString(options.Challenge),
+		AppId:     rpId,
+		Facet:     facet,
+		KeyHandle: keyHandle,
+		WebAuthn:  true,
+	}
+	if options.Extensions != nil {
+		request.AppIdExtension = options.Extensions.AppID
+	}
+	return request
+}
+
+// Returns the COSE encoded public key from --public-key or --registration.
+func verifyRegisteredKey(appId string) []byte {
+	if verifyRegistrationFile != "" {
+		registration := parseVerifyRegistration(readRequestFile(verifyRegistrationFile), appId)
+		result, err := u2f.VerifyAttestation(registration.credential, sha256Sum(registration.clientDataJSON), nil)
+		if err != nil {
+			exitWithError(exitError, "Invalid registration for app id %q: %s", appId, err)
+		}
+		return result.AuthenticatorData.CredentialPublicKey
+	}
+	if verifyPublicKey == "" {
+		exitWithError(exitError, "Must specify --public-key or --registration")
+	}
+	return parsePublicKey(verifyPublicKey)
+}
+
+// Parses a base64url COSE key, or an uncompressed P-256 point which is converted
+// to a COSE key. Standard base64 is also accepted, as used by the credential store.
+func parsePublicKey(value string) []byte {
+	key, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil {
+		exitWithError(exitError, "Invalid public key: %s", err)
+	}
+	if x, y := elliptic.Unmarshal(elliptic.P256(), key); x != nil {
+		key, err = u2f.MarshalCOSEKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+		if err != nil {
+			exitWithError(exitError, "Invalid public key: %s", err)
+		}
+	}
+	return key
+}
+
+func (r *verifyReport) field(name, value string) {
+	r.Fields = append(r.Fields, verifyField{name, value})
+}
+
+func (r *verifyReport) check(name string, ok bool, detail string) {
+	r.Checks = append(r.Checks, verifyCheck{name, ok, detail})
+}
+
+// Parses the client data JSON, adding it to the report.
+func (r *verifyReport) clientData(data []byte) *u2f.ResponseClientData {
+	r.field("clientData", string(data))
+	r.field("clientData sha256", hex.EncodeToString(sha256Sum(data)))
+	clientData, err := u2f.ParseResponseClientData(data)
+	if err != nil {
+		r.check("clientData encoding", false, err.Error())
+		return nil
+	}
+	return clientData
+}
+
+func (r *verifyReport) checkClientData(clientData *u2f.ResponseClientData, typ, challenge, origin string) {
+	if clientData == nil {
+		return
+	}
+	r.checkEqual("clientData type", typ, clientData.Type)
+	r.checkEqual("challenge", challenge, clientData.Challenge)
+	r.checkEqual("origin", origin, clientData.Origin)
+}
+
+func (r *verifyReport) checkEqual(name, expected, actual string) {
+	if expected == actual {
+		r.check(name, true, actual)
+	} else {
+		r.check(name, false, fmt.Sprintf("expected %q but got %q", expected, actual))
+	}
+}
+
+// Checks the hash of the app id or RP ID. WebAuthn responses include the hash,
+// but U2F responses do not, so their signed data is rebuilt with the hash of the
+// app id and a wrong app id shows up as an invalid signature.
+func (r *verifyReport) checkAppIdHash(appId string, rpIdHash []byte, webAuthn bool, signatureErr error) {
+	expected := sha256Sum([]byte(appId))
+	detail := fmt.Sprintf("sha256(%q) is %x", appId, expected)
+	if webAuthn {
+		if bytes.Equal(rpIdHash, expected) {
+			r.check("appId hash", true, detail)
+		} else {
+			r.check("appId hash", false, fmt.Sprintf("%s but the authenticator data has %x", detail, rpIdHash))
+		}
+	} else if signatureErr != nil {
+		r.check("appId hash", false, detail+", the signature does not verify with it, so the response may be for a different app id")
+	} else {
+		r.check("appId hash", true, detail+", verified by the signature")
+	}
+}
+
+func (r *verifyReport) checkSignature(appId string, webAuthn bool, err error) {
+	if err == nil {
+		r.check("signature", true, "")
+	} else if webAuthn {
+		r.check("signature", false, err.Error())
+	} else {
+		r.check("signature", false, fmt.Sprintf("%s, with the signed data rebuilt for app id %q", err, appId))
+	}
+}
+
+// Adds the credential and attestation of a registration to the report.
+func (r *verifyReport) credential(credential *u2f.MakeCredentialResponse) {
+	r.field("format", credential.Format)
+	r.field("keyHandle", base64.RawURLEncoding.EncodeToString(credential.AuthenticatorData.CredentialID))
+	statement := credential.AttestationStatement
+	if x5c, _ := statement.Array("x5c"); len(x5c) > 0 {
+		if der, ok := x5c[0].([]byte); ok {
+			if certificate, err := x509.ParseCertificate(der); err == nil {
+				r.field("attestation subject", certificate.Subject.String())
+				r.field("attestation issuer", certificate.Issuer.String())
+			}
+		}
+	}
+	if signature, ok := statement.Bytes("sig"); ok {
+		r.field("signature", hex.EncodeToString(signature))
+	}
+}
+
+// Decodes the signed authenticator data of the response, adding its fields to the
+// report. U2F responses only include the flags and counter, so their authenticator
+// data is rebuilt with the hash of the app id.
+func (r *verifyReport) authenticatorData(response *u2f.AuthenticateResponse, appId string) *u2f.AuthenticatorData {
+	data, signature, err := u2f.ParseAuthenticateResponse(response, appId)
+	if err != nil {
+		r.check("signatureData encoding", false, err.Error())
+		return nil
+	}
+	authData, err := u2f.ParseAuthenticatorData(data)
+	if err != nil {
+		r.check("authenticatorData encoding", false, err.Error())
+		return nil
+	}
+	r.field("authenticatorData", hex.EncodeToString(data))
+	r.field("flags", fmt.Sprintf("0x%02x", authData.Flags))
+	r.field("counter", fmt.Sprintf("%d", authData.SignCount))
+	r.field("signature", hex.EncodeToString(signature))
+	return authData
+}
+
+// Prints the report, exiting with an error if any of the checks failed.
+func (r *verifyReport) print() {
+	failed := []string{}
+	for _, check := range r.Checks {
+		if !check.Ok {
+			failed = append(failed, check.Name)
+		}
+	}
+	if verifyJson {
+		printJson(r)
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, field := range r.Fields {
+			fmt.Fprintf(writer, "%s\t%s\n", field.Name, field.Value)
+		}
+		fmt.Fprintln(writer)
+		for _, check := range r.Checks {
+			result := "ok"
+			if !check.Ok {
+				result = "FAILED"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", result, check.Name, check.Detail)
+		}
+		writer.Flush()
+	}
+	if len(failed) > 0 {
+		exitWithError(exitError, "Verification failed: %s", strings.Join(failed, ", "))
+	}
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
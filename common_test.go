@@ -1,6 +1,10 @@
 package u2fhost
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
 
 // Common resources for unit tests
 // Some inputs and outputs are taken from the examples at the following url
@@ -25,9 +29,33 @@ type testDevice struct {
 	status   uint16
 	response []byte
 	error    error
+	// Optional handler for apdu requests, takes precedence over the apdu response elements.
+	apduHandler func(instruction, p1, p2 uint8, request []byte) (uint16, []byte)
+
+	// cbor request params
+	command     uint8
+	cborRequest []byte
+
+	// cbor response elements
+	cborStatus   uint8
+	cborResponse []byte
+	keepAlives   []uint8
+	// Optional handler for cbor requests, takes precedence over the cbor response elements.
+	cborHandler func(command uint8, request []byte) (uint8, []byte)
+
+	// Closed when the request is cancelled, if not nil
+	cancelled chan struct{}
+	cancels   int
+
+	winks int
+
+	// capability flags from the INIT response
+	capabilities uint8
 
 	// open error
 	openError error
+
+	info hid.DeviceInfo
 }
 
 func newTestDevice() (*testDevice, *HidDevice) {
@@ -61,5 +89,45 @@ func (d *testDevice) SendAPDU(instruction, p1, p2 uint8, data []byte) (uint16, [
 	d.p1 = p1
 	d.p2 = p2
 	d.request = data
+	if d.apduHandler != nil {
+		status, response := d.apduHandler(instruction, p1, p2, data)
+		return status, response, d.error
+	}
 	return d.status, d.response, d.error
 }
+
+func (d *testDevice) SendCBOR(command uint8, data []byte, keepAlive func(uint8)) (uint8, []byte, error) {
+	d.command = command
+	d.cborRequest = data
+	if keepAlive != nil {
+		for _, status := range d.keepAlives {
+			keepAlive(status)
+		}
+	}
+	if d.cborHandler != nil {
+		status, response := d.cborHandler(command, data)
+		return status, response, d.error
+	}
+	return d.cborStatus, d.cborResponse, d.error
+}
+
+func (d *testDevice) Cancel() error {
+	d.cancels++
+	if d.cancels == 1 && d.cancelled != nil {
+		close(d.cancelled)
+	}
+	return nil
+}
+
+func (d *testDevice) Wink() error {
+	d.winks++
+	return d.error
+}
+
+func (d *testDevice) Capabilities() uint8 {
+	return d.capabilities
+}
+
+func (d *testDevice) Info() hid.DeviceInfo {
+	return d.info
+}
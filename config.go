@@ -0,0 +1,158 @@
+package u2fhost
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The authenticatorConfig command is defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorConfig
+
+// CTAP2 authenticatorConfig subcommands
+const (
+	configSubCommandEnableEnterpriseAttestation uint8 = 0x01
+	configSubCommandToggleAlwaysUv              uint8 = 0x02
+	configSubCommandSetMinPINLength             uint8 = 0x03
+)
+
+// CTAP2 authenticatorConfig parameter keys
+const (
+	configSubCommand        = 0x01
+	configSubCommandParams  = 0x02
+	configPinUvAuthProtocol = 0x03
+	configPinUvAuthParam    = 0x04
+)
+
+// CTAP2 setMinPINLength subcommand parameter keys
+const (
+	configParamNewMinPINLength   = 0x01
+	configParamMinPinLengthRPIDs = 0x02
+	configParamForceChangePin    = 0x03
+)
+
+// The options for changing the minimum PIN length.
+type MinPINLengthOptions struct {
+	// The new minimum PIN length in code points, 0 leaves it unchanged.
+	// The minimum PIN length can only be increased.
+	Length int
+	// The RP IDs that may read the minimum PIN length with the minPinLength extension.
+	RPIDs []string
+	// Require the PIN to be changed before the device can be used again.
+	ForceChangePin bool
+}
+
+// Enables enterprise attestation, allowing relying parties on the
+// authenticator's enterprise list to request uniquely identifying attestation.
+// The token must have the PermissionAuthenticatorConfig permission,
+// it may be nil if the device does not have a PIN set.
+func (dev *HidDevice) EnableEnterpriseAttestation(token *PinUvAuthToken) error {
+	err := dev.checkConfigOption("ep")
+	if err != nil {
+		return err
+	}
+	_, err = dev.callConfig(token, configSubCommandEnableEnterpriseAttestation, nil)
+	return err
+}
+
+// Toggles the alwaysUv option, which requires user verification for every operation,
+// and returns whether it is now enabled.
+// The token must have the PermissionAuthenticatorConfig permission,
+// it may be nil if the device does not have a PIN set.
+func (dev *HidDevice) ToggleAlwaysUv(token *PinUvAuthToken) (bool, error) {
+	err := dev.checkConfigOption("alwaysUv")
+	if err != nil {
+		return false, err
+	}
+	_, err = dev.callConfig(token, configSubCommandToggleAlwaysUv, nil)
+	if err != nil {
+		return false, err
+	}
+	info, err := dev.GetInfo()
+	if err != nil {
+		return false, err
+	}
+	_, enabled := info.Option("alwaysUv")
+	return enabled, nil
+}
+
+// Sets the minimum PIN length, the RP IDs allowed to read it and whether
+// the PIN must be changed.
+// The token must have the PermissionAuthenticatorConfig permission,
+// it may be nil if the device does not have a PIN set.
+func (dev *HidDevice) SetMinPINLength(token *PinUvAuthToken, options MinPINLengthOptions) error {
+	err := dev.checkConfigOption("setMinPINLength")
+	if err != nil {
+		return err
+	}
+	info, err := dev.GetInfo()
+	if err != nil {
+		return err
+	}
+	if len(options.RPIDs) > info.MaxRPIDsForSetMinPINLength {
+		return fmt.Errorf("Device allows at most %d RP IDs to read the minimum PIN length", info.MaxRPIDsForSetMinPINLength)
+	}
+	params := cbor.Map{}
+	if options.Length > 0 {
+		params[configParamNewMinPINLength] = options.Length
+	}
+	if len(options.RPIDs) > 0 {
+		params[configParamMinPinLengthRPIDs] = options.RPIDs
+	}
+	if options.ForceChangePin {
+		params[configParamForceChangePin] = true
+	}
+	_, err = dev.callConfig(token, configSubCommandSetMinPINLength, params)
+	return err
+}
+
+// Returns an error if the device does not support authenticatorConfig or the option.
+func (dev *HidDevice) checkConfigOption(option string) error {
+	info, err := dev.GetInfo()
+	if err != nil {
+		return err
+	}
+	if supported, _ := info.Option("authnrCfg"); !supported {
+		return errors.New("Device does not support authenticator config")
+	}
+	if supported, _ := info.Option(option); !supported {
+		return fmt.Errorf("Device does not support the %s option", option)
+	}
+	return nil
+}
+
+// Sends the config subcommand, authenticated with the token if it is not nil.
+func (dev *HidDevice) callConfig(token *PinUvAuthToken, subCommand uint8, subCommandParams cbor.Map) (cbor.Map, error) {
+	params := cbor.Map{configSubCommand: subCommand}
+	if len(subCommandParams) > 0 {
+		params[configSubCommandParams] = subCommandParams
+	}
+	if token != nil {
+		message, err := configAuthMessage(subCommand, subCommandParams)
+		if err != nil {
+			return nil, err
+		}
+		params[configPinUvAuthProtocol] = token.protocol.version()
+		params[configPinUvAuthParam] = token.authenticate(message)
+	}
+	return dev.callCTAP2(ctap2CommandConfig, params)
+}
+
+// Returns the message authenticated by the pinUvAuthParam, which is
+// 32 bytes of 0xff, the command, the subcommand and the encoded subcommand parameters.
+func configAuthMessage(subCommand uint8, subCommandParams cbor.Map) ([]byte, error) {
+	message := make([]byte, 32, 34)
+	for i := range message {
+		message[i] = 0xff
+	}
+	message = append(message, ctap2CommandConfig, subCommand)
+	if len(subCommandParams) > 0 {
+		encoded, err := cbor.Marshal(subCommandParams)
+		if err != nil {
+			return nil, err
+		}
+		message = append(message, encoded...)
+	}
+	return message, nil
+}
@@ -0,0 +1,153 @@
+package u2fhost
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// Emulates the authenticatorConfig command, updating the GetInfo options.
+type testConfig struct {
+	authenticator *testAuthenticator
+	options       cbor.Map
+	minPINLength  int64
+	rpIDs         []string
+	forceChange   bool
+}
+
+func newTestConfig(t *testing.T) (*testConfig, *HidDevice) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	authenticator.pin = "1234"
+	config := &testConfig{
+		authenticator: authenticator,
+		options: cbor.Map{
+			"clientPin":       true,
+			"pinUvAuthToken":  true,
+			"authnrCfg":       true,
+			"ep":              false,
+			"alwaysUv":        false,
+			"setMinPINLength": true,
+		},
+		minPINLength: 4,
+	}
+	authenticator.info[getInfoOptions] = config.options
+	authenticator.info[getInfoMaxRPIDsForSetMinPINLength] = 2
+	authenticator.commands[ctap2CommandConfig] = config.handle
+	return config, dev
+}
+
+func (c *testConfig) handle(params cbor.Map) (cbor.Map, uint8) {
+	subCommand, _ := params.Int(configSubCommand)
+	subCommandParams, _ := params.Map(configSubCommandParams)
+	message, _ := configAuthMessage(uint8(subCommand), subCommandParams)
+	param, _ := params.Bytes(configPinUvAuthParam)
+	if !c.authenticator.verifyPinUvAuthParam(param, message) {
+		return nil, ctap2StatusPinAuthInvalid
+	}
+	if c.authenticator.pinPermissions&int64(PermissionAuthenticatorConfig) == 0 {
+		return nil, ctap2StatusPinAuthInvalid
+	}
+	switch uint8(subCommand) {
+	case configSubCommandEnableEnterpriseAttestation:
+		c.options["ep"] = true
+	case configSubCommandToggleAlwaysUv:
+		c.options["alwaysUv"] = !c.options["alwaysUv"].(bool)
+	case configSubCommandSetMinPINLength:
+		length, ok := subCommandParams.Int(configParamNewMinPINLength)
+		if ok && length < c.minPINLength {
+			return nil, ctap2StatusPinPolicyViolation
+		}
+		if ok {
+			c.minPINLength = length
+		}
+		c.rpIDs = cborStrings(subCommandParams, configParamMinPinLengthRPIDs)
+		c.forceChange, _ = subCommandParams.Bool(configParamForceChangePin)
+	default:
+		return nil, ctap2StatusInvalidOption
+	}
+	return cbor.Map{}, ctap2StatusOK
+}
+
+func TestAuthenticatorConfig(t *testing.T) {
+	config, dev := newTestConfig(t)
+
+	// The token must have the acfg permission
+	token, err := dev.GetPinUvAuthToken("1234", PermissionMakeCredential, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	err = dev.EnableEnterpriseAttestation(token)
+	if _, ok := err.(*PinAuthInvalidError); !ok {
+		t.Errorf("Expected PinAuthInvalidError, but got %#v", err)
+	}
+
+	token, err = dev.GetPinUvAuthToken("1234", PermissionAuthenticatorConfig, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	err = dev.EnableEnterpriseAttestation(token)
+	if err != nil || !config.options["ep"].(bool) {
+		t.Errorf("Expected enterprise attestation to be enabled, but got %s", err)
+	}
+
+	enabled, err := dev.ToggleAlwaysUv(token)
+	if err != nil || !enabled {
+		t.Errorf("Expected alwaysUv to be enabled, but got %t %s", enabled, err)
+	}
+	enabled, err = dev.ToggleAlwaysUv(token)
+	if err != nil || enabled {
+		t.Errorf("Expected alwaysUv to be disabled, but got %t %s", enabled, err)
+	}
+
+	err = dev.SetMinPINLength(token, MinPINLengthOptions{Length: 8, RPIDs: []string{"example.com"}, ForceChangePin: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if config.minPINLength != 8 || !reflect.DeepEqual(config.rpIDs, []string{"example.com"}) || !config.forceChange {
+		t.Errorf("Expected min PIN length 8 for example.com with force change, but got %d %v %t", config.minPINLength, config.rpIDs, config.forceChange)
+	}
+	request, _ := config.authenticator.requests[ctap2CommandConfig].Map(configSubCommandParams)
+	if _, ok := request.Get(configParamNewMinPINLength); !ok {
+		t.Errorf("Expected the new min PIN length in the request")
+	}
+
+	// The minimum length can not be decreased
+	err = dev.SetMinPINLength(token, MinPINLengthOptions{Length: 6})
+	if _, ok := err.(*PinPolicyViolationError); !ok {
+		t.Errorf("Expected PinPolicyViolationError, but got %#v", err)
+	}
+
+	// Too many RP IDs
+	err = dev.SetMinPINLength(token, MinPINLengthOptions{RPIDs: []string{"a.com", "b.com", "c.com"}})
+	if err == nil {
+		t.Errorf("Expected error for too many RP IDs")
+	}
+}
+
+func TestAuthenticatorConfigUnsupported(t *testing.T) {
+	config, dev := newTestConfig(t)
+	delete(config.options, "ep")
+	err := dev.EnableEnterpriseAttestation(nil)
+	if err == nil {
+		t.Errorf("Expected error for device without enterprise attestation")
+	}
+
+	_, _, dev = newTestAuthenticator(t)
+	_, err = dev.ToggleAlwaysUv(nil)
+	if err == nil {
+		t.Errorf("Expected error for device without authenticator config")
+	}
+}
+
+func TestConfigAuthMessage(t *testing.T) {
+	message, err := configAuthMessage(configSubCommandSetMinPINLength, cbor.Map{configParamNewMinPINLength: 6})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := append(bytes.Repeat([]byte{0xff}, 32), 0x0d, 0x03, 0xa1, 0x01, 0x06)
+	if !reflect.DeepEqual(message, expected) {
+		t.Errorf("Expected %x, but got %x", expected, message)
+	}
+}
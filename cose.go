@@ -0,0 +1,79 @@
+package u2fhost
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// COSE_Key parameters
+// https://www.rfc-editor.org/rfc/rfc8152.html#section-13
+const (
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseKeyCurve = -1
+	coseKeyX     = -2
+	coseKeyY     = -3
+)
+
+// COSE key types, curves and algorithms
+const (
+	coseKeyTypeEC2       = 2
+	coseCurveP256        = 1
+	coseAlgES256         = -7
+	coseAlgECDHESHKDF256 = -25
+)
+
+// Returns the COSE_Key representation of the P-256 public key.
+func coseKeyFromECDSA(key *ecdsa.PublicKey, alg int) cbor.Map {
+	return cbor.Map{
+		coseKeyType:  coseKeyTypeEC2,
+		coseKeyAlg:   alg,
+		coseKeyCurve: coseCurveP256,
+		coseKeyX:     padBytes(key.X.Bytes(), 32),
+		coseKeyY:     padBytes(key.Y.Bytes(), 32),
+	}
+}
+
+// Returns the COSE_Key encoding of the P-256 public key for ES256 signatures,
+// which is the form of a CredentialPublicKey.
+func MarshalCOSEKey(key *ecdsa.PublicKey) ([]byte, error) {
+	return cbor.Marshal(coseKeyFromECDSA(key, coseAlgES256))
+}
+
+// Returns the P-256 public key represented by the COSE_Key.
+func ecdsaFromCOSEKey(key cbor.Map) (*ecdsa.PublicKey, error) {
+	kty, _ := key.Int(coseKeyType)
+	crv, _ := key.Int(coseKeyCurve)
+	if kty != coseKeyTypeEC2 || crv != coseCurveP256 {
+		return nil, errors.New("Unsupported COSE key, expected an EC2 P-256 key")
+	}
+	x, ok := key.Bytes(coseKeyX)
+	if !ok || len(x) != 32 {
+		return nil, errors.New("Invalid COSE key x coordinate")
+	}
+	y, ok := key.Bytes(coseKeyY)
+	if !ok || len(y) != 32 {
+		return nil, errors.New("Invalid COSE key y coordinate")
+	}
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+		return nil, errors.New("COSE key is not on the P-256 curve")
+	}
+	return publicKey, nil
+}
+
+// Left pads the bytes with zeros to the given length.
+func padBytes(b []byte, length int) []byte {
+	if len(b) >= length {
+		return b
+	}
+	return append(make([]byte, length-len(b)), b...)
+}
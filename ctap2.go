@@ -0,0 +1,110 @@
+package u2fhost
+
+import (
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
+
+// The CTAP2 message structure is defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html
+
+// CTAP2 Commands
+const (
+	ctap2CommandMakeCredential uint8 = 0x01 // Create a new credential
+	ctap2CommandGetAssertion   uint8 = 0x02 // Sign with an existing credential
+	ctap2CommandGetInfo        uint8 = 0x04 // Report the authenticator capabilities
+	ctap2CommandClientPIN      uint8 = 0x06 // PIN and key agreement operations
+	ctap2CommandReset          uint8 = 0x07 // Reset the authenticator back to factory settings
+	ctap2CommandBioEnrollment  uint8 = 0x09 // Manage fingerprint enrollments
+	ctap2CommandSelection      uint8 = 0x0B // Wait for the user to touch the authenticator
+	ctap2CommandLargeBlobs     uint8 = 0x0C // Read and write the large-blob array
+	ctap2CommandConfig         uint8 = 0x0D // Configure authenticator features
+
+	ctap2CommandBioEnrollmentPreview uint8 = 0x40 // Bio enrollment on CTAP2.1 pre-release devices
+)
+
+// CTAP2 Status Codes
+const (
+	ctap2StatusOK                 uint8 = 0x00
+	ctap2StatusCredentialExcluded uint8 = 0x19
+	ctap2StatusOperationDenied    uint8 = 0x27
+	ctap2StatusInvalidOption      uint8 = 0x2C
+	ctap2StatusKeepAliveCancel    uint8 = 0x2D
+	ctap2StatusNoCredentials      uint8 = 0x2E
+	ctap2StatusUserActionTimeout  uint8 = 0x2F
+	ctap2StatusNotAllowed         uint8 = 0x30
+	ctap2StatusPinInvalid         uint8 = 0x31
+	ctap2StatusPinBlocked         uint8 = 0x32
+	ctap2StatusPinAuthInvalid     uint8 = 0x33
+	ctap2StatusPinAuthBlocked     uint8 = 0x34
+	ctap2StatusPinNotSet          uint8 = 0x35
+	ctap2StatusPinRequired        uint8 = 0x36
+	ctap2StatusPinPolicyViolation uint8 = 0x37
+)
+
+// The type of all WebAuthn credentials.
+const credentialTypePublicKey = "public-key"
+
+// A KeepAliveStatus is reported by a CTAP2 authenticator while it processes a request.
+type KeepAliveStatus uint8
+
+const (
+	// The authenticator is still processing the request.
+	KeepAliveProcessing KeepAliveStatus = KeepAliveStatus(hid.STATUS_PROCESSING)
+	// The authenticator is waiting for the user to touch it.
+	KeepAliveUserPresenceNeeded KeepAliveStatus = KeepAliveStatus(hid.STATUS_UPNEEDED)
+)
+
+// Sets a function that is called with the status of every keep alive message
+// the device sends while processing a CTAP2 request, and with
+// KeepAliveUserPresenceNeeded while an Authenticator waits for a U2F device to be touched.
+// This can be used to prompt the user to touch the device.
+func (dev *HidDevice) OnKeepAlive(handler func(KeepAliveStatus)) {
+	dev.keepAlive = handler
+}
+
+// Aborts the CTAP2 request in progress, which then fails with a KeepAliveCancelError.
+// It is safe to call from another goroutine while the request waits for the user.
+func (dev *HidDevice) Cancel() error {
+	return dev.hidDevice.Cancel()
+}
+
+// Sends the CTAP2 command to the device, returning the response if
+// the device responded with a successful status.
+func (dev *HidDevice) sendCTAP2(command uint8, request []byte) ([]byte, error) {
+	var keepAlive func(uint8)
+	if dev.keepAlive != nil {
+		keepAlive = func(status uint8) {
+			dev.keepAlive(KeepAliveStatus(status))
+		}
+	}
+	status, response, err := dev.hidDevice.SendCBOR(command, request, keepAlive)
+	if err != nil {
+		return nil, err
+	}
+	if status != ctap2StatusOK {
+		return nil, ctap2error(status)
+	}
+	return response, nil
+}
+
+// Sends the CTAP2 command with the CBOR encoded parameters to the device,
+// returning the decoded response map.
+func (dev *HidDevice) callCTAP2(command uint8, params cbor.Map) (cbor.Map, error) {
+	var request []byte
+	var err error
+	if params != nil {
+		request, err = cbor.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+	response, err := dev.sendCTAP2(command, request)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) == 0 {
+		return cbor.Map{}, nil
+	}
+	return cbor.UnmarshalMap(response)
+}
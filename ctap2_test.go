@@ -0,0 +1,342 @@
+package u2fhost
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// A testAuthenticator emulates a CTAP2 authenticator, it is used as the
+// cborHandler of a testDevice.
+type testAuthenticator struct {
+	t *testing.T
+
+	// The getInfo response
+	info cbor.Map
+	// If set, returned as the status for every request
+	status uint8
+	// The last decoded request for each command
+	requests map[uint8]cbor.Map
+	// Handlers for commands that are emulated by individual tests
+	commands map[uint8]func(params cbor.Map) (cbor.Map, uint8)
+
+	keyAgreement  *ecdsa.PrivateKey
+	credentialKey *ecdsa.PrivateKey
+	credentialID  []byte
+	credRandom    []byte
+	largeBlobKey  []byte
+	credBlob      []byte
+	signCount     uint32
+
+	// The PIN, and the token returned after verifying it
+	pin            string
+	pinToken       []byte
+	pinProtocol    pinUvAuthProtocol
+	pinPermissions int64
+
+	// The serialized large-blob array, and the pending array while it is written
+	largeBlobs              []byte
+	pendingLargeBlobs       []byte
+	pendingLargeBlobsLength int64
+}
+
+func newTestAuthenticator(t *testing.T) (*testAuthenticator, *testDevice, *HidDevice) {
+	keyAgreement, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credentialKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	authenticator := &testAuthenticator{
+		t: t,
+		info: cbor.Map{
+			getInfoVersions:           []string{"U2F_V2", "FIDO_2_0", "FIDO_2_1"},
+			getInfoExtensions:         []string{extensionHmacSecret},
+			getInfoAAGUID:             make([]byte, 16),
+			getInfoOptions:            cbor.Map{"rk": true, "up": true, "clientPin": false},
+			getInfoPinUvAuthProtocols: []int{2, 1},
+		},
+		requests:      map[uint8]cbor.Map{},
+		commands:      map[uint8]func(params cbor.Map) (cbor.Map, uint8){},
+		keyAgreement:  keyAgreement,
+		credentialKey: credentialKey,
+		credentialID:  []byte("test credential id"),
+		credRandom:    []byte("0123456789abcdef0123456789abcdef"),
+		largeBlobKey:  []byte("fedcba9876543210fedcba9876543210"),
+		pinToken:      []byte("0123456789abcdef0123456789abcdef"),
+		largeBlobs:    append([]byte{0x80}, sha256([]byte{0x80})[:16]...),
+	}
+	testHid, dev := newTestDevice()
+	testHid.cborHandler = authenticator.handle
+	return authenticator, testHid, dev
+}
+
+func (a *testAuthenticator) handle(command uint8, request []byte) (uint8, []byte) {
+	params := cbor.Map{}
+	if len(request) > 0 {
+		var err error
+		params, err = cbor.UnmarshalMap(request)
+		if err != nil {
+			a.t.Fatalf("Invalid CBOR request for command %#x: %s", command, err)
+		}
+	}
+	a.requests[command] = params
+	if a.status != ctap2StatusOK {
+		return a.status, nil
+	}
+	var response cbor.Map
+	if handler, ok := a.commands[command]; ok {
+		var status uint8
+		response, status = handler(params)
+		if status != ctap2StatusOK {
+			return status, nil
+		}
+		command = 0
+	}
+	switch command {
+	case 0:
+	case ctap2CommandGetInfo:
+		response = a.info
+	case ctap2CommandClientPIN:
+		response = a.clientPIN(params)
+	case ctap2CommandMakeCredential:
+		response = a.makeCredential(params)
+	case ctap2CommandGetAssertion:
+		response = a.getAssertion(params)
+	case ctap2CommandLargeBlobs:
+		var status uint8
+		response, status = a.largeBlobCommand(params)
+		if status != ctap2StatusOK {
+			return status, nil
+		}
+	default:
+		return 0x01, nil
+	}
+	if response == nil {
+		return 0x02, nil
+	}
+	encoded, err := cbor.Marshal(response)
+	if err != nil {
+		a.t.Fatalf("Failed to marshal response: %s", err)
+	}
+	return ctap2StatusOK, encoded
+}
+
+func (a *testAuthenticator) clientPIN(params cbor.Map) cbor.Map {
+	subCommand, _ := params.Int(clientPINSubCommand)
+	switch uint8(subCommand) {
+	case clientPINSubCommandGetKeyAgreement:
+		return cbor.Map{clientPINResponseKeyAgreement: coseKeyFromECDSA(&a.keyAgreement.PublicKey, coseAlgECDHESHKDF256)}
+	case clientPINSubCommandGetPinToken, clientPINSubCommandGetPinUvAuthTokenUsingPinWithPermissions:
+		version, _ := params.Int(clientPINProtocol)
+		platformKey, _ := params.Map(clientPINKeyAgreement)
+		protocol, secret := a.sharedSecret(version, platformKey)
+		pinHashEnc, _ := params.Bytes(clientPINPinHashEnc)
+		pinHash, err := protocol.decrypt(secret, pinHashEnc)
+		if err != nil || string(pinHash) != string(sha256([]byte(a.pin))[:16]) {
+			return nil
+		}
+		a.pinProtocol = protocol
+		a.pinPermissions, _ = params.Int(clientPINPermissions)
+		tokenEnc, _ := protocol.encrypt(secret, a.pinToken)
+		return cbor.Map{clientPINResponsePinUvAuthToken: tokenEnc}
+	}
+	return nil
+}
+
+// Checks the pinUvAuthParam if the authenticator has a PIN.
+func (a *testAuthenticator) verifyPinUvAuthParam(param, message []byte) bool {
+	if a.pin == "" {
+		return true
+	}
+	return a.pinProtocol != nil && string(a.pinProtocol.authenticate(a.pinToken, message)) == string(param)
+}
+
+func (a *testAuthenticator) largeBlobCommand(params cbor.Map) (cbor.Map, uint8) {
+	offset, _ := params.Int(largeBlobsOffset)
+	if length, ok := params.Int(largeBlobsGet); ok {
+		end := offset + length
+		if end > int64(len(a.largeBlobs)) {
+			end = int64(len(a.largeBlobs))
+		}
+		return cbor.Map{largeBlobsResponseConfig: a.largeBlobs[offset:end]}, ctap2StatusOK
+	}
+	fragment, _ := params.Bytes(largeBlobsSet)
+	param, _ := params.Bytes(largeBlobsPinUvAuthParam)
+	if !a.verifyPinUvAuthParam(param, largeBlobsAuthMessage(int(offset), fragment)) {
+		return nil, ctap2StatusPinAuthInvalid
+	}
+	if offset == 0 {
+		a.pendingLargeBlobs = []byte{}
+		a.pendingLargeBlobsLength, _ = params.Int(largeBlobsLength)
+	}
+	if offset != int64(len(a.pendingLargeBlobs)) {
+		return nil, 0x02
+	}
+	a.pendingLargeBlobs = append(a.pendingLargeBlobs, fragment...)
+	if int64(len(a.pendingLargeBlobs)) == a.pendingLargeBlobsLength {
+		a.largeBlobs = a.pendingLargeBlobs
+	}
+	return cbor.Map{}, ctap2StatusOK
+}
+
+// Derives the shared secret from the platform key agreement key, as the authenticator would.
+func (a *testAuthenticator) sharedSecret(protocolVersion int64, platformKey cbor.Map) (pinUvAuthProtocol, []byte) {
+	var protocol pinUvAuthProtocol = pinUvAuthProtocolOne{}
+	if protocolVersion == 2 {
+		protocol = pinUvAuthProtocolTwo{}
+	}
+	key, err := ecdsaFromCOSEKey(platformKey)
+	if err != nil {
+		a.t.Fatalf("Invalid platform key agreement key: %s", err)
+	}
+	x, _ := elliptic.P256().ScalarMult(key.X, key.Y, a.keyAgreement.D.Bytes())
+	return protocol, protocol.kdf(padBytes(x.Bytes(), 32))
+}
+
+func (a *testAuthenticator) authData(rpID string, flags uint8, attested []byte, extensions cbor.Map) []byte {
+	a.signCount++
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.signCount)
+	if attested != nil {
+		flags |= authDataFlagAttestedCredentialData
+	}
+	var encodedExtensions []byte
+	if len(extensions) > 0 {
+		flags |= authDataFlagExtensionDataIncluded
+		encodedExtensions, _ = cbor.Marshal(extensions)
+	}
+	data := append(sha256([]byte(rpID)), flags)
+	data = append(data, counter...)
+	data = append(data, attested...)
+	return append(data, encodedExtensions...)
+}
+
+func (a *testAuthenticator) makeCredential(params cbor.Map) cbor.Map {
+	rp, _ := params.Map(makeCredentialRP)
+	rpID, _ := rp.String("id")
+	publicKey, _ := cbor.Marshal(coseKeyFromECDSA(&a.credentialKey.PublicKey, coseAlgES256))
+	attested := append(make([]byte, 16), byte(len(a.credentialID)>>8), byte(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+	extensions := cbor.Map{}
+	if requested, ok := params.Map(makeCredentialExtensions); ok {
+		if hmacSecret, _ := requested.Bool(extensionHmacSecret); hmacSecret {
+			extensions[extensionHmacSecret] = true
+		}
+		if policy, ok := requested.Int(extensionCredProtect); ok {
+			extensions[extensionCredProtect] = policy
+		}
+		if credBlob, ok := requested.Bytes(extensionCredBlob); ok {
+			a.credBlob = credBlob
+			extensions[extensionCredBlob] = true
+		}
+		if minPinLength, _ := requested.Bool(extensionMinPinLength); minPinLength {
+			extensions[extensionMinPinLength] = 4
+		}
+	}
+	response := cbor.Map{
+		makeCredentialResponseFormat:   "none",
+		makeCredentialResponseAuthData: a.authData(rpID, authDataFlagUserPresent, attested, extensions),
+		makeCredentialResponseAttStmt:  cbor.Map{},
+	}
+	if requested, ok := params.Map(makeCredentialExtensions); ok {
+		if largeBlobKey, _ := requested.Bool(extensionLargeBlobKey); largeBlobKey {
+			response[makeCredentialResponseLargeBlobKey] = a.largeBlobKey
+		}
+	}
+	return response
+}
+
+func (a *testAuthenticator) getAssertion(params cbor.Map) cbor.Map {
+	rpID, _ := params.String(getAssertionRPID)
+	clientDataHash, _ := params.Bytes(getAssertionClientDataHash)
+	extensions := cbor.Map{}
+	if requested, ok := params.Map(getAssertionExtensions); ok {
+		if input, ok := requested.Map(extensionHmacSecret); ok {
+			platformKey, _ := input.Map(hmacSecretKeyAgreement)
+			version, ok := input.Int(hmacSecretPinUvAuthProtocol)
+			if !ok {
+				version = 1
+			}
+			protocol, secret := a.sharedSecret(version, platformKey)
+			saltEnc, _ := input.Bytes(hmacSecretSaltEnc)
+			saltAuth, _ := input.Bytes(hmacSecretSaltAuth)
+			if string(protocol.authenticate(secret, saltEnc)) != string(saltAuth) {
+				return nil
+			}
+			salts, err := protocol.decrypt(secret, saltEnc)
+			if err != nil {
+				return nil
+			}
+			outputs := []byte{}
+			for i := 0; i < len(salts); i += 32 {
+				outputs = append(outputs, hmacSha256(a.credRandom, salts[i:i+32])...)
+			}
+			extensions[extensionHmacSecret], _ = protocol.encrypt(secret, outputs)
+		}
+		if credBlob, _ := requested.Bool(extensionCredBlob); credBlob {
+			extensions[extensionCredBlob] = a.credBlob
+		}
+	}
+	authData := a.authData(rpID, authDataFlagUserPresent, nil, extensions)
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.credentialKey, sha256(append(append([]byte{}, authData...), clientDataHash...)))
+	response := cbor.Map{
+		getAssertionResponseCredential: cbor.Map{"id": a.credentialID, "type": credentialTypePublicKey},
+		getAssertionResponseAuthData:   authData,
+		getAssertionResponseSignature:  signature,
+	}
+	if requested, ok := params.Map(getAssertionExtensions); ok {
+		if largeBlobKey, _ := requested.Bool(extensionLargeBlobKey); largeBlobKey {
+			response[getAssertionResponseLargeBlobKey] = a.largeBlobKey
+		}
+	}
+	return response
+}
+
+func TestCallCTAP2(t *testing.T) {
+	testHid, dev := newTestDevice()
+
+	// Happy path
+	testHid.cborResponse = []byte{0xa1, 0x01, 0x02}
+	response, err := dev.callCTAP2(0x04, cbor.Map{1: "a"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(testHid.cborRequest) != string([]byte{0xa1, 0x01, 0x61, 0x61}) {
+		t.Errorf("Expected request % x, but got % x", []byte{0xa1, 0x01, 0x61, 0x61}, testHid.cborRequest)
+	}
+	if value, _ := response.Int(1); value != 2 {
+		t.Errorf("Expected response {1: 2}, but got %#v", response)
+	}
+
+	// Empty response
+	testHid.cborResponse = nil
+	response, err = dev.callCTAP2(0x04, nil)
+	if err != nil || len(response) != 0 {
+		t.Errorf("Expected empty response, but got %#v %s", response, err)
+	}
+
+	// Invalid response
+	testHid.cborResponse = []byte{0x01}
+	_, err = dev.callCTAP2(0x04, nil)
+	if err == nil {
+		t.Errorf("Expected error for a response that is not a map")
+	}
+
+	// Error status
+	testHid.cborStatus = 0x01
+	_, err = dev.callCTAP2(0x04, nil)
+	if err == nil || err.Error() != "CTAP2Error: 0x01" {
+		t.Errorf("Expected error `CTAP2Error: 0x01` but got `%s`", err)
+	}
+
+	// Error from SendCBOR
+	testHid.cborStatus = ctap2StatusOK
+	testHid.error = errors.New("CBOR Error")
+	_, err = dev.callCTAP2(0x04, nil)
+	if err != testHid.error {
+		t.Errorf("Expected error `%s` got `%s`", testHid.error, err)
+	}
+}
@@ -1,6 +1,10 @@
 package u2fhost
 
-import "github.com/marshallbrekka/go-u2fhost/hid"
+import (
+	"errors"
+
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
 
 // APDU Commands
 const (
@@ -28,6 +32,7 @@ const (
 
 type HidDevice struct {
 	hidDevice hid.Device
+	keepAlive func(KeepAliveStatus)
 }
 
 func newHidDevice(dev hid.Device) *HidDevice {
@@ -58,6 +63,18 @@ func (dev *HidDevice) Close() {
 	dev.hidDevice.Close()
 }
 
+// Returns the metadata reported for the device during enumeration,
+// such as the vendor, product and serial number.
+func (dev *HidDevice) Info() hid.DeviceInfo {
+	return dev.hidDevice.Info()
+}
+
+// Returns the U2FHID capability flags the device reported when it was opened,
+// such as hid.CAPABILITY_WINK and hid.CAPABILITY_CBOR.
+func (dev *HidDevice) Capabilities() uint8 {
+	return dev.hidDevice.Capabilities()
+}
+
 // Returns the U2F version the device supports.
 func (dev *HidDevice) Version() (string, error) {
 	status, response, err := dev.hidDevice.SendAPDU(u2fCommandVersion, 0, 0, []byte{})
@@ -69,3 +86,12 @@ func (dev *HidDevice) Version() (string, error) {
 	}
 	return string(response), nil
 }
+
+// Asks the open device to identify itself, usually by flashing its light,
+// so the user can tell which of several devices it is.
+func (dev *HidDevice) Wink() error {
+	if dev.Capabilities()&hid.CAPABILITY_WINK == 0 {
+		return errors.New("The device does not support wink")
+	}
+	return dev.hidDevice.Wink()
+}
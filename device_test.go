@@ -3,6 +3,8 @@ package u2fhost
 import (
 	"errors"
 	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/hid"
 )
 
 func TestOpen(t *testing.T) {
@@ -33,6 +35,14 @@ func TestClose(t *testing.T) {
 	dev.Close()
 }
 
+func TestCapabilities(t *testing.T) {
+	testHid, dev := newTestDevice()
+	testHid.capabilities = hid.CAPABILITY_WINK | hid.CAPABILITY_CBOR
+	if dev.Capabilities() != hid.CAPABILITY_WINK|hid.CAPABILITY_CBOR {
+		t.Errorf("Expected the capabilities from the hid device, but got %#x", dev.Capabilities())
+	}
+}
+
 func TestVersion(t *testing.T) {
 	// Happy path
 	testHid := &testDevice{
@@ -66,3 +76,21 @@ func TestVersion(t *testing.T) {
 		t.Errorf("Expected error `U2FError: 0x6986` got `%s`", err)
 	}
 }
+
+func TestWink(t *testing.T) {
+	testHid, dev := newTestDevice()
+	err := dev.Wink()
+	if err == nil {
+		t.Errorf("Expected error winking a device without the wink capability")
+	} else if testHid.winks != 0 {
+		t.Errorf("Expected no wink to be sent, but got %d", testHid.winks)
+	}
+
+	testHid.capabilities = hid.CAPABILITY_WINK
+	err = dev.Wink()
+	if err != nil {
+		t.Errorf("Unexpected error winking device: %s", err)
+	} else if testHid.winks != 1 {
+		t.Errorf("Expected 1 wink to be sent, but got %d", testHid.winks)
+	}
+}
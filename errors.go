@@ -1,5 +1,7 @@
 package u2fhost
 
+import "fmt"
+
 // A TestOfUserPresenceRequiredError indicates that the device is requesting the
 // user interact with it (such as pressing a button) to fulfill the given request.
 type TestOfUserPresenceRequiredError struct{}
@@ -16,3 +18,155 @@ func (e BadKeyHandleError) Error() string {
 	// TODO: get the actual reason from the device response.
 	return "The provided key handle is not present on the device, or was created with a different application parameter."
 }
+
+// A NotAllowedError indicates the authenticator refused the request,
+// for example a reset that was not performed shortly after the device was powered up.
+type NotAllowedError struct{}
+
+func (e NotAllowedError) Error() string {
+	return "The device did not allow the request."
+}
+
+// A UserActionTimeoutError indicates the user did not interact with the
+// authenticator (such as pressing a button) before the device timed out.
+type UserActionTimeoutError struct{}
+
+func (e UserActionTimeoutError) Error() string {
+	return "Timed out waiting for the user to interact with the device."
+}
+
+// An OperationDeniedError indicates the user declined the request on the authenticator.
+type OperationDeniedError struct{}
+
+func (e OperationDeniedError) Error() string {
+	return "The request was denied by the user."
+}
+
+// An InvalidOptionError indicates the authenticator does not support an option
+// of the request, or has nothing to return for it.
+type InvalidOptionError struct{}
+
+func (e InvalidOptionError) Error() string {
+	return "The device does not support an option of the request."
+}
+
+// A KeepAliveCancelError indicates the request was cancelled while the
+// authenticator was waiting for the user.
+type KeepAliveCancelError struct{}
+
+func (e KeepAliveCancelError) Error() string {
+	return "The request was cancelled."
+}
+
+// A CredentialExcludedError indicates the authenticator already contains one
+// of the credentials in the exclude list.
+type CredentialExcludedError struct{}
+
+func (e CredentialExcludedError) Error() string {
+	return "The device already contains one of the excluded credentials."
+}
+
+// A NoCredentialsError indicates the authenticator has no credentials for the request.
+type NoCredentialsError struct{}
+
+func (e NoCredentialsError) Error() string {
+	return "The device does not contain any of the requested credentials."
+}
+
+// A PinRequiredError indicates the authenticator requires user verification,
+// such as a PIN, to fulfill the request.
+type PinRequiredError struct{}
+
+func (e PinRequiredError) Error() string {
+	return "The device requires user verification to fulfill the request."
+}
+
+// A PinInvalidError indicates the PIN was incorrect.
+type PinInvalidError struct{}
+
+func (e PinInvalidError) Error() string {
+	return "The PIN is incorrect."
+}
+
+// A PinBlockedError indicates the PIN is blocked after too many incorrect attempts,
+// the device must be re-inserted (or reset if blocked permanently) before it can be used again.
+type PinBlockedError struct{}
+
+func (e PinBlockedError) Error() string {
+	return "The PIN is blocked after too many incorrect attempts."
+}
+
+// A PinAuthInvalidError indicates the PIN/UV auth token was rejected,
+// for example because it lacks the permission for the request.
+type PinAuthInvalidError struct{}
+
+func (e PinAuthInvalidError) Error() string {
+	return "The device rejected the PIN/UV auth token."
+}
+
+// A PinNotSetError indicates the request requires a PIN, but the device does not have one.
+type PinNotSetError struct{}
+
+func (e PinNotSetError) Error() string {
+	return "The device does not have a PIN set."
+}
+
+// A PinPolicyViolationError indicates a PIN does not meet the device's PIN policy,
+// for example a minimum PIN length shorter than the current one.
+type PinPolicyViolationError struct{}
+
+func (e PinPolicyViolationError) Error() string {
+	return "The request violates the device PIN policy."
+}
+
+// An InvalidAppIdError indicates the Facet is not allowed to use the AppId.
+type InvalidAppIdError struct {
+	AppId  string
+	Facet  string
+	Reason string
+}
+
+func (e InvalidAppIdError) Error() string {
+	return fmt.Sprintf("The facet %s is not allowed to use the AppID %s: %s.", e.Facet, e.AppId, e.Reason)
+}
+
+// An InvalidRPIDError indicates the RP ID is not valid for the origin of a WebAuthn request.
+type InvalidRPIDError struct {
+	RPID   string
+	Origin string
+	Reason string
+}
+
+func (e InvalidRPIDError) Error() string {
+	return fmt.Sprintf("The RP ID %s is not valid for the origin %s: %s.", e.RPID, e.Origin, e.Reason)
+}
+
+// An InvalidAttestationError indicates the attestation statement of a new credential
+// could not be verified.
+type InvalidAttestationError struct {
+	Format string
+	Reason string
+}
+
+func (e InvalidAttestationError) Error() string {
+	return fmt.Sprintf("Invalid %s attestation: %s.", e.Format, e.Reason)
+}
+
+// An InvalidResponseError indicates a register or authenticate response
+// failed verification by the relying party.
+type InvalidResponseError struct {
+	Reason string
+}
+
+func (e InvalidResponseError) Error() string {
+	return fmt.Sprintf("Invalid response: %s.", e.Reason)
+}
+
+// An InvalidSignatureError indicates a SignatureBundle is not a valid signature of the digest.
+type InvalidSignatureError struct {
+	Reason string
+}
+
+func (e InvalidSignatureError) Error() string {
+	return fmt.Sprintf("Invalid signature: %s.", e.Reason)
+}
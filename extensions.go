@@ -0,0 +1,196 @@
+package u2fhost
+
+import (
+	"errors"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The CTAP2 extensions are defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#sctn-defined-extensions
+
+// Extension identifiers
+const (
+	extensionCredProtect  = "credProtect"
+	extensionCredBlob     = "credBlob"
+	extensionMinPinLength = "minPinLength"
+)
+
+// A CredProtectPolicy sets when a credential can be used without user verification.
+type CredProtectPolicy int
+
+const (
+	// The credential can always be used without user verification.
+	CredProtectUserVerificationOptional CredProtectPolicy = 0x01
+	// The credential can be used without user verification only when its ID is provided,
+	// so it can not be discovered without user verification.
+	CredProtectUserVerificationOptionalWithCredentialIDList CredProtectPolicy = 0x02
+	// The credential can only be used with user verification.
+	CredProtectUserVerificationRequired CredProtectPolicy = 0x03
+)
+
+// The extension inputs for a MakeCredential request.
+type MakeCredentialExtensions struct {
+	// Optional boolean (defaults to false) that when true, enables the hmac-secret
+	// extension for the credential, see HmacSecretInput.
+	HmacSecret bool
+
+	// Optional credential protection policy, the device default is used if not set.
+	CredProtect CredProtectPolicy
+
+	// Optional small blob (at most the MaxCredBlobLength reported by the device)
+	// stored with the credential, it is returned by GetAssertion when CredBlob is set.
+	// The credential must be a resident credential.
+	CredBlob []byte
+
+	// Optional boolean (defaults to false) that when true, requests the minimum PIN
+	// length of the device. The RP ID must be allowed by the device configuration.
+	MinPinLength bool
+
+	// Optional boolean (defaults to false) that when true, requests a largeBlobKey
+	// for the credential, used to encrypt its entry in the large-blob array.
+	// The credential must be a resident credential.
+	LargeBlobKey bool
+}
+
+// The extension outputs of a MakeCredential response.
+type MakeCredentialExtensionOutputs struct {
+	// True if the hmac-secret extension was enabled for the credential.
+	HmacSecret bool
+
+	// The credential protection policy applied to the credential, if CredProtect was requested.
+	CredProtect CredProtectPolicy
+
+	// True if the CredBlob was stored with the credential.
+	CredBlob bool
+
+	// The minimum PIN length of the device, if MinPinLength was requested.
+	MinPinLength int
+
+	// The key for the credential's large-blob entry, if LargeBlobKey was requested.
+	LargeBlobKey []byte
+}
+
+// The extension inputs for a GetAssertion request.
+type GetAssertionExtensions struct {
+	// Optional salts for the hmac-secret extension.
+	// The credential must have been created with HmacSecret set to true.
+	HmacSecret *HmacSecretInput
+
+	// Optional boolean (defaults to false) that when true, requests the CredBlob
+	// stored with the credential.
+	CredBlob bool
+
+	// Optional boolean (defaults to false) that when true, requests the
+	// largeBlobKey of the credential.
+	LargeBlobKey bool
+
+	// Optional U2F AppID for the appid client extension, for credentials registered with U2F.
+	// It is not sent to the device, instead the request is retried with the AppID as the
+	// RP ID if none of the credentials in the allow list are found for the RP ID.
+	AppID string
+}
+
+// The extension outputs of a GetAssertion response.
+type GetAssertionExtensionOutputs struct {
+	// The decrypted hmac-secret outputs, if HmacSecret was requested.
+	HmacSecret *HmacSecretOutput
+
+	// The blob stored with the credential, if CredBlob was requested.
+	// Empty if the credential has no blob.
+	CredBlob []byte
+
+	// The key for the credential's large-blob entry, if LargeBlobKey was requested.
+	LargeBlobKey []byte
+
+	// True if the credential was found with the AppID rather than the RP ID.
+	AppID bool
+}
+
+// Returns the extensions map for the request, or nil if no extensions were requested.
+func (e *MakeCredentialExtensions) encode() (cbor.Map, error) {
+	extensions := cbor.Map{}
+	if e.HmacSecret {
+		extensions[extensionHmacSecret] = true
+	}
+	if e.CredProtect != 0 {
+		if e.CredProtect < CredProtectUserVerificationOptional || e.CredProtect > CredProtectUserVerificationRequired {
+			return nil, errors.New("Invalid CredProtect policy")
+		}
+		extensions[extensionCredProtect] = int(e.CredProtect)
+	}
+	if e.CredBlob != nil {
+		extensions[extensionCredBlob] = e.CredBlob
+	}
+	if e.MinPinLength {
+		extensions[extensionMinPinLength] = true
+	}
+	if e.LargeBlobKey {
+		extensions[extensionLargeBlobKey] = true
+	}
+	if len(extensions) == 0 {
+		return nil, nil
+	}
+	return extensions, nil
+}
+
+// Decodes the extension outputs from the authenticator data extensions and
+// the largeBlobKey returned in the response.
+func decodeMakeCredentialExtensions(extensions cbor.Map, largeBlobKey []byte) MakeCredentialExtensionOutputs {
+	outputs := MakeCredentialExtensionOutputs{LargeBlobKey: largeBlobKey}
+	if extensions == nil {
+		return outputs
+	}
+	outputs.HmacSecret, _ = extensions.Bool(extensionHmacSecret)
+	outputs.CredProtect = CredProtectPolicy(cborInt(extensions, extensionCredProtect))
+	outputs.CredBlob, _ = extensions.Bool(extensionCredBlob)
+	outputs.MinPinLength = cborInt(extensions, extensionMinPinLength)
+	return outputs
+}
+
+// Returns the extensions map for the request, or nil if no extensions were requested.
+// The shared secret is required if HmacSecret is set.
+func (e *GetAssertionExtensions) encode(secret *sharedSecret) (cbor.Map, error) {
+	extensions := cbor.Map{}
+	if e.HmacSecret != nil {
+		input, err := hmacSecretInput(secret, e.HmacSecret)
+		if err != nil {
+			return nil, err
+		}
+		extensions[extensionHmacSecret] = input
+	}
+	if e.CredBlob {
+		extensions[extensionCredBlob] = true
+	}
+	if e.LargeBlobKey {
+		extensions[extensionLargeBlobKey] = true
+	}
+	if len(extensions) == 0 {
+		return nil, nil
+	}
+	return extensions, nil
+}
+
+// Decodes the extension outputs from the authenticator data extensions and
+// the largeBlobKey returned in the response, decrypting the hmac-secret output.
+func (e *GetAssertionExtensions) decode(extensions cbor.Map, largeBlobKey []byte, secret *sharedSecret) (GetAssertionExtensionOutputs, error) {
+	outputs := GetAssertionExtensionOutputs{LargeBlobKey: largeBlobKey}
+	if extensions == nil {
+		extensions = cbor.Map{}
+	}
+	if e.HmacSecret != nil {
+		encrypted, ok := extensions.Bytes(extensionHmacSecret)
+		if !ok {
+			return outputs, errors.New("Device did not return the hmac-secret output")
+		}
+		output, err := hmacSecretOutput(secret, encrypted, e.HmacSecret)
+		if err != nil {
+			return outputs, err
+		}
+		outputs.HmacSecret = output
+	}
+	if e.CredBlob {
+		outputs.CredBlob, _ = extensions.Bytes(extensionCredBlob)
+	}
+	return outputs, nil
+}
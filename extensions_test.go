@@ -0,0 +1,78 @@
+package u2fhost
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMakeCredentialExtensions(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+
+	req := sampleMakeCredentialRequest()
+	req.ResidentKey = true
+	req.Extensions = MakeCredentialExtensions{
+		CredProtect:  CredProtectUserVerificationRequired,
+		CredBlob:     []byte("blob"),
+		MinPinLength: true,
+	}
+	response, err := dev.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	extensions, _ := authenticator.requests[ctap2CommandMakeCredential].Map(makeCredentialExtensions)
+	if policy, _ := extensions.Int(extensionCredProtect); policy != 3 {
+		t.Errorf("Expected credProtect input 3, but got %d", policy)
+	}
+	if credBlob, _ := extensions.Bytes(extensionCredBlob); string(credBlob) != "blob" {
+		t.Errorf("Expected credBlob input \"blob\", but got %s", credBlob)
+	}
+	if _, ok := extensions.Get(extensionHmacSecret); ok {
+		t.Errorf("Did not expect hmac-secret input")
+	}
+	expected := MakeCredentialExtensionOutputs{
+		CredProtect:  CredProtectUserVerificationRequired,
+		CredBlob:     true,
+		MinPinLength: 4,
+	}
+	if response.Extensions.CredProtect != expected.CredProtect ||
+		response.Extensions.CredBlob != expected.CredBlob ||
+		response.Extensions.MinPinLength != expected.MinPinLength ||
+		response.Extensions.HmacSecret {
+		t.Errorf("Expected outputs %#v, but got %#v", expected, response.Extensions)
+	}
+
+	// No extensions
+	response, err = dev.MakeCredential(sampleMakeCredentialRequest())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, ok := authenticator.requests[ctap2CommandMakeCredential].Get(makeCredentialExtensions); ok {
+		t.Errorf("Did not expect extensions in the request")
+	}
+
+	// Invalid policy
+	req = sampleMakeCredentialRequest()
+	req.Extensions.CredProtect = 4
+	_, err = dev.MakeCredential(req)
+	if err == nil {
+		t.Errorf("Expected error for invalid credProtect policy")
+	}
+}
+
+func TestGetAssertionExtensions(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	authenticator.credBlob = []byte("blob")
+
+	req := sampleGetAssertionRequest()
+	req.Extensions.CredBlob = true
+	response, err := dev.GetAssertion(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(response.Extensions.CredBlob, []byte("blob")) {
+		t.Errorf("Expected credBlob \"blob\", but got %s", response.Extensions.CredBlob)
+	}
+	if response.Extensions.HmacSecret != nil || response.Extensions.LargeBlobKey != nil {
+		t.Errorf("Did not expect other outputs, but got %#v", response.Extensions)
+	}
+}
@@ -0,0 +1,32 @@
+package u2fhost
+
+import "github.com/marshallbrekka/go-u2fhost/hid"
+
+// Selects devices by the metadata reported when enumerating them.
+// Fields left as their zero value match any device.
+type DeviceFilter struct {
+	Path      string
+	Serial    string
+	VendorId  uint16
+	ProductId uint16
+}
+
+// Returns true if the device metadata matches every field set in the filter.
+func (f DeviceFilter) Matches(info hid.DeviceInfo) bool {
+	return (f.Path == "" || f.Path == info.Path) &&
+		(f.Serial == "" || f.Serial == info.Serial) &&
+		(f.VendorId == 0 || f.VendorId == info.VendorId) &&
+		(f.ProductId == 0 || f.ProductId == info.ProductId)
+}
+
+// Returns the devices that match the filter, in the same order.
+// The devices do not need to be open.
+func FilterDevices(devices []*HidDevice, filter DeviceFilter) []*HidDevice {
+	matches := []*HidDevice{}
+	for _, dev := range devices {
+		if filter.Matches(dev.Info()) {
+			matches = append(matches, dev)
+		}
+	}
+	return matches
+}
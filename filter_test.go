@@ -0,0 +1,48 @@
+package u2fhost
+
+import (
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
+
+func TestFilterDevices(t *testing.T) {
+	infos := []hid.DeviceInfo{
+		{Path: "/dev/hidraw0", VendorId: 0x1050, ProductId: 0x0407, Serial: "111"},
+		{Path: "/dev/hidraw1", VendorId: 0x1050, ProductId: 0x0120, Serial: "222"},
+		{Path: "/dev/hidraw2", VendorId: 0x20a0, ProductId: 0x42b1, Serial: "333"},
+	}
+	devices := []*HidDevice{}
+	for _, info := range infos {
+		devices = append(devices, newHidDevice(&testDevice{info: info}))
+	}
+	tests := []struct {
+		name     string
+		filter   DeviceFilter
+		expected []string
+	}{
+		{"empty", DeviceFilter{}, []string{"/dev/hidraw0", "/dev/hidraw1", "/dev/hidraw2"}},
+		{"path", DeviceFilter{Path: "/dev/hidraw1"}, []string{"/dev/hidraw1"}},
+		{"serial", DeviceFilter{Serial: "333"}, []string{"/dev/hidraw2"}},
+		{"vendor", DeviceFilter{VendorId: 0x1050}, []string{"/dev/hidraw0", "/dev/hidraw1"}},
+		{"vendor and product", DeviceFilter{VendorId: 0x1050, ProductId: 0x0120}, []string{"/dev/hidraw1"}},
+		{"no match", DeviceFilter{VendorId: 0x20a0, Serial: "111"}, []string{}},
+	}
+	for _, test := range tests {
+		matches := FilterDevices(devices, test.filter)
+		paths := []string{}
+		for _, dev := range matches {
+			paths = append(paths, dev.Info().Path)
+		}
+		if len(paths) != len(test.expected) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expected, paths)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.expected[i] {
+				t.Errorf("%s: expected %v but got %v", test.name, test.expected, paths)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package u2fhost
+
+import (
+	"errors"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// CTAP2 authenticatorGetAssertion parameter keys
+const (
+	getAssertionRPID              = 0x01
+	getAssertionClientDataHash    = 0x02
+	getAssertionAllowList         = 0x03
+	getAssertionExtensions        = 0x04
+	getAssertionOptions           = 0x05
+	getAssertionPinUvAuthParam    = 0x06
+	getAssertionPinUvAuthProtocol = 0x07
+)
+
+// CTAP2 authenticatorGetAssertion response keys
+const (
+	getAssertionResponseCredential          = 0x01
+	getAssertionResponseAuthData            = 0x02
+	getAssertionResponseSignature           = 0x03
+	getAssertionResponseUser                = 0x04
+	getAssertionResponseNumberOfCredentials = 0x05
+	getAssertionResponseLargeBlobKey        = 0x07
+)
+
+// A GetAssertionRequest is used when signing with a credential on a CTAP2 device.
+type GetAssertionRequest struct {
+	// The RP ID the credential was created with.
+	RPID string
+
+	// SHA-256 hash of the client data to sign.
+	ClientDataHash []byte
+
+	// The IDs of the credentials that may be used, if empty the device
+	// will use a resident credential for the RP ID.
+	AllowList [][]byte
+
+	// Optional boolean (defaults to false) that when true, requires the device to verify the user.
+	UserVerification bool
+
+	// Optional extension inputs.
+	Extensions GetAssertionExtensions
+
+	// Optional PIN/UV auth token, used to verify the user.
+	PinUvAuthToken *PinUvAuthToken
+}
+
+// A response from a GetAssertion operation.
+type GetAssertionResponse struct {
+	// The ID of the credential used to sign.
+	CredentialID []byte
+	// The raw authenticator data, which is covered by the signature.
+	AuthData          []byte
+	AuthenticatorData *AuthenticatorData
+	// The signature over the authenticator data followed by the client data hash.
+	Signature []byte
+	// The user the credential was created for, only returned for resident credentials.
+	User *UserEntity
+	// The number of resident credentials for the RP ID, only returned when the allow list was empty.
+	NumberOfCredentials int
+
+	// The extension outputs.
+	Extensions GetAssertionExtensionOutputs
+}
+
+// Signs with a credential on a CTAP2 device using the GetAssertionRequest,
+// returning a GetAssertionResponse.
+func (dev *HidDevice) GetAssertion(req *GetAssertionRequest) (*GetAssertionResponse, error) {
+	var secret *sharedSecret
+	var err error
+	if req.Extensions.HmacSecret != nil {
+		secret, err = dev.sharedSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+	params, err := getAssertionRequest(req, secret)
+	if err != nil {
+		return nil, err
+	}
+	response, err := dev.callCTAP2(ctap2CommandGetAssertion, params)
+	usedAppID := false
+	if _, ok := err.(*NoCredentialsError); ok && req.Extensions.AppID != "" && len(req.AllowList) > 0 {
+		// Credentials registered with U2F are scoped to the AppID
+		params[getAssertionRPID] = req.Extensions.AppID
+		response, err = dev.callCTAP2(ctap2CommandGetAssertion, params)
+		usedAppID = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	assertion, err := getAssertionResponse(response, req, secret)
+	if err != nil {
+		return nil, err
+	}
+	assertion.Extensions.AppID = usedAppID
+	return assertion, nil
+}
+
+func getAssertionRequest(req *GetAssertionRequest, secret *sharedSecret) (cbor.Map, error) {
+	if req.RPID == "" {
+		return nil, errors.New("RPID must be set")
+	}
+	if len(req.ClientDataHash) != 32 {
+		return nil, errors.New("ClientDataHash must be 32 bytes")
+	}
+	params := cbor.Map{
+		getAssertionRPID:           req.RPID,
+		getAssertionClientDataHash: req.ClientDataHash,
+	}
+	if len(req.AllowList) > 0 {
+		params[getAssertionAllowList] = credentialDescriptors(req.AllowList)
+	}
+	extensions, err := req.Extensions.encode(secret)
+	if err != nil {
+		return nil, err
+	}
+	if extensions != nil {
+		params[getAssertionExtensions] = extensions
+	}
+	if req.PinUvAuthToken != nil {
+		params[getAssertionPinUvAuthParam] = req.PinUvAuthToken.authenticate(req.ClientDataHash)
+		params[getAssertionPinUvAuthProtocol] = req.PinUvAuthToken.protocol.version()
+	}
+	if req.UserVerification {
+		params[getAssertionOptions] = cbor.Map{"uv": true}
+	}
+	return params, nil
+}
+
+func getAssertionResponse(response cbor.Map, req *GetAssertionRequest, secret *sharedSecret) (*GetAssertionResponse, error) {
+	authData, ok := response.Bytes(getAssertionResponseAuthData)
+	if !ok {
+		return nil, errors.New("GetAssertion response is missing the authenticator data")
+	}
+	signature, ok := response.Bytes(getAssertionResponseSignature)
+	if !ok {
+		return nil, errors.New("GetAssertion response is missing the signature")
+	}
+	parsed, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	assertion := &GetAssertionResponse{
+		AuthData:            authData,
+		AuthenticatorData:   parsed,
+		Signature:           signature,
+		NumberOfCredentials: cborInt(response, getAssertionResponseNumberOfCredentials),
+	}
+	if credential, ok := response.Map(getAssertionResponseCredential); ok {
+		assertion.CredentialID, _ = credential.Bytes("id")
+	} else if len(req.AllowList) == 1 {
+		// The credential may be omitted if the allow list contained a single credential.
+		assertion.CredentialID = req.AllowList[0]
+	}
+	if user, ok := response.Map(getAssertionResponseUser); ok {
+		assertion.User = &UserEntity{}
+		assertion.User.ID, _ = user.Bytes("id")
+		assertion.User.Name, _ = user.String("name")
+		assertion.User.DisplayName, _ = user.String("displayName")
+	}
+	largeBlobKey, _ := response.Bytes(getAssertionResponseLargeBlobKey)
+	assertion.Extensions, err = req.Extensions.decode(parsed.Extensions, largeBlobKey, secret)
+	if err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
@@ -0,0 +1,102 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"testing"
+)
+
+func sampleGetAssertionRequest() *GetAssertionRequest {
+	return &GetAssertionRequest{
+		RPID:           "example.com",
+		ClientDataHash: sha256([]byte("client data")),
+		AllowList:      [][]byte{[]byte("test credential id")},
+	}
+}
+
+func TestGetAssertion(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+
+	// Happy path
+	req := sampleGetAssertionRequest()
+	response, err := dev.GetAssertion(req)
+	if err != nil {
+		t.Fatalf("Unexpected error calling GetAssertion: %s", err)
+	}
+	if !bytes.Equal(response.CredentialID, authenticator.credentialID) {
+		t.Errorf("Expected credential id %x, but got %x", authenticator.credentialID, response.CredentialID)
+	}
+	if !response.AuthenticatorData.UserPresent() {
+		t.Errorf("Expected user present flag")
+	}
+	signed := sha256(append(append([]byte{}, response.AuthData...), req.ClientDataHash...))
+	if !ecdsa.VerifyASN1(&authenticator.credentialKey.PublicKey, signed, response.Signature) {
+		t.Errorf("Signature did not verify")
+	}
+	if response.Extensions.HmacSecret != nil {
+		t.Errorf("Did not expect hmac-secret output")
+	}
+	params := authenticator.requests[ctap2CommandGetAssertion]
+	if _, ok := params.Get(getAssertionExtensions); ok {
+		t.Errorf("Did not expect extensions in the request")
+	}
+
+	// Error status
+	authenticator.status = ctap2StatusNoCredentials
+	_, err = dev.GetAssertion(req)
+	if _, ok := err.(*NoCredentialsError); !ok {
+		t.Errorf("Expected NoCredentialsError, but got %#v", err)
+	}
+
+	// Missing RP ID
+	authenticator.status = ctap2StatusOK
+	req.RPID = ""
+	_, err = dev.GetAssertion(req)
+	if err == nil {
+		t.Errorf("Expected error for missing RP ID")
+	}
+}
+
+func TestGetAssertionHmacSecret(t *testing.T) {
+	salt1 := bytes.Repeat([]byte{1}, 32)
+	salt2 := bytes.Repeat([]byte{2}, 32)
+	for _, protocols := range [][]int{{1}, {2, 1}} {
+		authenticator, _, dev := newTestAuthenticator(t)
+		authenticator.info[getInfoPinUvAuthProtocols] = protocols
+
+		// A single salt
+		req := sampleGetAssertionRequest()
+		req.Extensions.HmacSecret = &HmacSecretInput{Salt1: salt1}
+		response, err := dev.GetAssertion(req)
+		if err != nil {
+			t.Fatalf("Unexpected error calling GetAssertion with protocols %v: %s", protocols, err)
+		}
+		expected1 := hmacSha256(authenticator.credRandom, salt1)
+		if !bytes.Equal(response.Extensions.HmacSecret.Output1, expected1) {
+			t.Errorf("Expected output1 %x, but got %x", expected1, response.Extensions.HmacSecret.Output1)
+		}
+		if response.Extensions.HmacSecret.Output2 != nil {
+			t.Errorf("Did not expect output2, but got %x", response.Extensions.HmacSecret.Output2)
+		}
+
+		// Two salts
+		req.Extensions.HmacSecret = &HmacSecretInput{Salt1: salt1, Salt2: salt2}
+		response, err = dev.GetAssertion(req)
+		if err != nil {
+			t.Fatalf("Unexpected error calling GetAssertion with protocols %v: %s", protocols, err)
+		}
+		expected2 := hmacSha256(authenticator.credRandom, salt2)
+		if !bytes.Equal(response.Extensions.HmacSecret.Output1, expected1) || !bytes.Equal(response.Extensions.HmacSecret.Output2, expected2) {
+			t.Errorf("Expected outputs %x %x, but got %x %x", expected1, expected2, response.Extensions.HmacSecret.Output1, response.Extensions.HmacSecret.Output2)
+		}
+	}
+
+	// Invalid salt
+	_, _, dev := newTestAuthenticator(t)
+	req := sampleGetAssertionRequest()
+	req.Extensions.HmacSecret = &HmacSecretInput{Salt1: []byte{1, 2, 3}}
+	_, err := dev.GetAssertion(req)
+	if err == nil {
+		t.Errorf("Expected error for short salt")
+	}
+}
@@ -0,0 +1,119 @@
+package u2fhost
+
+import (
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// CTAP2 authenticatorGetInfo response keys
+const (
+	getInfoVersions                         = 0x01
+	getInfoExtensions                       = 0x02
+	getInfoAAGUID                           = 0x03
+	getInfoOptions                          = 0x04
+	getInfoMaxMsgSize                       = 0x05
+	getInfoPinUvAuthProtocols               = 0x06
+	getInfoMaxCredentialCountInList         = 0x07
+	getInfoMaxCredentialIdLength            = 0x08
+	getInfoTransports                       = 0x09
+	getInfoAlgorithms                       = 0x0A
+	getInfoMaxSerializedLargeBlobArray      = 0x0B
+	getInfoForcePINChange                   = 0x0C
+	getInfoMinPINLength                     = 0x0D
+	getInfoFirmwareVersion                  = 0x0E
+	getInfoMaxCredBlobLength                = 0x0F
+	getInfoMaxRPIDsForSetMinPINLength       = 0x10
+	getInfoPreferredPlatformUvAttempts      = 0x11
+	getInfoUvModality                       = 0x12
+	getInfoRemainingDiscoverableCredentials = 0x14
+)
+
+// The capabilities reported by a CTAP2 authenticator.
+// For more information see https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorGetInfo
+type AuthenticatorInfo struct {
+	Versions                         []string        `json:"versions"`
+	Extensions                       []string        `json:"extensions,omitempty"`
+	AAGUID                           []byte          `json:"aaguid"`
+	Options                          map[string]bool `json:"options,omitempty"`
+	MaxMsgSize                       int             `json:"maxMsgSize,omitempty"`
+	PinUvAuthProtocols               []int           `json:"pinUvAuthProtocols,omitempty"`
+	MaxCredentialCountInList         int             `json:"maxCredentialCountInList,omitempty"`
+	MaxCredentialIdLength            int             `json:"maxCredentialIdLength,omitempty"`
+	Transports                       []string        `json:"transports,omitempty"`
+	Algorithms                       []int           `json:"algorithms,omitempty"`
+	MaxSerializedLargeBlobArray      int             `json:"maxSerializedLargeBlobArray,omitempty"`
+	ForcePINChange                   bool            `json:"forcePINChange,omitempty"`
+	MinPINLength                     int             `json:"minPINLength,omitempty"`
+	FirmwareVersion                  int             `json:"firmwareVersion,omitempty"`
+	MaxCredBlobLength                int             `json:"maxCredBlobLength,omitempty"`
+	MaxRPIDsForSetMinPINLength       int             `json:"maxRPIDsForSetMinPINLength,omitempty"`
+	PreferredPlatformUvAttempts      int             `json:"preferredPlatformUvAttempts,omitempty"`
+	UvModality                       int             `json:"uvModality,omitempty"`
+	RemainingDiscoverableCredentials int             `json:"remainingDiscoverableCredentials,omitempty"`
+}
+
+// Returns the CTAP2 capabilities of the device.
+func (dev *HidDevice) GetInfo() (*AuthenticatorInfo, error) {
+	response, err := dev.callCTAP2(ctap2CommandGetInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseAuthenticatorInfo(response), nil
+}
+
+// Returns true if the authenticator supports the CTAP version, such as "FIDO_2_1".
+func (info *AuthenticatorInfo) HasVersion(version string) bool {
+	return containsString(info.Versions, version)
+}
+
+// Returns true if the authenticator supports the extension, such as "hmac-secret".
+func (info *AuthenticatorInfo) HasExtension(extension string) bool {
+	return containsString(info.Extensions, extension)
+}
+
+// Returns whether the option is supported, and if so whether it is enabled.
+func (info *AuthenticatorInfo) Option(option string) (supported bool, enabled bool) {
+	enabled, supported = info.Options[option]
+	return supported, enabled
+}
+
+func parseAuthenticatorInfo(response cbor.Map) *AuthenticatorInfo {
+	info := &AuthenticatorInfo{
+		Versions:           cborStrings(response, getInfoVersions),
+		Extensions:         cborStrings(response, getInfoExtensions),
+		PinUvAuthProtocols: cborInts(response, getInfoPinUvAuthProtocols),
+		Transports:         cborStrings(response, getInfoTransports),
+		Options:            map[string]bool{},
+	}
+	info.AAGUID, _ = response.Bytes(getInfoAAGUID)
+	if options, ok := response.Map(getInfoOptions); ok {
+		for key, value := range options {
+			name, ok := key.(string)
+			enabled, ok2 := value.(bool)
+			if ok && ok2 {
+				info.Options[name] = enabled
+			}
+		}
+	}
+	if algorithms, ok := response.Array(getInfoAlgorithms); ok {
+		for _, algorithm := range algorithms {
+			if params, ok := algorithm.(cbor.Map); ok {
+				if alg, ok := params.Int("alg"); ok {
+					info.Algorithms = append(info.Algorithms, int(alg))
+				}
+			}
+		}
+	}
+	info.ForcePINChange, _ = response.Bool(getInfoForcePINChange)
+	info.MaxMsgSize = cborInt(response, getInfoMaxMsgSize)
+	info.MaxCredentialCountInList = cborInt(response, getInfoMaxCredentialCountInList)
+	info.MaxCredentialIdLength = cborInt(response, getInfoMaxCredentialIdLength)
+	info.MaxSerializedLargeBlobArray = cborInt(response, getInfoMaxSerializedLargeBlobArray)
+	info.MinPINLength = cborInt(response, getInfoMinPINLength)
+	info.FirmwareVersion = cborInt(response, getInfoFirmwareVersion)
+	info.MaxCredBlobLength = cborInt(response, getInfoMaxCredBlobLength)
+	info.MaxRPIDsForSetMinPINLength = cborInt(response, getInfoMaxRPIDsForSetMinPINLength)
+	info.PreferredPlatformUvAttempts = cborInt(response, getInfoPreferredPlatformUvAttempts)
+	info.UvModality = cborInt(response, getInfoUvModality)
+	info.RemainingDiscoverableCredentials = cborInt(response, getInfoRemainingDiscoverableCredentials)
+	return info
+}
@@ -0,0 +1,55 @@
+package u2fhost
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+func TestGetInfo(t *testing.T) {
+	authenticator, testHid, dev := newTestAuthenticator(t)
+	authenticator.info[getInfoMaxMsgSize] = 1200
+	authenticator.info[getInfoAlgorithms] = []interface{}{
+		cbor.Map{"alg": -7, "type": "public-key"},
+		cbor.Map{"alg": -8, "type": "public-key"},
+	}
+
+	info, err := dev.GetInfo()
+	if err != nil {
+		t.Fatalf("Unexpected error calling GetInfo: %s", err)
+	}
+	if testHid.command != ctap2CommandGetInfo {
+		t.Errorf("Expected command %#x, but got %#x", ctap2CommandGetInfo, testHid.command)
+	}
+	if !reflect.DeepEqual(info.Versions, []string{"U2F_V2", "FIDO_2_0", "FIDO_2_1"}) {
+		t.Errorf("Unexpected versions %#v", info.Versions)
+	}
+	if !info.HasVersion("FIDO_2_1") || info.HasVersion("FIDO_2_2") {
+		t.Errorf("Unexpected HasVersion results for %#v", info.Versions)
+	}
+	if !info.HasExtension(extensionHmacSecret) || info.HasExtension("credBlob") {
+		t.Errorf("Unexpected HasExtension results for %#v", info.Extensions)
+	}
+	if !reflect.DeepEqual(info.PinUvAuthProtocols, []int{2, 1}) {
+		t.Errorf("Unexpected pin protocols %#v", info.PinUvAuthProtocols)
+	}
+	if !reflect.DeepEqual(info.Algorithms, []int{-7, -8}) {
+		t.Errorf("Unexpected algorithms %#v", info.Algorithms)
+	}
+	if info.MaxMsgSize != 1200 {
+		t.Errorf("Expected max message size 1200, but got %d", info.MaxMsgSize)
+	}
+	if supported, enabled := info.Option("clientPin"); !supported || enabled {
+		t.Errorf("Expected clientPin to be supported but not enabled")
+	}
+	if supported, _ := info.Option("uv"); supported {
+		t.Errorf("Expected uv to not be supported")
+	}
+
+	authenticator.status = 0x01
+	_, err = dev.GetInfo()
+	if err == nil {
+		t.Errorf("Expected error calling GetInfo")
+	}
+}
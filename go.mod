@@ -6,4 +6,7 @@ require (
 	github.com/bearsh/hid v1.3.0
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/cobra v1.0.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 )
@@ -21,14 +21,41 @@ const HID_RPT_SIZE uint16 = 64
 const CMD_INIT uint8 = 0x06
 const CMD_WINK uint8 = 0x08
 const CMD_APDU uint8 = 0x03
+const CMD_CBOR uint8 = 0x10
+const CMD_KEEPALIVE uint8 = 0x3b
+const CMD_CANCEL uint8 = 0x11
 
 const STAT_ERR uint8 = 0xbf
 
+// Capability flags reported by the device in the INIT response.
+const CAPABILITY_WINK uint8 = 0x01
+const CAPABILITY_CBOR uint8 = 0x04
+const CAPABILITY_NMSG uint8 = 0x08
+
+// Keep alive status codes, sent by CTAP2 authenticators while a CBOR request is processed.
+const STATUS_PROCESSING uint8 = 0x01
+const STATUS_UPNEEDED uint8 = 0x02
+
 /** Interfaces **/
 type Device interface {
 	Open() error
 	Close()
 	SendAPDU(instruction, p1, p2 uint8, data []byte) (uint16, []byte, error)
+	SendCBOR(command uint8, data []byte, keepAlive func(uint8)) (uint8, []byte, error)
+	Cancel() error
+	Wink() error
+	Capabilities() uint8
+	Info() DeviceInfo
+}
+
+// DeviceInfo is the metadata reported for a device when enumerating the HID bus.
+type DeviceInfo struct {
+	Path         string
+	VendorId     uint16
+	ProductId    uint16
+	Serial       string
+	Manufacturer string
+	Product      string
 }
 
 type baseDevice interface {
@@ -44,15 +71,26 @@ func Devices() []*HidDevice {
 	devices := hid.Enumerate(0x0, 0x0)
 	for i, device := range devices {
 		if device.UsagePage == 0xf1d0 && device.Usage == 1 {
-			u2fDevices = append(u2fDevices, newHidDevice(newRawHidDevice(&devices[i])))
+			u2fDevice := newHidDevice(newRawHidDevice(&devices[i]))
+			u2fDevice.info = DeviceInfo{
+				Path:         device.Path,
+				VendorId:     device.VendorID,
+				ProductId:    device.ProductID,
+				Serial:       device.Serial,
+				Manufacturer: device.Manufacturer,
+				Product:      device.Product,
+			}
+			u2fDevices = append(u2fDevices, u2fDevice)
 		}
 	}
 	return u2fDevices
 }
 
 type HidDevice struct {
-	device    baseDevice
-	channelId uint32
+	device       baseDevice
+	channelId    uint32
+	capabilities uint8
+	info         DeviceInfo
 	// Use the crypto/rand reader directly so we can unit test
 	randReader io.Reader
 }
@@ -75,17 +113,19 @@ func (dev *HidDevice) Open() error {
 	if err != nil {
 		return err
 	}
-	channelId, err := initDevice(dev.device, dev.channelId, nonce)
+	channelId, capabilities, err := initDevice(dev.device, dev.channelId, nonce)
 	if err != nil {
 		return err
 	}
 	dev.channelId = channelId
+	dev.capabilities = capabilities
 	return nil
 }
 
 func (dev *HidDevice) Close() {
 	dev.device.Close()
 	dev.channelId = 0xffffffff
+	dev.capabilities = 0
 }
 
 func (dev *HidDevice) SendAPDU(instruction, p1, p2 uint8, data []byte) (uint16, []byte, error) {
@@ -104,6 +144,52 @@ func (dev *HidDevice) SendAPDU(instruction, p1, p2 uint8, data []byte) (uint16,
 	return bytesint16(status), resp[:len(resp)-2], nil
 }
 
+// Sends a CTAP2 command with its CBOR encoded parameters, returning the
+// CTAP2 status code and the CBOR encoded response.
+// The keepAlive function, if not nil, is called with the status of every
+// keep alive message received while the device processes the request.
+func (dev *HidDevice) SendCBOR(command uint8, data []byte, keepAlive func(uint8)) (uint8, []byte, error) {
+	request := butil.Concat([]byte{command}, data)
+	err := sendRequest(dev.device, dev.channelId, CMD_CBOR, request)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := readResponseKeepAlive(dev.device, dev.channelId, CMD_CBOR, keepAlive)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(resp) == 0 {
+		return 0, nil, errors.New("Empty CBOR response from device!")
+	}
+	return resp[0], resp[1:], nil
+}
+
+// Asks the device to abort the CBOR request in progress, the pending SendCBOR
+// call then returns the CTAP2_ERR_KEEPALIVE_CANCEL status.
+// The device does not respond to the cancel message itself, so it is safe to
+// call while another goroutine waits for the response.
+func (dev *HidDevice) Cancel() error {
+	return sendRequest(dev.device, dev.channelId, CMD_CANCEL, []byte{})
+}
+
+// Asks the device to identify itself, usually by flashing its light.
+// Only devices that reported CAPABILITY_WINK support this.
+func (dev *HidDevice) Wink() error {
+	_, err := call(dev.device, dev.channelId, CMD_WINK, []byte{})
+	return err
+}
+
+// Returns the capability flags the device reported when it was opened,
+// such as CAPABILITY_CBOR for devices that support CTAP2.
+func (dev *HidDevice) Capabilities() uint8 {
+	return dev.capabilities
+}
+
+// Returns the metadata reported for the device during enumeration.
+func (dev *HidDevice) Info() DeviceInfo {
+	return dev.info
+}
+
 /** Helper Functions **/
 
 func call(dev baseDevice, channelId uint32, command uint8, data []byte) ([]byte, error) {
@@ -159,6 +245,10 @@ func sendRequest(dev baseDevice, channelId uint32, command uint8, data []byte) e
 }
 
 func readResponse(dev baseDevice, channelId uint32, command uint8) ([]byte, error) {
+	return readResponseKeepAlive(dev, channelId, command, nil)
+}
+
+func readResponseKeepAlive(dev baseDevice, channelId uint32, command uint8, keepAlive func(uint8)) ([]byte, error) {
 	header := butil.Concat(int32bytes(channelId), []byte{TYPE_INIT | command})
 	response := make([]byte, HID_RPT_SIZE)
 	for !bytes.Equal(header, response[:5]) {
@@ -167,7 +257,10 @@ func readResponse(dev baseDevice, channelId uint32, command uint8) ([]byte, erro
 			return nil, err
 		}
 		if bytes.Equal(response[:4], header[:4]) && response[4] == STAT_ERR {
-			return nil, u2fhiderror(response[6])
+			return nil, u2fhiderror(response[7])
+		}
+		if bytes.Equal(response[:4], header[:4]) && response[4] == TYPE_INIT|CMD_KEEPALIVE && keepAlive != nil {
+			keepAlive(response[7])
 		}
 	}
 	dataLength := bytesint16(response[5:7])
@@ -195,18 +288,24 @@ func readResponse(dev baseDevice, channelId uint32, command uint8) ([]byte, erro
 	return data, nil
 }
 
-func initDevice(dev baseDevice, channelId uint32, nonce []byte) (uint32, error) {
+// Returns the channel id and capability flags from the INIT response,
+// which is the nonce, channel id, protocol version, device version and capabilities.
+func initDevice(dev baseDevice, channelId uint32, nonce []byte) (uint32, uint8, error) {
 	resp, err := call(dev, channelId, CMD_INIT, nonce)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	for !bytes.Equal(resp[:8], nonce) {
 		resp, err = readResponse(dev, channelId, CMD_INIT)
 		if err != nil {
-			return 0, err
+			return 0, 0, err
 		}
 	}
-	return binary.BigEndian.Uint32(resp[8:12]), nil
+	var capabilities uint8
+	if len(resp) >= 17 {
+		capabilities = resp[16]
+	}
+	return binary.BigEndian.Uint32(resp[8:12]), capabilities, nil
 }
 
 func int32bytes(i uint32) []byte {
@@ -51,6 +51,26 @@ func TestOpen(t *testing.T) {
 	if dev.channelId != expectedChannel {
 		t.Errorf("Expected channel id %d but got %d", expectedChannel, dev.channelId)
 	}
+	if dev.Capabilities() != 0 {
+		t.Errorf("Expected no capabilities but got %#x", dev.Capabilities())
+	}
+
+	// Test that the capabilities are read from a full INIT response.
+	baseDevice, dev = testDevice()
+	dev.randReader = bytes.NewBuffer([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	output := []byte{0xff, 0xff, 0xff, 0xff, 0x86, 0, 17, 1, 2, 3, 4, 5, 6, 7, 8, 4, 5, 6, 7, 2, 5, 2, 1, CAPABILITY_WINK | CAPABILITY_CBOR}
+	baseDevice.output = butil.Concat(output, make([]byte, 64-len(output)))
+	err := dev.Open()
+	if err != nil {
+		t.Errorf("Did not expect error, but got %s", err)
+	}
+	if dev.Capabilities() != CAPABILITY_WINK|CAPABILITY_CBOR {
+		t.Errorf("Expected capabilities %#x but got %#x", CAPABILITY_WINK|CAPABILITY_CBOR, dev.Capabilities())
+	}
+	dev.Close()
+	if dev.Capabilities() != 0 {
+		t.Errorf("Expected capabilities to be cleared on close but got %#x", dev.Capabilities())
+	}
 }
 
 func TestClose(t *testing.T) {
@@ -85,6 +105,81 @@ func TestSendAPDU(t *testing.T) {
 	}
 }
 
+func TestSendCBOR(t *testing.T) {
+	baseDevice := &testWrapperDevice{}
+	dev := newHidDevice(baseDevice)
+	// Two keep alive messages followed by the response
+	keepAlive1, _ := butil.ConcatInto(make([]byte, 64), []byte{255, 255, 255, 255, 0xbb, 0, 1, STATUS_PROCESSING})
+	keepAlive2, _ := butil.ConcatInto(make([]byte, 64), []byte{255, 255, 255, 255, 0xbb, 0, 1, STATUS_UPNEEDED})
+	output, _ := butil.ConcatInto(make([]byte, 64), []byte{255, 255, 255, 255, 0x90, 0, 3, 0x00, 0xa0, 0xf6})
+	baseDevice.output = butil.Concat(keepAlive1, keepAlive2, output)
+	expectedInput, _ := butil.ConcatInto(make([]byte, 65), []byte{0, 255, 255, 255, 255, 0x90, 0, 3, 0x04, 1, 2})
+
+	statuses := []uint8{}
+	status, result, err := dev.SendCBOR(0x04, []byte{1, 2}, func(status uint8) {
+		statuses = append(statuses, status)
+	})
+	if err != nil {
+		t.Errorf("Did not expect error, but got %s", err.Error())
+	}
+	if status != 0 {
+		t.Errorf("Expected status 0 but got %#x", status)
+	}
+	if !bytes.Equal(result, []byte{0xa0, 0xf6}) {
+		t.Errorf("Expected result %v but got %v", []byte{0xa0, 0xf6}, result)
+	}
+	if !bytes.Equal(expectedInput, baseDevice.input) {
+		t.Errorf("Expected %v but got %v", expectedInput, baseDevice.input)
+	}
+	if !bytes.Equal(statuses, []byte{STATUS_PROCESSING, STATUS_UPNEEDED}) {
+		t.Errorf("Expected keep alive statuses %v but got %v", []byte{STATUS_PROCESSING, STATUS_UPNEEDED}, statuses)
+	}
+
+	// Empty response
+	baseDevice = &testWrapperDevice{}
+	dev = newHidDevice(baseDevice)
+	baseDevice.output, _ = butil.ConcatInto(make([]byte, 64), []byte{255, 255, 255, 255, 0x90, 0, 0})
+	_, _, err = dev.SendCBOR(0x04, []byte{}, nil)
+	if err == nil {
+		t.Errorf("Expected error but got nil")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	baseDevice, dev := testDevice()
+	dev.channelId = 4
+	err := dev.Cancel()
+	if err != nil {
+		t.Errorf("Did not expect error, but got %s", err.Error())
+	}
+	expectedInput, _ := butil.ConcatInto(make([]byte, 65), []byte{0, 0, 0, 0, 4, 0x91, 0, 0})
+	if !bytes.Equal(expectedInput, baseDevice.input) {
+		t.Errorf("Expected %v but got %v", expectedInput, baseDevice.input)
+	}
+}
+
+func TestWink(t *testing.T) {
+	baseDevice, dev := testDevice()
+	dev.channelId = 4
+	baseDevice.output, _ = butil.ConcatInto(make([]byte, 64), []byte{0, 0, 0, 4, 0x88, 0, 0})
+	err := dev.Wink()
+	if err != nil {
+		t.Errorf("Did not expect error, but got %s", err.Error())
+	}
+	expectedInput, _ := butil.ConcatInto(make([]byte, 65), []byte{0, 0, 0, 0, 4, 0x88, 0, 0})
+	if !bytes.Equal(expectedInput, baseDevice.input) {
+		t.Errorf("Expected %v but got %v", expectedInput, baseDevice.input)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	_, dev := testDevice()
+	dev.info = DeviceInfo{Path: "path", Serial: "serial"}
+	if dev.Info() != dev.info {
+		t.Errorf("Expected %+v but got %+v", dev.info, dev.Info())
+	}
+}
+
 // Test internal functions for edge cases.
 
 func TestSendRequestError(t *testing.T) {
@@ -143,13 +238,13 @@ func TestReadResponseError(t *testing.T) {
 		t.Errorf("Expected error but got nil")
 	}
 
-	// Test error code response
-	subResponse := []byte{0, 0, 0, 4, 0xbf}
+	// Test error code response, the error code follows the 2 byte length
+	subResponse := []byte{0, 0, 0, 4, 0xbf, 0, 1, 0x06}
 	response, _ := butil.ConcatInto(make([]byte, 64), subResponse)
 	dev = &testWrapperDevice{output: response}
 	_, err = readResponse(dev, 4, 1)
-	if err == nil {
-		t.Errorf("Expected error but got nil")
+	if err == nil || err.Error() != "U2FHIDError: 0x06" {
+		t.Errorf("Expected U2FHIDError: 0x06 but got %v", err)
 	}
 
 	// Test bad CID
@@ -0,0 +1,81 @@
+package u2fhost
+
+import (
+	"errors"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The hmac-secret extension is defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#sctn-hmac-secret-extension
+
+const extensionHmacSecret = "hmac-secret"
+
+// hmac-secret extension input keys
+const (
+	hmacSecretKeyAgreement      = 0x01
+	hmacSecretSaltEnc           = 0x02
+	hmacSecretSaltAuth          = 0x03
+	hmacSecretPinUvAuthProtocol = 0x04
+)
+
+// Salts used to derive secrets with the hmac-secret extension.
+// The same credential and salt always derive the same secret, so a random salt
+// stored alongside the credential ID can be used to derive a symmetric key.
+type HmacSecretInput struct {
+	// A 32 byte salt.
+	Salt1 []byte
+	// An optional second 32 byte salt, typically used when rotating keys.
+	Salt2 []byte
+}
+
+// The secrets derived with the hmac-secret extension.
+type HmacSecretOutput struct {
+	// The 32 byte secret derived from Salt1.
+	Output1 []byte
+	// The 32 byte secret derived from Salt2, only set if Salt2 was provided.
+	Output2 []byte
+}
+
+// Returns the hmac-secret extension input, with the salts encrypted under the shared secret.
+func hmacSecretInput(secret *sharedSecret, input *HmacSecretInput) (cbor.Map, error) {
+	if len(input.Salt1) != 32 {
+		return nil, errors.New("HmacSecret Salt1 must be 32 bytes")
+	}
+	if input.Salt2 != nil && len(input.Salt2) != 32 {
+		return nil, errors.New("HmacSecret Salt2 must be 32 bytes")
+	}
+	saltEnc, err := secret.encrypt(append(append([]byte{}, input.Salt1...), input.Salt2...))
+	if err != nil {
+		return nil, err
+	}
+	extension := cbor.Map{
+		hmacSecretKeyAgreement: secret.keyAgreement,
+		hmacSecretSaltEnc:      saltEnc,
+		hmacSecretSaltAuth:     secret.authenticate(saltEnc),
+	}
+	if secret.protocol.version() != 1 {
+		extension[hmacSecretPinUvAuthProtocol] = secret.protocol.version()
+	}
+	return extension, nil
+}
+
+// Decrypts the hmac-secret extension output.
+func hmacSecretOutput(secret *sharedSecret, encrypted []byte, input *HmacSecretInput) (*HmacSecretOutput, error) {
+	decrypted, err := secret.decrypt(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	expectedLength := 32
+	if input.Salt2 != nil {
+		expectedLength = 64
+	}
+	if len(decrypted) != expectedLength {
+		return nil, errors.New("Unexpected hmac-secret output length")
+	}
+	output := &HmacSecretOutput{Output1: decrypted[:32]}
+	if input.Salt2 != nil {
+		output.Output2 = decrypted[32:]
+	}
+	return output, nil
+}
@@ -0,0 +1,322 @@
+package u2fhost
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The large-blob array is defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorLargeBlobs
+
+const extensionLargeBlobKey = "largeBlobKey"
+
+// CTAP2 authenticatorLargeBlobs parameter keys
+const (
+	largeBlobsGet               = 0x01
+	largeBlobsSet               = 0x02
+	largeBlobsOffset            = 0x03
+	largeBlobsLength            = 0x04
+	largeBlobsPinUvAuthParam    = 0x05
+	largeBlobsPinUvAuthProtocol = 0x06
+)
+
+// CTAP2 authenticatorLargeBlobs response keys
+const (
+	largeBlobsResponseConfig = 0x01
+)
+
+// Large-blob map keys
+const (
+	largeBlobCiphertext = 0x01
+	largeBlobNonce      = 0x02
+	largeBlobOrigSize   = 0x03
+)
+
+const (
+	largeBlobChecksumLength = 16
+	largeBlobNonceLength    = 12
+	// The maximum message size devices must support if they don't report one.
+	ctap2DefaultMaxMsgSize = 1024
+)
+
+// A LargeBlob is an entry in the authenticator's large-blob array.
+// Entries are encrypted with the largeBlobKey of the credential they belong to,
+// use NewLargeBlob and Decrypt to create and read them.
+type LargeBlob struct {
+	Ciphertext []byte
+	Nonce      []byte
+	// The length of the data before it was compressed.
+	OrigSize int
+
+	// Entries that are not valid large-blob maps are kept as is,
+	// so they are not lost when writing the array back to the device.
+	raw interface{}
+}
+
+// Reads the large-blob array from the device, returning its entries.
+// The array is read in fragments that fit in the device's maximum message size,
+// and its checksum is verified before it is decoded.
+func (dev *HidDevice) ReadLargeBlobs() ([]*LargeBlob, error) {
+	info, err := dev.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	fragmentLength := maxFragmentLength(info)
+	serialized := []byte{}
+	for {
+		response, err := dev.callCTAP2(ctap2CommandLargeBlobs, cbor.Map{
+			largeBlobsGet:    fragmentLength,
+			largeBlobsOffset: len(serialized),
+		})
+		if err != nil {
+			return nil, err
+		}
+		fragment, ok := response.Bytes(largeBlobsResponseConfig)
+		if !ok {
+			return nil, errors.New("Device did not return a large-blob fragment")
+		}
+		serialized = append(serialized, fragment...)
+		if len(fragment) < fragmentLength {
+			break
+		}
+	}
+	return parseLargeBlobArray(serialized)
+}
+
+// Writes the large-blob array to the device, replacing all existing entries.
+// The token must have the PermissionLargeBlobWrite permission, and may be nil
+// if the device does not have a PIN set or built in user verification.
+func (dev *HidDevice) WriteLargeBlobs(blobs []*LargeBlob, token *PinUvAuthToken) error {
+	info, err := dev.GetInfo()
+	if err != nil {
+		return err
+	}
+	serialized, err := serializeLargeBlobArray(blobs)
+	if err != nil {
+		return err
+	}
+	if info.MaxSerializedLargeBlobArray > 0 && len(serialized) > info.MaxSerializedLargeBlobArray {
+		return fmt.Errorf("Large-blob array of %d bytes exceeds the device maximum of %d bytes", len(serialized), info.MaxSerializedLargeBlobArray)
+	}
+	fragmentLength := maxFragmentLength(info)
+	for offset := 0; offset < len(serialized); offset += fragmentLength {
+		end := offset + fragmentLength
+		if end > len(serialized) {
+			end = len(serialized)
+		}
+		fragment := serialized[offset:end]
+		params := cbor.Map{
+			largeBlobsSet:    fragment,
+			largeBlobsOffset: offset,
+		}
+		if offset == 0 {
+			params[largeBlobsLength] = len(serialized)
+		}
+		if token != nil {
+			params[largeBlobsPinUvAuthParam] = token.authenticate(largeBlobsAuthMessage(offset, fragment))
+			params[largeBlobsPinUvAuthProtocol] = token.protocol.version()
+		}
+		_, err = dev.callCTAP2(ctap2CommandLargeBlobs, params)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates an entry containing the data, encrypted with the credential's largeBlobKey.
+func NewLargeBlob(largeBlobKey, data []byte) (*LargeBlob, error) {
+	compressed := &bytes.Buffer{}
+	writer, err := flate.NewWriter(compressed, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	writer.Write(data)
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := largeBlobAEAD(largeBlobKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, largeBlobNonceLength)
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &LargeBlob{
+		Ciphertext: aead.Seal(nil, nonce, compressed.Bytes(), largeBlobAssociatedData(len(data))),
+		Nonce:      nonce,
+		OrigSize:   len(data),
+	}, nil
+}
+
+// Decrypts the entry with the credential's largeBlobKey, returning an error
+// if the entry belongs to another credential.
+func (b *LargeBlob) Decrypt(largeBlobKey []byte) ([]byte, error) {
+	if b.raw != nil {
+		return nil, errors.New("Large-blob entry is not a valid large-blob map")
+	}
+	aead, err := largeBlobAEAD(largeBlobKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Nonce) != largeBlobNonceLength {
+		return nil, errors.New("Invalid large-blob nonce length")
+	}
+	compressed, err := aead.Open(nil, b.Nonce, b.Ciphertext, largeBlobAssociatedData(b.OrigSize))
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != b.OrigSize {
+		return nil, errors.New("Large-blob entry does not match its original size")
+	}
+	return data, nil
+}
+
+// Returns the data of the first entry that belongs to the credential with the largeBlobKey.
+func FindLargeBlob(blobs []*LargeBlob, largeBlobKey []byte) ([]byte, bool) {
+	for _, blob := range blobs {
+		data, err := blob.Decrypt(largeBlobKey)
+		if err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// Returns a copy of the entries with those belonging to the credential with the
+// largeBlobKey replaced by a single entry containing the data.
+// If data is nil the credential's entries are removed.
+func SetLargeBlob(blobs []*LargeBlob, largeBlobKey, data []byte) ([]*LargeBlob, error) {
+	result := []*LargeBlob{}
+	for _, blob := range blobs {
+		if _, err := blob.Decrypt(largeBlobKey); err != nil {
+			result = append(result, blob)
+		}
+	}
+	if data == nil {
+		return result, nil
+	}
+	blob, err := NewLargeBlob(largeBlobKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return append(result, blob), nil
+}
+
+// The maximum fragment length is the maximum message size, minus room
+// for the rest of the request.
+func maxFragmentLength(info *AuthenticatorInfo) int {
+	maxMsgSize := info.MaxMsgSize
+	if maxMsgSize == 0 {
+		maxMsgSize = ctap2DefaultMaxMsgSize
+	}
+	return maxMsgSize - 64
+}
+
+// The message authenticated by the pinUvAuthParam when writing a fragment.
+func largeBlobsAuthMessage(offset int, fragment []byte) []byte {
+	message := bytes.Repeat([]byte{0xff}, 32)
+	message = append(message, ctap2CommandLargeBlobs, 0x00)
+	offsetBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(offsetBytes, uint32(offset))
+	message = append(message, offsetBytes...)
+	return append(message, sha256(fragment)...)
+}
+
+func largeBlobAEAD(largeBlobKey []byte) (cipher.AEAD, error) {
+	if len(largeBlobKey) != 32 {
+		return nil, errors.New("largeBlobKey must be 32 bytes")
+	}
+	block, err := aes.NewCipher(largeBlobKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func largeBlobAssociatedData(origSize int) []byte {
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(origSize))
+	return append([]byte("blob"), size...)
+}
+
+// Verifies the trailing checksum of the serialized array and decodes its entries.
+func parseLargeBlobArray(serialized []byte) ([]*LargeBlob, error) {
+	if len(serialized) < largeBlobChecksumLength {
+		return nil, errors.New("Large-blob array is shorter than its checksum")
+	}
+	array := serialized[:len(serialized)-largeBlobChecksumLength]
+	checksum := serialized[len(serialized)-largeBlobChecksumLength:]
+	if !bytes.Equal(checksum, sha256(array)[:largeBlobChecksumLength]) {
+		return nil, errors.New("Large-blob array checksum does not match")
+	}
+	value, err := cbor.Unmarshal(array)
+	if err != nil {
+		return nil, err
+	}
+	entries, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("Large-blob array is not a CBOR array")
+	}
+	blobs := make([]*LargeBlob, len(entries))
+	for i, entry := range entries {
+		blobs[i] = parseLargeBlob(entry)
+	}
+	return blobs, nil
+}
+
+func parseLargeBlob(entry interface{}) *LargeBlob {
+	m, ok := entry.(cbor.Map)
+	if !ok {
+		return &LargeBlob{raw: entry}
+	}
+	ciphertext, ok1 := m.Bytes(largeBlobCiphertext)
+	nonce, ok2 := m.Bytes(largeBlobNonce)
+	origSize, ok3 := m.Int(largeBlobOrigSize)
+	if !ok1 || !ok2 || !ok3 {
+		return &LargeBlob{raw: entry}
+	}
+	return &LargeBlob{
+		Ciphertext: ciphertext,
+		Nonce:      nonce,
+		OrigSize:   int(origSize),
+	}
+}
+
+// Encodes the entries and appends the checksum.
+func serializeLargeBlobArray(blobs []*LargeBlob) ([]byte, error) {
+	entries := make([]interface{}, len(blobs))
+	for i, blob := range blobs {
+		if blob.raw != nil {
+			entries[i] = blob.raw
+		} else {
+			entries[i] = cbor.Map{
+				largeBlobCiphertext: blob.Ciphertext,
+				largeBlobNonce:      blob.Nonce,
+				largeBlobOrigSize:   blob.OrigSize,
+			}
+		}
+	}
+	array, err := cbor.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	return append(array, sha256(array)[:largeBlobChecksumLength]...), nil
+}
@@ -0,0 +1,156 @@
+package u2fhost
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLargeBlobEncryption(t *testing.T) {
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+	data := []byte("ssh-ecdsa-cert-v01@openssh.com AAAA")
+
+	blob, err := NewLargeBlob(key1, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if blob.OrigSize != len(data) || len(blob.Nonce) != 12 {
+		t.Errorf("Unexpected entry %#v", blob)
+	}
+	decrypted, err := blob.Decrypt(key1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Expected %s but got %s", data, decrypted)
+	}
+	_, err = blob.Decrypt(key2)
+	if err == nil {
+		t.Errorf("Expected error decrypting with the wrong key")
+	}
+	_, err = NewLargeBlob([]byte{1}, data)
+	if err == nil {
+		t.Errorf("Expected error for short key")
+	}
+
+	// Set, find and remove entries for a credential
+	other, _ := NewLargeBlob(key2, []byte("other"))
+	blobs, err := SetLargeBlob([]*LargeBlob{blob, other}, key1, []byte("replaced"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(blobs) != 2 {
+		t.Errorf("Expected 2 entries, but got %d", len(blobs))
+	}
+	if found, ok := FindLargeBlob(blobs, key1); !ok || string(found) != "replaced" {
+		t.Errorf("Expected to find \"replaced\", but got %s", found)
+	}
+	blobs, _ = SetLargeBlob(blobs, key1, nil)
+	if _, ok := FindLargeBlob(blobs, key1); ok || len(blobs) != 1 {
+		t.Errorf("Expected entry to be removed, but got %d entries", len(blobs))
+	}
+}
+
+func TestReadWriteLargeBlobs(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	// Force several fragments
+	authenticator.info[getInfoMaxMsgSize] = 100
+
+	// The initial array is empty
+	blobs, err := dev.ReadLargeBlobs()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("Expected empty array, but got %d entries", len(blobs))
+	}
+
+	data := bytes.Repeat([]byte("large blob data "), 20)
+	blobs, _ = SetLargeBlob(blobs, authenticator.largeBlobKey, data)
+	// Entries that are not valid maps are preserved
+	blobs = append(blobs, &LargeBlob{raw: "unknown"})
+	err = dev.WriteLargeBlobs(blobs, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(authenticator.largeBlobs) <= 36 {
+		t.Errorf("Expected the array to be written in several fragments, but got %d bytes", len(authenticator.largeBlobs))
+	}
+
+	blobs, err = dev.ReadLargeBlobs()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(blobs) != 2 || blobs[1].raw != "unknown" {
+		t.Errorf("Expected 2 entries, but got %#v", blobs)
+	}
+	if found, ok := FindLargeBlob(blobs, authenticator.largeBlobKey); !ok || !bytes.Equal(found, data) {
+		t.Errorf("Expected to find %s, but got %s", data, found)
+	}
+
+	// Corrupt checksum
+	authenticator.largeBlobs[len(authenticator.largeBlobs)-1] ^= 0xff
+	_, err = dev.ReadLargeBlobs()
+	if err == nil {
+		t.Errorf("Expected checksum error")
+	}
+
+	// Array larger than the device maximum
+	authenticator.info[getInfoMaxSerializedLargeBlobArray] = 64
+	err = dev.WriteLargeBlobs(blobs, nil)
+	if err == nil {
+		t.Errorf("Expected error writing an array larger than the maximum")
+	}
+}
+
+func TestWriteLargeBlobsWithPin(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	authenticator.pin = "1234"
+	authenticator.info[getInfoOptions] = map[string]bool{"clientPin": true, "pinUvAuthToken": true}
+
+	blobs, _ := SetLargeBlob(nil, authenticator.largeBlobKey, []byte("data"))
+	err := dev.WriteLargeBlobs(blobs, nil)
+	if _, ok := err.(*PinAuthInvalidError); !ok {
+		t.Errorf("Expected PinAuthInvalidError without a token, but got %#v", err)
+	}
+
+	token, err := dev.GetPinUvAuthToken("1234", PermissionLargeBlobWrite, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if authenticator.pinPermissions != int64(PermissionLargeBlobWrite) {
+		t.Errorf("Expected permissions %#x, but got %#x", PermissionLargeBlobWrite, authenticator.pinPermissions)
+	}
+	err = dev.WriteLargeBlobs(blobs, token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	read, _ := dev.ReadLargeBlobs()
+	if found, ok := FindLargeBlob(read, authenticator.largeBlobKey); !ok || string(found) != "data" {
+		t.Errorf("Expected to find data, but got %s", found)
+	}
+}
+
+func TestLargeBlobKeyExtension(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	req := sampleMakeCredentialRequest()
+	req.ResidentKey = true
+	req.Extensions.LargeBlobKey = true
+	response, err := dev.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(response.Extensions.LargeBlobKey, authenticator.largeBlobKey) {
+		t.Errorf("Expected largeBlobKey %x, but got %x", authenticator.largeBlobKey, response.Extensions.LargeBlobKey)
+	}
+
+	assertionReq := sampleGetAssertionRequest()
+	assertionReq.Extensions.LargeBlobKey = true
+	assertion, err := dev.GetAssertion(assertionReq)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(assertion.Extensions.LargeBlobKey, authenticator.largeBlobKey) {
+		t.Errorf("Expected largeBlobKey %x, but got %x", authenticator.largeBlobKey, assertion.Extensions.LargeBlobKey)
+	}
+}
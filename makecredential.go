@@ -0,0 +1,208 @@
+package u2fhost
+
+import (
+	"errors"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// CTAP2 authenticatorMakeCredential parameter keys
+const (
+	makeCredentialClientDataHash    = 0x01
+	makeCredentialRP                = 0x02
+	makeCredentialUser              = 0x03
+	makeCredentialPubKeyCredParams  = 0x04
+	makeCredentialExcludeList       = 0x05
+	makeCredentialExtensions        = 0x06
+	makeCredentialOptions           = 0x07
+	makeCredentialPinUvAuthParam    = 0x08
+	makeCredentialPinUvAuthProtocol = 0x09
+)
+
+// CTAP2 authenticatorMakeCredential response keys
+const (
+	makeCredentialResponseFormat       = 0x01
+	makeCredentialResponseAuthData     = 0x02
+	makeCredentialResponseAttStmt      = 0x03
+	makeCredentialResponseLargeBlobKey = 0x05
+)
+
+// The relying party a CTAP2 credential is scoped to.
+type RelyingPartyEntity struct {
+	// The RP ID, typically the domain of the relying party.
+	ID   string
+	Name string
+}
+
+// The user account a CTAP2 credential is created for.
+type UserEntity struct {
+	// An opaque user handle, at most 64 bytes.
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+// A MakeCredentialRequest is used when creating a new credential on a CTAP2 device.
+type MakeCredentialRequest struct {
+	// SHA-256 hash of the client data the credential is created for.
+	ClientDataHash []byte
+
+	RelyingParty RelyingPartyEntity
+
+	User UserEntity
+
+	// COSE algorithm identifiers in order of preference, defaults to ES256.
+	Algorithms []int
+
+	// Credential IDs that must not already exist on the device.
+	ExcludeList [][]byte
+
+	// Optional boolean (defaults to false) that when true, will store the
+	// credential on the device so it can be discovered without its ID.
+	ResidentKey bool
+
+	// Optional boolean (defaults to false) that when true, requires the device to verify the user.
+	UserVerification bool
+
+	// Optional extension inputs.
+	Extensions MakeCredentialExtensions
+
+	// Optional PIN/UV auth token, required by devices that have a PIN set.
+	PinUvAuthToken *PinUvAuthToken
+}
+
+// A response from a MakeCredential operation.
+type MakeCredentialResponse struct {
+	// The attestation statement format, such as "packed" or "fido-u2f".
+	Format string
+	// The raw authenticator data, which is covered by the attestation signature.
+	AuthData             []byte
+	AuthenticatorData    *AuthenticatorData
+	AttestationStatement cbor.Map
+	// Whether a discoverable credential was requested.
+	ResidentKey bool
+
+	// The extension outputs.
+	Extensions MakeCredentialExtensionOutputs
+}
+
+// Creates a new credential on a CTAP2 device using the MakeCredentialRequest,
+// returning a MakeCredentialResponse.
+func (dev *HidDevice) MakeCredential(req *MakeCredentialRequest) (*MakeCredentialResponse, error) {
+	params, err := makeCredentialRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := dev.callCTAP2(ctap2CommandMakeCredential, params)
+	if err != nil {
+		return nil, err
+	}
+	makeCredentialResponse, err := makeCredentialResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	makeCredentialResponse.ResidentKey = req.ResidentKey
+	return makeCredentialResponse, nil
+}
+
+func makeCredentialRequest(req *MakeCredentialRequest) (cbor.Map, error) {
+	if len(req.ClientDataHash) != 32 {
+		return nil, errors.New("ClientDataHash must be 32 bytes")
+	}
+	if req.RelyingParty.ID == "" {
+		return nil, errors.New("RelyingParty ID must be set")
+	}
+	if len(req.User.ID) == 0 || len(req.User.ID) > 64 {
+		return nil, errors.New("User ID must be between 1 and 64 bytes")
+	}
+	rp := cbor.Map{"id": req.RelyingParty.ID}
+	if req.RelyingParty.Name != "" {
+		rp["name"] = req.RelyingParty.Name
+	}
+	user := cbor.Map{"id": req.User.ID}
+	if req.User.Name != "" {
+		user["name"] = req.User.Name
+	}
+	if req.User.DisplayName != "" {
+		user["displayName"] = req.User.DisplayName
+	}
+	algorithms := req.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []int{coseAlgES256}
+	}
+	credParams := []interface{}{}
+	for _, alg := range algorithms {
+		credParams = append(credParams, cbor.Map{"alg": alg, "type": credentialTypePublicKey})
+	}
+	params := cbor.Map{
+		makeCredentialClientDataHash:   req.ClientDataHash,
+		makeCredentialRP:               rp,
+		makeCredentialUser:             user,
+		makeCredentialPubKeyCredParams: credParams,
+	}
+	if len(req.ExcludeList) > 0 {
+		params[makeCredentialExcludeList] = credentialDescriptors(req.ExcludeList)
+	}
+	extensions, err := req.Extensions.encode()
+	if err != nil {
+		return nil, err
+	}
+	if extensions != nil {
+		params[makeCredentialExtensions] = extensions
+	}
+	if req.PinUvAuthToken != nil {
+		params[makeCredentialPinUvAuthParam] = req.PinUvAuthToken.authenticate(req.ClientDataHash)
+		params[makeCredentialPinUvAuthProtocol] = req.PinUvAuthToken.protocol.version()
+	}
+	options := cbor.Map{}
+	if req.ResidentKey {
+		options["rk"] = true
+	}
+	if req.UserVerification {
+		options["uv"] = true
+	}
+	if len(options) > 0 {
+		params[makeCredentialOptions] = options
+	}
+	return params, nil
+}
+
+func makeCredentialResponse(response cbor.Map) (*MakeCredentialResponse, error) {
+	format, ok := response.String(makeCredentialResponseFormat)
+	if !ok {
+		return nil, errors.New("MakeCredential response is missing the attestation format")
+	}
+	authData, ok := response.Bytes(makeCredentialResponseAuthData)
+	if !ok {
+		return nil, errors.New("MakeCredential response is missing the authenticator data")
+	}
+	attStmt, ok := response.Map(makeCredentialResponseAttStmt)
+	if !ok {
+		return nil, errors.New("MakeCredential response is missing the attestation statement")
+	}
+	parsed, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.CredentialID == nil {
+		return nil, errors.New("MakeCredential response is missing the attested credential data")
+	}
+	makeCredentialResponse := &MakeCredentialResponse{
+		Format:               format,
+		AuthData:             authData,
+		AuthenticatorData:    parsed,
+		AttestationStatement: attStmt,
+	}
+	largeBlobKey, _ := response.Bytes(makeCredentialResponseLargeBlobKey)
+	makeCredentialResponse.Extensions = decodeMakeCredentialExtensions(parsed.Extensions, largeBlobKey)
+	return makeCredentialResponse, nil
+}
+
+// Returns the PublicKeyCredentialDescriptor list for the credential IDs.
+func credentialDescriptors(ids [][]byte) []interface{} {
+	descriptors := make([]interface{}, len(ids))
+	for i, id := range ids {
+		descriptors[i] = cbor.Map{"id": id, "type": credentialTypePublicKey}
+	}
+	return descriptors
+}
@@ -0,0 +1,85 @@
+package u2fhost
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+func sampleMakeCredentialRequest() *MakeCredentialRequest {
+	return &MakeCredentialRequest{
+		ClientDataHash: sha256([]byte("client data")),
+		RelyingParty:   RelyingPartyEntity{ID: "example.com", Name: "Example"},
+		User:           UserEntity{ID: []byte{1, 2, 3}, Name: "user"},
+	}
+}
+
+func sampleMakeCredentialParams(hmacSecret bool) cbor.Map {
+	req := sampleMakeCredentialRequest()
+	req.Extensions.HmacSecret = hmacSecret
+	params, _ := makeCredentialRequest(req)
+	return params
+}
+
+func TestMakeCredential(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+
+	// Happy path
+	req := sampleMakeCredentialRequest()
+	req.Extensions.HmacSecret = true
+	req.ResidentKey = true
+	req.ExcludeList = [][]byte{[]byte("excluded")}
+	response, err := dev.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error calling MakeCredential: %s", err)
+	}
+	if response.Format != "none" {
+		t.Errorf("Expected format none, but got %s", response.Format)
+	}
+	if !bytes.Equal(response.AuthenticatorData.CredentialID, authenticator.credentialID) {
+		t.Errorf("Expected credential id %x, but got %x", authenticator.credentialID, response.AuthenticatorData.CredentialID)
+	}
+	if !response.Extensions.HmacSecret {
+		t.Errorf("Expected hmac-secret to be enabled")
+	}
+	params := authenticator.requests[ctap2CommandMakeCredential]
+	if hash, _ := params.Bytes(makeCredentialClientDataHash); !bytes.Equal(hash, req.ClientDataHash) {
+		t.Errorf("Expected client data hash %x, but got %x", req.ClientDataHash, hash)
+	}
+	if options, _ := params.Map(makeCredentialOptions); options == nil {
+		t.Errorf("Expected options in request")
+	} else if rk, _ := options.Bool("rk"); !rk {
+		t.Errorf("Expected rk option to be true")
+	}
+	if excludeList, _ := params.Array(makeCredentialExcludeList); len(excludeList) != 1 {
+		t.Errorf("Expected an exclude list with 1 credential, but got %#v", excludeList)
+	}
+	credParams, _ := params.Array(makeCredentialPubKeyCredParams)
+	if len(credParams) != 1 {
+		t.Errorf("Expected a single default algorithm, but got %#v", credParams)
+	} else if alg, _ := credParams[0].(cbor.Map).Int("alg"); alg != coseAlgES256 {
+		t.Errorf("Expected default algorithm ES256, but got %d", alg)
+	}
+
+	// Invalid requests
+	req = sampleMakeCredentialRequest()
+	req.ClientDataHash = []byte{1}
+	_, err = dev.MakeCredential(req)
+	if err == nil {
+		t.Errorf("Expected error for short client data hash")
+	}
+	req = sampleMakeCredentialRequest()
+	req.User.ID = nil
+	_, err = dev.MakeCredential(req)
+	if err == nil {
+		t.Errorf("Expected error for missing user id")
+	}
+
+	// Error status
+	authenticator.status = ctap2StatusCredentialExcluded
+	_, err = dev.MakeCredential(sampleMakeCredentialRequest())
+	if _, ok := err.(*CredentialExcludedError); !ok {
+		t.Errorf("Expected CredentialExcludedError, but got %#v", err)
+	}
+}
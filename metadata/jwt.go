@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// The BLOB is a JWS in compact serialization, with the signing certificate chain in the x5c header.
+// https://www.rfc-editor.org/rfc/rfc7515.html
+type jwtHeader struct {
+	Alg string   `json:"alg"`
+	Typ string   `json:"typ"`
+	X5c []string `json:"x5c"`
+}
+
+// Verifies the JWT signature and certificate chain, returning the decoded payload.
+func verifyJWT(data []byte, roots *x509.CertPool) ([]byte, error) {
+	if roots == nil {
+		return nil, errors.New("metadata: a root certificate pool is required to verify the BLOB")
+	}
+	parts := strings.Split(string(data), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("metadata: the BLOB is not a JWT")
+	}
+	encodedHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("metadata: invalid JWT header: %s", err)
+	}
+	var header jwtHeader
+	err = json.Unmarshal(encodedHeader, &header)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: invalid JWT header: %s", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("metadata: invalid JWT payload: %s", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("metadata: invalid JWT signature: %s", err)
+	}
+
+	certificates, err := parseX5c(header.X5c)
+	if err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	_, err = certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("metadata: the BLOB signing certificate is not trusted: %s", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = verifySignature(header.Alg, certificates[0].PublicKey, hash[:], signature)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Parses the standard base64 encoded DER certificates of the x5c header, leaf first.
+func parseX5c(x5c []string) ([]*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, errors.New("metadata: the JWT header has no x5c certificates")
+	}
+	certificates := make([]*x509.Certificate, len(x5c))
+	for i, encoded := range x5c {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: invalid x5c certificate: %s", err)
+		}
+		certificates[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: invalid x5c certificate: %s", err)
+		}
+	}
+	return certificates, nil
+}
+
+// Verifies the SHA-256 hash was signed with the key, using the JWS algorithm.
+func verifySignature(alg string, publicKey interface{}, hash, signature []byte) error {
+	valid := false
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "RS256":
+			valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash, signature) == nil
+		case "PS256":
+			valid = rsa.VerifyPSS(key, crypto.SHA256, hash, signature, nil) == nil
+		default:
+			return fmt.Errorf("metadata: unsupported JWT algorithm %q for an RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return fmt.Errorf("metadata: unsupported JWT algorithm %q for an ECDSA key", alg)
+		}
+		// JWS ECDSA signatures are the fixed length r and s values
+		if len(signature) != 64 {
+			return errors.New("metadata: invalid ES256 signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		valid = ecdsa.Verify(key, hash, r, s)
+	default:
+		return errors.New("metadata: unsupported BLOB signing key")
+	}
+	if !valid {
+		return errors.New("metadata: invalid BLOB signature")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package metadata
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A BLOB signing certificate issued by a test root.
+type testSigner struct {
+	root *x509.Certificate
+	key  crypto.Signer
+	leaf []byte
+	alg  string
+}
+
+func newTestSigner(t *testing.T, useRSA bool) *testSigner {
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Metadata Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDer, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create root certificate: %s", err)
+	}
+	root, _ := x509.ParseCertificate(rootDer)
+
+	signer := &testSigner{root: root, alg: "ES256"}
+	if useRSA {
+		signer.key, _ = rsa.GenerateKey(rand.Reader, 2048)
+		signer.alg = "RS256"
+	} else {
+		signer.key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Metadata Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	signer.leaf, err = x509.CreateCertificate(rand.Reader, template, root, signer.key.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create signing certificate: %s", err)
+	}
+	return signer
+}
+
+func (s *testSigner) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(s.root)
+	return roots
+}
+
+// Returns the payload as a signed JWT.
+func (s *testSigner) sign(payload []byte) []byte {
+	header, _ := json.Marshal(jwtHeader{Alg: s.alg, Typ: "JWT", X5c: []string{base64.StdEncoding.EncodeToString(s.leaf)}})
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(input))
+	var signature []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	case *ecdsa.PrivateKey:
+		r, sig, _ := ecdsa.Sign(rand.Reader, key, hash[:])
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		sig.FillBytes(signature[32:])
+	}
+	return []byte(input + "." + base64.RawURLEncoding.EncodeToString(signature))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	payload := []byte(`{"no":1}`)
+	for _, useRSA := range []bool{false, true} {
+		signer := newTestSigner(t, useRSA)
+		jwt := signer.sign(payload)
+		verified, err := verifyJWT(jwt, signer.roots())
+		if err != nil || string(verified) != string(payload) {
+			t.Errorf("Expected the %s payload to verify, but got %s %s", signer.alg, verified, err)
+		}
+
+		// Untrusted root
+		if _, err = verifyJWT(jwt, x509.NewCertPool()); err == nil {
+			t.Errorf("Expected error for an untrusted %s signing certificate", signer.alg)
+		}
+		if _, err = verifyJWT(jwt, nil); err == nil {
+			t.Errorf("Expected error without a root pool")
+		}
+
+		// Modified payload
+		parts := strings.Split(string(jwt), ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"no":2}`))
+		if _, err = verifyJWT([]byte(strings.Join(parts, ".")), signer.roots()); err == nil {
+			t.Errorf("Expected error for a modified %s payload", signer.alg)
+		}
+	}
+
+	if _, err := verifyJWT([]byte("not a jwt"), x509.NewCertPool()); err == nil {
+		t.Errorf("Expected error for an invalid JWT")
+	}
+}
@@ -0,0 +1,235 @@
+// Package metadata parses the FIDO Metadata Service (MDS3) BLOB, to identify
+// authenticator models and check their status reports.
+// https://fidoalliance.org/specs/mds/fido-metadata-service-v3.0-ps-20210518.html
+package metadata
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+)
+
+// Authenticator statuses
+const (
+	StatusNotFIDOCertified          = "NOT_FIDO_CERTIFIED"
+	StatusFIDOCertified             = "FIDO_CERTIFIED"
+	StatusUserVerificationBypass    = "USER_VERIFICATION_BYPASS"
+	StatusAttestationKeyCompromise  = "ATTESTATION_KEY_COMPROMISE"
+	StatusUserKeyRemoteCompromise   = "USER_KEY_REMOTE_COMPROMISE"
+	StatusUserKeyPhysicalCompromise = "USER_KEY_PHYSICAL_COMPROMISE"
+	StatusUpdateAvailable           = "UPDATE_AVAILABLE"
+	StatusRevoked                   = "REVOKED"
+	StatusSelfAssertionSubmitted    = "SELF_ASSERTION_SUBMITTED"
+)
+
+// Statuses that mean the authenticator should no longer be trusted.
+var revokedStatuses = map[string]bool{
+	StatusUserVerificationBypass:    true,
+	StatusAttestationKeyCompromise:  true,
+	StatusUserKeyRemoteCompromise:   true,
+	StatusUserKeyPhysicalCompromise: true,
+	StatusRevoked:                   true,
+}
+
+// The payload of the metadata BLOB.
+type BLOB struct {
+	LegalHeader string `json:"legalHeader"`
+	// The serial number of the BLOB, which increases with each update.
+	Number int `json:"no"`
+	// The date the next BLOB is expected, such as 2021-06-01.
+	NextUpdate string  `json:"nextUpdate"`
+	Entries    []Entry `json:"entries"`
+}
+
+// An Entry describes one authenticator model.
+type Entry struct {
+	// The AAGUID of FIDO2 authenticators, such as cb69481e-8ff7-4039-93ec-0a2729a154a8.
+	AAGUID string `json:"aaguid,omitempty"`
+	// Hex encoded key identifiers of the attestation certificates of U2F authenticators.
+	AttestationCertificateKeyIdentifiers []string           `json:"attestationCertificateKeyIdentifiers,omitempty"`
+	MetadataStatement                    *MetadataStatement `json:"metadataStatement,omitempty"`
+	StatusReports                        []StatusReport     `json:"statusReports"`
+	TimeOfLastStatusChange               string             `json:"timeOfLastStatusChange"`
+}
+
+// The MetadataStatement fields used to identify and trust an authenticator.
+type MetadataStatement struct {
+	Description          string   `json:"description"`
+	AuthenticatorVersion int      `json:"authenticatorVersion"`
+	ProtocolFamily       string   `json:"protocolFamily"`
+	Schema               int      `json:"schema"`
+	AttestationTypes     []string `json:"attestationTypes"`
+	// Standard base64 encoded DER certificates.
+	AttestationRootCertificates []string `json:"attestationRootCertificates"`
+	Icon                        string   `json:"icon,omitempty"`
+}
+
+// A StatusReport records a change in the certification or security status of an authenticator.
+type StatusReport struct {
+	Status string `json:"status"`
+	// The date the status took effect, such as 2021-06-01.
+	EffectiveDate                    string `json:"effectiveDate,omitempty"`
+	AuthenticatorVersion             int    `json:"authenticatorVersion,omitempty"`
+	Certificate                      string `json:"certificate,omitempty"`
+	URL                              string `json:"url,omitempty"`
+	CertificationDescriptor          string `json:"certificationDescriptor,omitempty"`
+	CertificateNumber                string `json:"certificateNumber,omitempty"`
+	CertificationPolicyVersion       string `json:"certificationPolicyVersion,omitempty"`
+	CertificationRequirementsVersion string `json:"certificationRequirementsVersion,omitempty"`
+}
+
+// Metadata is a verified BLOB, indexed by AAGUID and attestation certificate key identifier.
+type Metadata struct {
+	BLOB
+	byAAGUID        map[string]*Entry
+	byKeyIdentifier map[string]*Entry
+}
+
+// Reads and parses the metadata BLOB file, see Parse.
+func Load(path string, roots *x509.CertPool) (*Metadata, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, roots)
+}
+
+// Parses the metadata BLOB JWT, verifying its signing certificate chains to one of the roots,
+// such as the FIDO Alliance root certificate.
+func Parse(data []byte, roots *x509.CertPool) (*Metadata, error) {
+	payload, err := verifyJWT(bytes.TrimSpace(data), roots)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &Metadata{
+		byAAGUID:        map[string]*Entry{},
+		byKeyIdentifier: map[string]*Entry{},
+	}
+	err = json.Unmarshal(payload, &metadata.BLOB)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: invalid BLOB payload: %s", err)
+	}
+	for i := range metadata.Entries {
+		entry := &metadata.Entries[i]
+		if entry.AAGUID != "" {
+			metadata.byAAGUID[normalizeAAGUID(entry.AAGUID)] = entry
+		}
+		for _, id := range entry.AttestationCertificateKeyIdentifiers {
+			metadata.byKeyIdentifier[strings.ToLower(id)] = entry
+		}
+	}
+	return metadata, nil
+}
+
+// Returns the entry for the AAGUID, or nil if there is none.
+func (m *Metadata) ByAAGUID(aaguid []byte) *Entry {
+	return m.byAAGUID[hex.EncodeToString(aaguid)]
+}
+
+// Returns the entry for the hex encoded attestation certificate key identifier, or nil if there is none.
+func (m *Metadata) ByKeyIdentifier(id string) *Entry {
+	return m.byKeyIdentifier[strings.ToLower(id)]
+}
+
+// Returns the entry for a verified attestation, or nil if the authenticator is unknown.
+// Authenticators with a zero AAGUID, such as U2F devices, are found by the key
+// identifier of their attestation certificate.
+func (m *Metadata) Lookup(result *u2f.AttestationResult) *Entry {
+	if len(result.AAGUID) > 0 && !bytes.Equal(result.AAGUID, make([]byte, len(result.AAGUID))) {
+		if entry := m.ByAAGUID(result.AAGUID); entry != nil {
+			return entry
+		}
+	}
+	if len(result.TrustPath) == 0 {
+		return nil
+	}
+	id, err := KeyIdentifier(result.TrustPath[0])
+	if err != nil {
+		return nil
+	}
+	return m.ByKeyIdentifier(id)
+}
+
+// Returns the entry for the device that created the U2F RegisterResponse, after
+// verifying its attestation signature, or nil if the device is unknown.
+func (m *Metadata) LookupRegisterResponse(response *u2f.RegisterResponse, appId string) (*Entry, error) {
+	result, err := u2f.VerifyRegisterResponse(response, appId, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.Lookup(result), nil
+}
+
+// Returns the most recent status report, or nil if there are none.
+func (e *Entry) Status() *StatusReport {
+	var latest *StatusReport
+	for i, report := range e.StatusReports {
+		if latest == nil || report.EffectiveDate >= latest.EffectiveDate {
+			latest = &e.StatusReports[i]
+		}
+	}
+	return latest
+}
+
+// Returns true if any status report says the authenticator should no longer be trusted,
+// such as REVOKED or ATTESTATION_KEY_COMPROMISE.
+func (e *Entry) Revoked() bool {
+	for _, report := range e.StatusReports {
+		if revokedStatuses[report.Status] {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the attestation root certificates from the metadata statement,
+// to verify attestations from the authenticator with.
+func (e *Entry) AttestationRoots() (*x509.CertPool, error) {
+	if e.MetadataStatement == nil || len(e.MetadataStatement.AttestationRootCertificates) == 0 {
+		return nil, errors.New("metadata: the entry has no attestation root certificates")
+	}
+	roots := x509.NewCertPool()
+	for _, encoded := range e.MetadataStatement.AttestationRootCertificates {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: invalid attestation root certificate: %s", err)
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: invalid attestation root certificate: %s", err)
+		}
+		roots.AddCert(certificate)
+	}
+	return roots, nil
+}
+
+// Returns the hex encoded key identifier of the certificate, the SHA-1 hash of
+// its public key as in RFC 5280 section 4.2.1.2.
+func KeyIdentifier(certificate *x509.Certificate) (string, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	_, err := asn1.Unmarshal(certificate.RawSubjectPublicKeyInfo, &info)
+	if err != nil {
+		return "", fmt.Errorf("metadata: invalid certificate public key: %s", err)
+	}
+	hash := sha1.Sum(info.PublicKey.Bytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Returns the AAGUID as lower case hex without dashes.
+func normalizeAAGUID(aaguid string) string {
+	return strings.ToLower(strings.Replace(aaguid, "-", "", -1))
+}
@@ -0,0 +1,199 @@
+package metadata
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	u2f "github.com/marshallbrekka/go-u2fhost"
+)
+
+var testAAGUID = []byte{0xcb, 0x69, 0x48, 0x1e, 0x8f, 0xf7, 0x40, 0x39, 0x93, 0xec, 0x0a, 0x27, 0x29, 0xa1, 0x54, 0xa8}
+
+// A U2F attestation key and self signed certificate.
+type testU2FAttestation struct {
+	key         *ecdsa.PrivateKey
+	certificate []byte
+}
+
+func newTestU2FAttestation(t *testing.T) *testU2FAttestation {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "U2F Test Attestation"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	return &testU2FAttestation{key: key, certificate: certificate}
+}
+
+// Returns a RegisterResponse for a new key, signed by the attestation key.
+func (a *testU2FAttestation) register(appId string) *u2f.RegisterResponse {
+	credentialKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicKey := elliptic.Marshal(elliptic.P256(), credentialKey.X, credentialKey.Y)
+	keyHandle := []byte("key handle")
+	clientData := []byte(`{"typ":"navigator.id.finishEnrollment"}`)
+	appIdHash := sha256.Sum256([]byte(appId))
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append([]byte{0}, appIdHash[:]...)
+	signed = append(signed, clientDataHash[:]...)
+	signed = append(signed, keyHandle...)
+	signed = append(signed, publicKey...)
+	hash := sha256.Sum256(signed)
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, hash[:])
+	registrationData := append([]byte{0x05}, publicKey...)
+	registrationData = append(registrationData, byte(len(keyHandle)))
+	registrationData = append(registrationData, keyHandle...)
+	registrationData = append(registrationData, a.certificate...)
+	registrationData = append(registrationData, signature...)
+	return &u2f.RegisterResponse{
+		RegistrationData: base64.RawURLEncoding.EncodeToString(registrationData),
+		ClientData:       base64.RawURLEncoding.EncodeToString(clientData),
+	}
+}
+
+func testBLOB(t *testing.T, attestation *testU2FAttestation) []byte {
+	certificate, _ := x509.ParseCertificate(attestation.certificate)
+	keyIdentifier, err := KeyIdentifier(certificate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	blob := BLOB{
+		LegalHeader: "Test",
+		Number:      7,
+		NextUpdate:  "2030-01-01",
+		Entries: []Entry{{
+			AAGUID: "CB69481E-8FF7-4039-93EC-0A2729A154A8",
+			MetadataStatement: &MetadataStatement{
+				Description:                 "Test FIDO2 Key",
+				ProtocolFamily:              "fido2",
+				AttestationRootCertificates: []string{base64.StdEncoding.EncodeToString(attestation.certificate)},
+			},
+			StatusReports: []StatusReport{
+				{Status: StatusUpdateAvailable, EffectiveDate: "2021-03-01"},
+				{Status: StatusFIDOCertified, EffectiveDate: "2020-01-01"},
+			},
+		}, {
+			AttestationCertificateKeyIdentifiers: []string{keyIdentifier},
+			MetadataStatement:                    &MetadataStatement{Description: "Test U2F Key", ProtocolFamily: "u2f"},
+			StatusReports: []StatusReport{
+				{Status: StatusFIDOCertified, EffectiveDate: "2019-01-01"},
+				{Status: StatusAttestationKeyCompromise, EffectiveDate: "2020-01-01"},
+			},
+		}},
+	}
+	payload, _ := json.Marshal(blob)
+	return payload
+}
+
+func TestParse(t *testing.T) {
+	signer := newTestSigner(t, true)
+	attestation := newTestU2FAttestation(t)
+	metadata, err := Parse(signer.sign(testBLOB(t, attestation)), signer.roots())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if metadata.Number != 7 || len(metadata.Entries) != 2 {
+		t.Errorf("Unexpected BLOB %#v", metadata.BLOB)
+	}
+
+	// FIDO2 authenticators by AAGUID
+	entry := metadata.ByAAGUID(testAAGUID)
+	if entry == nil || entry.MetadataStatement.Description != "Test FIDO2 Key" {
+		t.Fatalf("Expected the FIDO2 entry, but got %#v", entry)
+	}
+	if status := entry.Status(); status == nil || status.Status != StatusUpdateAvailable {
+		t.Errorf("Expected the latest status to be %s, but got %#v", StatusUpdateAvailable, status)
+	}
+	if entry.Revoked() {
+		t.Errorf("Expected the FIDO2 entry not to be revoked")
+	}
+	roots, err := entry.AttestationRoots()
+	if err != nil || roots == nil {
+		t.Errorf("Expected the attestation roots, but got %s", err)
+	}
+	if metadata.ByAAGUID(make([]byte, 16)) != nil {
+		t.Errorf("Expected no entry for an unknown AAGUID")
+	}
+	result := &u2f.AttestationResult{AAGUID: testAAGUID}
+	if metadata.Lookup(result) != entry {
+		t.Errorf("Expected the FIDO2 entry for the attestation")
+	}
+
+	// U2F authenticators by attestation certificate key identifier
+	entry, err = metadata.LookupRegisterResponse(attestation.register("https://example.com"), "https://example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if entry == nil || entry.MetadataStatement.Description != "Test U2F Key" {
+		t.Fatalf("Expected the U2F entry, but got %#v", entry)
+	}
+	if !entry.Revoked() {
+		t.Errorf("Expected the U2F entry to be revoked")
+	}
+	if _, err = entry.AttestationRoots(); err == nil {
+		t.Errorf("Expected error for an entry without attestation roots")
+	}
+	_, err = metadata.LookupRegisterResponse(attestation.register("https://example.com"), "https://other.example.com")
+	if err == nil {
+		t.Errorf("Expected error for a register response that does not verify")
+	}
+	entry, err = metadata.LookupRegisterResponse(newTestU2FAttestation(t).register("https://example.com"), "https://example.com")
+	if err != nil || entry != nil {
+		t.Errorf("Expected no entry for an unknown device, but got %#v %s", entry, err)
+	}
+
+	// An untrusted BLOB
+	if _, err = Parse(signer.sign(testBLOB(t, attestation)), newTestSigner(t, false).roots()); err == nil {
+		t.Errorf("Expected error for a BLOB from an untrusted signer")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	signer := newTestSigner(t, false)
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blob.jwt")
+	ioutil.WriteFile(path, append(signer.sign(testBLOB(t, newTestU2FAttestation(t))), '\n'), 0600)
+	metadata, err := Load(path, signer.roots())
+	if err != nil || metadata.ByAAGUID(testAAGUID) == nil {
+		t.Errorf("Expected the BLOB to load, but got %s", err)
+	}
+	if _, err = Load(filepath.Join(dir, "missing.jwt"), signer.roots()); err == nil {
+		t.Errorf("Expected error for a missing file")
+	}
+}
+
+func TestKeyIdentifier(t *testing.T) {
+	attestation := newTestU2FAttestation(t)
+	certificate, _ := x509.ParseCertificate(attestation.certificate)
+	id, err := KeyIdentifier(certificate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	publicKey := elliptic.Marshal(elliptic.P256(), attestation.key.X, attestation.key.Y)
+	hash := sha1.Sum(publicKey)
+	if expected := hex.EncodeToString(hash[:]); id != expected {
+		t.Errorf("Expected key identifier %s, but got %s", expected, id)
+	}
+}
@@ -0,0 +1,295 @@
+package u2fhost
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	sha256pkg "crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The PIN/UV auth protocols are defined at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#pinProto
+
+// CTAP2 authenticatorClientPIN subcommands
+const (
+	clientPINSubCommandGetKeyAgreement                          uint8 = 0x02
+	clientPINSubCommandGetPinToken                              uint8 = 0x05
+	clientPINSubCommandGetPinUvAuthTokenUsingPinWithPermissions uint8 = 0x09
+)
+
+// CTAP2 authenticatorClientPIN parameter keys
+const (
+	clientPINProtocol     = 0x01
+	clientPINSubCommand   = 0x02
+	clientPINKeyAgreement = 0x03
+	clientPINPinHashEnc   = 0x06
+	clientPINPermissions  = 0x09
+	clientPINRPID         = 0x0A
+)
+
+// CTAP2 authenticatorClientPIN response keys
+const (
+	clientPINResponseKeyAgreement   = 0x01
+	clientPINResponsePinUvAuthToken = 0x02
+)
+
+// A PinUvAuthPermission grants a PIN/UV auth token access to a group of commands.
+type PinUvAuthPermission uint8
+
+// PIN/UV auth token permissions, only enforced by CTAP2.1 authenticators.
+const (
+	PermissionMakeCredential       PinUvAuthPermission = 0x01
+	PermissionGetAssertion         PinUvAuthPermission = 0x02
+	PermissionCredentialManagement PinUvAuthPermission = 0x04
+	PermissionBioEnrollment        PinUvAuthPermission = 0x08
+	PermissionLargeBlobWrite       PinUvAuthPermission = 0x10
+	PermissionAuthenticatorConfig  PinUvAuthPermission = 0x20
+)
+
+// A PinUvAuthToken is obtained from the authenticator after verifying the user,
+// and is used to authenticate commands that require user verification.
+type PinUvAuthToken struct {
+	protocol pinUvAuthProtocol
+	token    []byte
+}
+
+// Returns the pinUvAuthParam for the message.
+func (t *PinUvAuthToken) authenticate(message []byte) []byte {
+	return t.protocol.authenticate(t.token, message)
+}
+
+// Returns a PIN/UV auth token after verifying the PIN with the device.
+// The permissions and RP ID (which may be empty) limit what the token can be used for,
+// devices that only support CTAP2.0 ignore them and return a token with all permissions.
+func (dev *HidDevice) GetPinUvAuthToken(pin string, permissions PinUvAuthPermission, rpID string) (*PinUvAuthToken, error) {
+	info, err := dev.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := dev.sharedSecretWithInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	pinHashEnc, err := secret.encrypt(sha256([]byte(pin))[:16])
+	if err != nil {
+		return nil, err
+	}
+	params := cbor.Map{
+		clientPINProtocol:     secret.protocol.version(),
+		clientPINSubCommand:   clientPINSubCommandGetPinToken,
+		clientPINKeyAgreement: secret.keyAgreement,
+		clientPINPinHashEnc:   pinHashEnc,
+	}
+	if supported, _ := info.Option("pinUvAuthToken"); supported {
+		params[clientPINSubCommand] = clientPINSubCommandGetPinUvAuthTokenUsingPinWithPermissions
+		params[clientPINPermissions] = uint8(permissions)
+		if rpID != "" {
+			params[clientPINRPID] = rpID
+		}
+	}
+	response, err := dev.callCTAP2(ctap2CommandClientPIN, params)
+	if err != nil {
+		return nil, err
+	}
+	tokenEnc, ok := response.Bytes(clientPINResponsePinUvAuthToken)
+	if !ok {
+		return nil, errors.New("Device did not return a PIN token")
+	}
+	token, err := secret.decrypt(tokenEnc)
+	if err != nil {
+		return nil, err
+	}
+	return &PinUvAuthToken{protocol: secret.protocol, token: token}, nil
+}
+
+// A pinUvAuthProtocol implements one version of the PIN/UV auth protocol,
+// which is used to encrypt and authenticate messages with the authenticator.
+type pinUvAuthProtocol interface {
+	version() int
+	kdf(z []byte) []byte
+	encrypt(key, plaintext []byte) ([]byte, error)
+	decrypt(key, ciphertext []byte) ([]byte, error)
+	authenticate(key, message []byte) []byte
+}
+
+// A sharedSecret is the result of a key agreement with the authenticator.
+type sharedSecret struct {
+	protocol pinUvAuthProtocol
+	secret   []byte
+	// The platform key agreement key, sent to the authenticator
+	// so it can derive the same secret.
+	keyAgreement cbor.Map
+}
+
+func (s *sharedSecret) encrypt(plaintext []byte) ([]byte, error) {
+	return s.protocol.encrypt(s.secret, plaintext)
+}
+
+func (s *sharedSecret) decrypt(ciphertext []byte) ([]byte, error) {
+	return s.protocol.decrypt(s.secret, ciphertext)
+}
+
+func (s *sharedSecret) authenticate(message []byte) []byte {
+	return s.protocol.authenticate(s.secret, message)
+}
+
+// Performs a key agreement with the device, using the newest PIN/UV auth
+// protocol supported by both the device and this library.
+func (dev *HidDevice) sharedSecret() (*sharedSecret, error) {
+	info, err := dev.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	return dev.sharedSecretWithInfo(info)
+}
+
+func (dev *HidDevice) sharedSecretWithInfo(info *AuthenticatorInfo) (*sharedSecret, error) {
+	protocol := selectPinUvAuthProtocol(info)
+	response, err := dev.callCTAP2(ctap2CommandClientPIN, cbor.Map{
+		clientPINProtocol:   protocol.version(),
+		clientPINSubCommand: clientPINSubCommandGetKeyAgreement,
+	})
+	if err != nil {
+		return nil, err
+	}
+	keyAgreement, ok := response.Map(clientPINResponseKeyAgreement)
+	if !ok {
+		return nil, errors.New("Device did not return a key agreement key")
+	}
+	peerKey, err := ecdsaFromCOSEKey(keyAgreement)
+	if err != nil {
+		return nil, err
+	}
+	return encapsulate(protocol, peerKey, rand.Reader)
+}
+
+func selectPinUvAuthProtocol(info *AuthenticatorInfo) pinUvAuthProtocol {
+	for _, version := range info.PinUvAuthProtocols {
+		if version == 2 {
+			return pinUvAuthProtocolTwo{}
+		}
+	}
+	return pinUvAuthProtocolOne{}
+}
+
+// Generates an ephemeral key and derives the shared secret with the authenticator key.
+func encapsulate(protocol pinUvAuthProtocol, peerKey *ecdsa.PublicKey, random io.Reader) (*sharedSecret, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), random)
+	if err != nil {
+		return nil, err
+	}
+	x, _ := elliptic.P256().ScalarMult(peerKey.X, peerKey.Y, key.D.Bytes())
+	return &sharedSecret{
+		protocol:     protocol,
+		secret:       protocol.kdf(padBytes(x.Bytes(), 32)),
+		keyAgreement: coseKeyFromECDSA(&key.PublicKey, coseAlgECDHESHKDF256),
+	}, nil
+}
+
+// PIN/UV auth protocol one, supported by all CTAP2 authenticators.
+type pinUvAuthProtocolOne struct{}
+
+func (p pinUvAuthProtocolOne) version() int {
+	return 1
+}
+
+func (p pinUvAuthProtocolOne) kdf(z []byte) []byte {
+	return sha256(z)
+}
+
+func (p pinUvAuthProtocolOne) encrypt(key, plaintext []byte) ([]byte, error) {
+	return aesCBC(key, make([]byte, aes.BlockSize), plaintext, true)
+}
+
+func (p pinUvAuthProtocolOne) decrypt(key, ciphertext []byte) ([]byte, error) {
+	return aesCBC(key, make([]byte, aes.BlockSize), ciphertext, false)
+}
+
+func (p pinUvAuthProtocolOne) authenticate(key, message []byte) []byte {
+	return hmacSha256(key, message)[:16]
+}
+
+// PIN/UV auth protocol two, added in CTAP2.1.
+// The shared secret is a 32 byte HMAC key followed by a 32 byte AES key.
+type pinUvAuthProtocolTwo struct{}
+
+func (p pinUvAuthProtocolTwo) version() int {
+	return 2
+}
+
+func (p pinUvAuthProtocolTwo) kdf(z []byte) []byte {
+	salt := make([]byte, 32)
+	return append(
+		hkdfSha256(salt, z, []byte("CTAP2 HMAC key")),
+		hkdfSha256(salt, z, []byte("CTAP2 AES key"))...,
+	)
+}
+
+func (p pinUvAuthProtocolTwo) encrypt(key, plaintext []byte) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+	_, err := io.ReadFull(rand.Reader, iv)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := aesCBC(p.aesKey(key), iv, plaintext, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, ciphertext...), nil
+}
+
+func (p pinUvAuthProtocolTwo) decrypt(key, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("Ciphertext is shorter than the IV")
+	}
+	return aesCBC(p.aesKey(key), ciphertext[:aes.BlockSize], ciphertext[aes.BlockSize:], false)
+}
+
+func (p pinUvAuthProtocolTwo) authenticate(key, message []byte) []byte {
+	// PIN tokens are used directly as the key, while shared secrets use the HMAC key half.
+	if len(key) == 64 {
+		key = key[:32]
+	}
+	return hmacSha256(key, message)
+}
+
+func (p pinUvAuthProtocolTwo) aesKey(key []byte) []byte {
+	return key[32:]
+}
+
+func aesCBC(key, iv, data []byte, encrypt bool) ([]byte, error) {
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("Data length %d is not a multiple of the AES block size", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(result, data)
+	} else {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(result, data)
+	}
+	return result, nil
+}
+
+func hmacSha256(key, message []byte) []byte {
+	mac := hmac.New(sha256pkg.New, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// HKDF-SHA-256 with a 32 byte output, see https://www.rfc-editor.org/rfc/rfc5869.html
+func hkdfSha256(salt, ikm, info []byte) []byte {
+	prk := hmacSha256(salt, ikm)
+	return hmacSha256(prk, append(append([]byte{}, info...), 0x01))
+}
@@ -0,0 +1,129 @@
+package u2fhost
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPinUvAuthProtocols(t *testing.T) {
+	for _, protocol := range []pinUvAuthProtocol{pinUvAuthProtocolOne{}, pinUvAuthProtocolTwo{}} {
+		key := protocol.kdf(bytes.Repeat([]byte{1}, 32))
+		plaintext := bytes.Repeat([]byte{2}, 32)
+		ciphertext, err := protocol.encrypt(key, plaintext)
+		if err != nil {
+			t.Fatalf("Unexpected error encrypting with protocol %d: %s", protocol.version(), err)
+		}
+		decrypted, err := protocol.decrypt(key, ciphertext)
+		if err != nil {
+			t.Fatalf("Unexpected error decrypting with protocol %d: %s", protocol.version(), err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Expected %x but got %x with protocol %d", plaintext, decrypted, protocol.version())
+		}
+		_, err = protocol.encrypt(key, []byte{1, 2, 3})
+		if err == nil {
+			t.Errorf("Expected error encrypting a partial block with protocol %d", protocol.version())
+		}
+	}
+
+	// Protocol one uses a zero IV and a truncated HMAC
+	one := pinUvAuthProtocolOne{}
+	if len(one.kdf([]byte{1})) != 32 || len(one.authenticate(make([]byte, 32), []byte{1})) != 16 {
+		t.Errorf("Unexpected key or signature length for protocol one")
+	}
+
+	// Protocol two derives separate HMAC and AES keys with HKDF
+	two := pinUvAuthProtocolTwo{}
+	key := two.kdf(make([]byte, 32))
+	if len(key) != 64 || bytes.Equal(key[:32], key[32:]) {
+		t.Errorf("Expected two different 32 byte keys, but got %x", key)
+	}
+	if len(two.authenticate(key, []byte{1})) != 32 {
+		t.Errorf("Expected a 32 byte signature for protocol two")
+	}
+}
+
+func TestHkdfSha256(t *testing.T) {
+	// RFC 5869 test case 1, truncated to 32 bytes
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	result := hex.EncodeToString(hkdfSha256(salt, ikm, info))
+	if result != expected {
+		t.Errorf("Expected %s but got %s", expected, result)
+	}
+}
+
+func TestSharedSecret(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+
+	// Protocol two is preferred when supported
+	secret, err := dev.sharedSecret()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if secret.protocol.version() != 2 {
+		t.Errorf("Expected protocol 2, but got %d", secret.protocol.version())
+	}
+	request := authenticator.requests[ctap2CommandClientPIN]
+	if version, _ := request.Int(clientPINProtocol); version != 2 {
+		t.Errorf("Expected key agreement request for protocol 2, but got %d", version)
+	}
+	_, expected := authenticator.sharedSecret(2, secret.keyAgreement)
+	if !bytes.Equal(expected, secret.secret) {
+		t.Errorf("Expected shared secret %x, but got %x", expected, secret.secret)
+	}
+
+	// Fall back to protocol one
+	authenticator.info[getInfoPinUvAuthProtocols] = []int{1}
+	secret, err = dev.sharedSecret()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if secret.protocol.version() != 1 {
+		t.Errorf("Expected protocol 1, but got %d", secret.protocol.version())
+	}
+}
+
+func TestGetPinUvAuthToken(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	authenticator.pin = "1234"
+
+	// CTAP2.0 devices use getPinToken without permissions
+	token, err := dev.GetPinUvAuthToken("1234", PermissionGetAssertion, "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !bytes.Equal(token.token, authenticator.pinToken) {
+		t.Errorf("Expected token %x, but got %x", authenticator.pinToken, token.token)
+	}
+	request := authenticator.requests[ctap2CommandClientPIN]
+	if subCommand, _ := request.Int(clientPINSubCommand); uint8(subCommand) != clientPINSubCommandGetPinToken {
+		t.Errorf("Expected getPinToken subcommand, but got %#x", subCommand)
+	}
+	if _, ok := request.Get(clientPINPermissions); ok {
+		t.Errorf("Did not expect permissions for getPinToken")
+	}
+
+	// CTAP2.1 devices use getPinUvAuthTokenUsingPinWithPermissions
+	authenticator.info[getInfoOptions] = map[string]bool{"clientPin": true, "pinUvAuthToken": true}
+	_, err = dev.GetPinUvAuthToken("1234", PermissionGetAssertion, "example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	request = authenticator.requests[ctap2CommandClientPIN]
+	if subCommand, _ := request.Int(clientPINSubCommand); uint8(subCommand) != clientPINSubCommandGetPinUvAuthTokenUsingPinWithPermissions {
+		t.Errorf("Expected getPinUvAuthTokenUsingPinWithPermissions subcommand, but got %#x", subCommand)
+	}
+	if rpID, _ := request.String(clientPINRPID); rpID != "example.com" {
+		t.Errorf("Expected rp id example.com, but got %s", rpID)
+	}
+
+	// Wrong PIN
+	_, err = dev.GetPinUvAuthToken("4321", PermissionGetAssertion, "")
+	if err == nil {
+		t.Errorf("Expected error for the wrong PIN")
+	}
+}
@@ -9,6 +9,10 @@ import (
 
 // Registers with the device using the RegisterRequest, returning a RegisterResponse.
 func (dev *HidDevice) Register(req *RegisterRequest) (*RegisterResponse, error) {
+	err := validateAppId(req.AppIdValidator, req.AppId, req.Facet)
+	if err != nil {
+		return nil, err
+	}
 	clientData, request, err := registerRequest(req)
 	if err != nil {
 		return nil, err
@@ -28,7 +32,7 @@ func registerRequest(req *RegisterRequest) ([]byte, []byte, error) {
 
 	// Construct the client json
 	client := clientData{
-		Typ:                "navigator.id.finishEnrollment",
+		Typ:                ClientDataTypeRegister,
 		Challenge:          req.Challenge,
 		Origin:             req.Facet,
 		ChannelIdPublicKey: cid,
@@ -0,0 +1,12 @@
+package u2fhost
+
+// Resets the authenticator back to factory settings, deleting all credentials
+// and removing the PIN.
+// Most authenticators only allow a reset within a few seconds of being powered up,
+// and require the user to touch the device to confirm it.
+// A NotAllowedError is returned if the device was powered up too long ago,
+// and a UserActionTimeoutError if the user did not touch the device in time.
+func (dev *HidDevice) Reset() error {
+	_, err := dev.sendCTAP2(ctap2CommandReset, nil)
+	return err
+}
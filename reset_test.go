@@ -0,0 +1,54 @@
+package u2fhost
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	testHid, dev := newTestDevice()
+
+	// Happy path, with keep alive messages while waiting for the user
+	testHid.keepAlives = []uint8{0x01, 0x02, 0x02}
+	statuses := []KeepAliveStatus{}
+	dev.OnKeepAlive(func(status KeepAliveStatus) {
+		statuses = append(statuses, status)
+	})
+	err := dev.Reset()
+	if err != nil {
+		t.Errorf("Unexpected error calling Reset: %s", err)
+	}
+	if testHid.command != ctap2CommandReset {
+		t.Errorf("Expected command %#x, but got %#x", ctap2CommandReset, testHid.command)
+	}
+	if len(testHid.cborRequest) != 0 {
+		t.Errorf("Expected empty request, but got % x", testHid.cborRequest)
+	}
+	expectedStatuses := []KeepAliveStatus{KeepAliveProcessing, KeepAliveUserPresenceNeeded, KeepAliveUserPresenceNeeded}
+	if !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("Expected keep alive statuses %v, but got %v", expectedStatuses, statuses)
+	}
+
+	// Not allowed, the device was powered up too long ago
+	testHid.cborStatus = ctap2StatusNotAllowed
+	err = dev.Reset()
+	if _, ok := err.(*NotAllowedError); !ok {
+		t.Errorf("Expected NotAllowedError, but got %#v", err)
+	}
+
+	// The user did not touch the device
+	testHid.cborStatus = ctap2StatusUserActionTimeout
+	err = dev.Reset()
+	if _, ok := err.(*UserActionTimeoutError); !ok {
+		t.Errorf("Expected UserActionTimeoutError, but got %#v", err)
+	}
+
+	// Error from SendCBOR
+	testHid.cborStatus = ctap2StatusOK
+	testHid.error = errors.New("CBOR Error")
+	err = dev.Reset()
+	if err != testHid.error {
+		t.Errorf("Expected error `%s` got `%s`", testHid.error, err)
+	}
+}
@@ -0,0 +1,64 @@
+package u2fhost
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// The RP ID rules are defined at the following urls.
+// https://www.w3.org/TR/webauthn-3/#rp-id
+// https://html.spec.whatwg.org/multipage/browsers.html#is-a-registrable-domain-suffix-of-or-is-equal-to
+
+// A PublicSuffixList returns the public suffix of a domain, such as "co.uk" for "example.co.uk".
+// It has the same method as the publicsuffix.List from golang.org/x/net/publicsuffix.
+type PublicSuffixList interface {
+	PublicSuffix(domain string) string
+}
+
+// Returns an InvalidRPIDError unless the RP ID is the origin's host or a registrable
+// domain suffix of it. The origin must be https, or http for localhost, and its port is ignored.
+// If the list is nil the public suffix list embedded from golang.org/x/net/publicsuffix is used.
+func ValidateRPID(rpId, origin string, list PublicSuffixList) error {
+	if list == nil {
+		list = publicsuffix.List
+	}
+	invalid := func(reason string) error {
+		return &InvalidRPIDError{RPID: rpId, Origin: origin, Reason: reason}
+	}
+	originUrl, err := url.Parse(origin)
+	if err != nil || originUrl.Host == "" || originUrl.Opaque != "" {
+		return invalid("the origin is not a URL")
+	}
+	host := strings.ToLower(originUrl.Hostname())
+	if net.ParseIP(host) != nil {
+		return invalid("the origin host is an IP address")
+	}
+	switch {
+	case originUrl.Scheme == "https":
+	case originUrl.Scheme == "http" && isLocalhost(host):
+	default:
+		return invalid("the origin must be https, or http for localhost")
+	}
+	if rpId == "" || strings.ContainsAny(rpId, ":/") {
+		return invalid("the RP ID must be a domain without a scheme or port")
+	}
+	rpId = strings.ToLower(rpId)
+	if rpId == host {
+		return nil
+	}
+	if !strings.HasSuffix(host, "."+rpId) {
+		return invalid("the RP ID is not a suffix of the origin host")
+	}
+	suffix := list.PublicSuffix(host)
+	if rpId == list.PublicSuffix(rpId) || strings.HasSuffix(suffix, "."+rpId) {
+		return invalid("the RP ID is a public suffix")
+	}
+	return nil
+}
+
+func isLocalhost(host string) bool {
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
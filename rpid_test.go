@@ -0,0 +1,85 @@
+package u2fhost
+
+import (
+	"strings"
+	"testing"
+)
+
+// A public suffix list with one private suffix and the default rule for other domains.
+type testSuffixList struct{}
+
+func (l testSuffixList) PublicSuffix(domain string) string {
+	if domain == "hosting.example" || strings.HasSuffix(domain, ".hosting.example") {
+		return "hosting.example"
+	}
+	return domain[strings.LastIndex(domain, ".")+1:]
+}
+
+func TestValidateRPID(t *testing.T) {
+	valid := []struct{ rpId, origin string }{
+		{"example.com", "https://example.com"},
+		{"example.com", "https://login.example.com:8443"},
+		{"Example.com", "https://a.b.EXAMPLE.com/"},
+		{"example.co.uk", "https://login.example.co.uk"},
+		{"user.github.io", "https://user.github.io"},
+		{"localhost", "http://localhost:8080"},
+		{"localhost", "https://localhost"},
+		{"app.localhost", "http://app.localhost"},
+	}
+	for _, test := range valid {
+		if err := ValidateRPID(test.rpId, test.origin, nil); err != nil {
+			t.Errorf("Expected %s to be valid for %s, but got %s", test.rpId, test.origin, err)
+		}
+	}
+
+	invalid := []struct{ rpId, origin string }{
+		{"", "https://example.com"},
+		{"example.com", "http://example.com"},
+		{"example.com", "https://example.org"},
+		{"example.com", "https://badexample.com"},
+		{"login.example.com", "https://example.com"},
+		{"example.com:443", "https://example.com"},
+		{"https://example.com", "https://example.com"},
+		{"com", "https://example.com"},
+		{"co.uk", "https://example.co.uk"},
+		{"github.io", "https://user.github.io"},
+		{"127.0.0.1", "https://127.0.0.1"},
+		{"::1", "https://[::1]:8080"},
+		{"0.1", "https://127.0.0.1"},
+		{"localhost", "http://localhost.example.com"},
+		{"example.com", "example.com"},
+	}
+	for _, test := range invalid {
+		err := ValidateRPID(test.rpId, test.origin, nil)
+		if _, ok := err.(*InvalidRPIDError); !ok {
+			t.Errorf("Expected InvalidRPIDError for %s with %s, but got %#v", test.rpId, test.origin, err)
+		}
+	}
+
+	// A pluggable list
+	if err := ValidateRPID("hosting.example", "https://site.hosting.example", nil); err != nil {
+		t.Errorf("Expected hosting.example to be valid with the default list, but got %s", err)
+	}
+	err := ValidateRPID("hosting.example", "https://site.hosting.example", testSuffixList{})
+	if _, ok := err.(*InvalidRPIDError); !ok {
+		t.Errorf("Expected InvalidRPIDError for a public suffix from the list, but got %#v", err)
+	}
+	if err = ValidateRPID("site.hosting.example", "https://login.site.hosting.example", testSuffixList{}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestAuthenticateInvalidRPID(t *testing.T) {
+	testHid, dev := newTestDevice()
+	req := sampleAuthenticateRequest()
+	req.WebAuthn = true
+	req.AppId = "example.com"
+	req.Facet = "https://example.org"
+	_, err := dev.Authenticate(req)
+	if _, ok := err.(*InvalidRPIDError); !ok {
+		t.Errorf("Expected InvalidRPIDError, but got %#v", err)
+	}
+	if testHid.request != nil {
+		t.Errorf("Expected the RP ID hash not to be sent to the device")
+	}
+}
@@ -0,0 +1,135 @@
+package u2fhost
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	butil "github.com/marshallbrekka/go-u2fhost/bytes"
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The RP ID of the throwaway credential requested from CTAP2.0 devices during selection,
+// as described at the following url.
+// https://fidoalliance.org/specs/fido-v2.1-ps-20210615/fido-client-to-authenticator-protocol-v2.1-ps-20210615.html#authenticatorSelection
+const selectionDummyRPID = ".dummy"
+
+// How often U2F only devices are asked for a touch during selection.
+const selectionPollInterval = 250 * time.Millisecond
+
+// Waits for the user to touch one of the open devices and returns it.
+// Every device is asked for a touch at once, and once one of them is touched
+// the requests to the other devices are cancelled so they stop flashing.
+// Returns the context error if the context ends before a device is touched.
+func SelectDevice(ctx context.Context, devices []*HidDevice) (*HidDevice, error) {
+	if len(devices) == 0 {
+		return nil, errors.New("No devices to select from")
+	}
+	selectionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		dev *HidDevice
+		err error
+	}
+	results := make(chan result, len(devices))
+	for _, dev := range devices {
+		go func(dev *HidDevice) {
+			results <- result{dev, dev.waitForTouch(selectionCtx)}
+		}(dev)
+	}
+	// Wait for every device to finish so none of them are still in use when we return
+	var selected *HidDevice
+	var err error
+	for range devices {
+		r := <-results
+		if selected != nil {
+			continue
+		}
+		if r.err == nil {
+			selected = r.dev
+			cancel()
+		} else {
+			err = r.err
+		}
+	}
+	if selected != nil {
+		return selected, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, err
+}
+
+// Blocks until the device is touched, cancelling the request when the context ends.
+func (dev *HidDevice) waitForTouch(ctx context.Context) error {
+	if !dev.SupportsCTAP2() {
+		return dev.pollForTouch(ctx)
+	}
+	info, err := dev.GetInfo()
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// Only cancel while the touch request below is outstanding
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			dev.Cancel()
+		case <-stop:
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	if info.HasVersion("FIDO_2_1") || info.HasVersion("FIDO_2_1_PRE") {
+		_, err = dev.sendCTAP2(ctap2CommandSelection, nil)
+		return err
+	}
+	// CTAP2.0 devices wait for a touch before rejecting the empty pinUvAuthParam
+	_, err = dev.callCTAP2(ctap2CommandMakeCredential, cbor.Map{
+		makeCredentialClientDataHash:    make([]byte, 32),
+		makeCredentialRP:                cbor.Map{"id": selectionDummyRPID},
+		makeCredentialUser:              cbor.Map{"id": []byte{1}, "name": "dummy"},
+		makeCredentialPubKeyCredParams:  []interface{}{cbor.Map{"alg": coseAlgES256, "type": credentialTypePublicKey}},
+		makeCredentialPinUvAuthParam:    []byte{},
+		makeCredentialPinUvAuthProtocol: 1,
+	})
+	switch err.(type) {
+	case *PinNotSetError, *PinInvalidError, *PinAuthInvalidError:
+		return nil
+	}
+	return err
+}
+
+// Repeatedly sends a throwaway U2F registration until the device is touched
+// or the context ends.
+func (dev *HidDevice) pollForTouch(ctx context.Context) error {
+	request := butil.Concat(make([]byte, 32), sha256([]byte(selectionDummyRPID)))
+	interval := time.NewTicker(selectionPollInterval)
+	defer interval.Stop()
+	for {
+		status, _, err := dev.hidDevice.SendAPDU(u2fCommandRegister, 0x03, 0, request)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case u2fStatusNoError:
+			return nil
+		case u2fStatusConditionsNotSatisfied:
+		default:
+			return u2ferror(status)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-interval.C:
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package u2fhost
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+	"github.com/marshallbrekka/go-u2fhost/hid"
+)
+
+// Returns a CTAP2 device that waits for a touch until it is cancelled,
+// or is touched straight away if touched is true.
+func newSelectionDevice(t *testing.T, versions []string, touched bool) (*testAuthenticator, *testDevice, *HidDevice) {
+	authenticator, testHid, dev := newTestAuthenticator(t)
+	authenticator.info[getInfoVersions] = versions
+	testHid.capabilities = hid.CAPABILITY_CBOR
+	testHid.cancelled = make(chan struct{})
+	handler := func(params cbor.Map) (cbor.Map, uint8) {
+		if touched {
+			return cbor.Map{}, ctap2StatusOK
+		}
+		<-testHid.cancelled
+		return nil, ctap2StatusKeepAliveCancel
+	}
+	authenticator.commands[ctap2CommandSelection] = handler
+	authenticator.commands[ctap2CommandMakeCredential] = func(params cbor.Map) (cbor.Map, uint8) {
+		_, status := handler(params)
+		if status == ctap2StatusOK {
+			return nil, ctap2StatusPinNotSet
+		}
+		return nil, status
+	}
+	return authenticator, testHid, dev
+}
+
+// Returns a U2F only device, which rejects CTAP2 commands.
+func newU2FSelectionDevice(touched bool) (*testDevice, *HidDevice) {
+	testHid, dev := newTestDevice()
+	testHid.cborHandler = func(command uint8, request []byte) (uint8, []byte) {
+		return 0x01, nil
+	}
+	testHid.status = u2fStatusConditionsNotSatisfied
+	if touched {
+		testHid.status = u2fStatusNoError
+	}
+	return testHid, dev
+}
+
+func TestSelectDevice(t *testing.T) {
+	waitingAuthenticator, waitingHid, waiting := newSelectionDevice(t, []string{"FIDO_2_0", "FIDO_2_1"}, false)
+	touchedAuthenticator, touchedHid, touched := newSelectionDevice(t, []string{"FIDO_2_0", "FIDO_2_1"}, true)
+	// The touched device is only touched once the waiting device's request is
+	// outstanding, so the waiting device always has a request to cancel
+	outstanding := make(chan struct{})
+	wait := waitingAuthenticator.commands[ctap2CommandSelection]
+	waitingAuthenticator.commands[ctap2CommandSelection] = func(params cbor.Map) (cbor.Map, uint8) {
+		close(outstanding)
+		return wait(params)
+	}
+	touch := touchedAuthenticator.commands[ctap2CommandSelection]
+	touchedAuthenticator.commands[ctap2CommandSelection] = func(params cbor.Map) (cbor.Map, uint8) {
+		<-outstanding
+		return touch(params)
+	}
+	u2fHid, u2f := newU2FSelectionDevice(false)
+	selected, err := SelectDevice(context.Background(), []*HidDevice{waiting, touched, u2f})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if selected != touched {
+		t.Errorf("Expected the touched device to be selected")
+	}
+	if touchedHid.command != ctap2CommandSelection {
+		t.Errorf("Expected command %#x, but got %#x", ctap2CommandSelection, touchedHid.command)
+	}
+	if waitingHid.cancels != 1 {
+		t.Errorf("Expected the waiting device to be cancelled once, but got %d", waitingHid.cancels)
+	}
+	if touchedHid.cancels != 0 || u2fHid.cancels != 0 {
+		t.Errorf("Expected only the waiting CTAP2 device to be cancelled")
+	}
+	if u2fHid.instruction != u2fCommandRegister {
+		t.Errorf("Expected the U2F device to be sent a register request, but got %#x", u2fHid.instruction)
+	}
+}
+
+func TestSelectDeviceCTAP20(t *testing.T) {
+	authenticator, _, touched := newSelectionDevice(t, []string{"FIDO_2_0"}, true)
+	selected, err := SelectDevice(context.Background(), []*HidDevice{touched})
+	if err != nil || selected != touched {
+		t.Fatalf("Expected the touched device to be selected, but got %s", err)
+	}
+	request := authenticator.requests[ctap2CommandMakeCredential]
+	if param, ok := request.Bytes(makeCredentialPinUvAuthParam); !ok || len(param) != 0 {
+		t.Errorf("Expected an empty pinUvAuthParam, but got %v", param)
+	}
+	if rp, _ := request.Map(makeCredentialRP); rp == nil {
+		t.Errorf("Expected an RP in the request")
+	} else if id, _ := rp.String("id"); id != selectionDummyRPID {
+		t.Errorf("Expected RP ID %s, but got %s", selectionDummyRPID, id)
+	}
+}
+
+func TestSelectDeviceU2F(t *testing.T) {
+	_, waiting := newU2FSelectionDevice(false)
+	_, touched := newU2FSelectionDevice(true)
+	selected, err := SelectDevice(context.Background(), []*HidDevice{waiting, touched})
+	if err != nil || selected != touched {
+		t.Fatalf("Expected the touched device to be selected, but got %s", err)
+	}
+}
+
+func TestSelectDeviceTimeout(t *testing.T) {
+	_, testHid1, dev1 := newSelectionDevice(t, []string{"FIDO_2_1"}, false)
+	_, testHid2, dev2 := newSelectionDevice(t, []string{"FIDO_2_0"}, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := SelectDevice(ctx, []*HidDevice{dev1, dev2})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, but got %#v", err)
+	}
+	if testHid1.cancels != 1 || testHid2.cancels != 1 {
+		t.Errorf("Expected both devices to be cancelled, but got %d and %d", testHid1.cancels, testHid2.cancels)
+	}
+
+	// A context that has already ended is not cancelled on the device,
+	// since no request is outstanding
+	_, testHid3, dev3 := newSelectionDevice(t, []string{"FIDO_2_1"}, false)
+	ended, cancelEnded := context.WithCancel(context.Background())
+	cancelEnded()
+	_, err = SelectDevice(ended, []*HidDevice{dev3})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, but got %#v", err)
+	}
+	if testHid3.cancels != 0 {
+		t.Errorf("Expected no cancel to be sent, but got %d", testHid3.cancels)
+	}
+
+	_, err = SelectDevice(context.Background(), nil)
+	if err == nil {
+		t.Errorf("Expected error when selecting from no devices")
+	}
+}
+
+func TestSelectDeviceError(t *testing.T) {
+	testHid, dev := newU2FSelectionDevice(false)
+	testHid.status = u2fStatusWrongData
+	_, err := SelectDevice(context.Background(), []*HidDevice{dev})
+	if err == nil {
+		t.Errorf("Expected error from device")
+	}
+}
@@ -0,0 +1,308 @@
+package u2fhost
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+	"golang.org/x/crypto/ssh"
+)
+
+// The application OpenSSH creates security keys for.
+const SSHApplication = "ssh:"
+
+// Flags stored with OpenSSH security keys.
+const (
+	SSHFlagUserPresenceRequired     uint8 = 0x01
+	SSHFlagUserVerificationRequired uint8 = 0x04
+)
+
+// The OpenSSH private key format, see PROTOCOL.key and PROTOCOL.u2f in the OpenSSH source.
+const (
+	sshPrivateKeyMagic     = "openssh-key-v1\x00"
+	sshPrivateKeyPEMType   = "OPENSSH PRIVATE KEY"
+	sshPrivateKeyBlockSize = 8
+	sshCurveP256           = "nistp256"
+)
+
+// An SSHKey is an OpenSSH sk-ecdsa-sha2-nistp256@openssh.com security key.
+// The private key never leaves the device, the key file only holds the key
+// handle of a credential created for the application.
+type SSHKey struct {
+	// The application the credential was created for, which starts with "ssh:".
+	Application string
+	PublicKey   *ecdsa.PublicKey
+	KeyHandle   []byte
+	Flags       uint8
+	Comment     string
+}
+
+// The public key of an sk-ecdsa key in the SSH wire format.
+type sshPublicKey struct {
+	Type        string
+	Curve       string
+	Point       []byte
+	Application string
+}
+
+// The private key file, following the magic.
+type sshPrivateKeyFile struct {
+	CipherName  string
+	KdfName     string
+	KdfOptions  string
+	NumKeys     uint32
+	PublicKey   []byte
+	PrivateKeys []byte
+}
+
+// The unencrypted private key section of the file.
+type sshPrivateKey struct {
+	Check1      uint32
+	Check2      uint32
+	Type        string
+	Curve       string
+	Point       []byte
+	Application string
+	Flags       uint8
+	KeyHandle   []byte
+	Reserved    []byte
+	Comment     string
+	Padding     []byte `ssh:"rest"`
+}
+
+// An ECDSA signature as returned by the device.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// Creates a new credential for the application, which defaults to SSHApplication,
+// returning it as an SSHKey that requires the user to touch the device to sign.
+func GenerateSSHKey(authenticator Authenticator, application, comment string) (*SSHKey, error) {
+	if application == "" {
+		application = SSHApplication
+	}
+	if !strings.HasPrefix(application, SSHApplication) {
+		return nil, fmt.Errorf("The application must start with %s", SSHApplication)
+	}
+	challenge := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, challenge)
+	if err != nil {
+		return nil, err
+	}
+	response, err := authenticator.MakeCredential(&MakeCredentialRequest{
+		ClientDataHash: sha256(challenge),
+		RelyingParty:   RelyingPartyEntity{ID: application},
+		// OpenSSH uses an all zero user ID for keys that are not resident.
+		User: UserEntity{ID: make([]byte, 32), Name: "openssh"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	coseKey, err := cbor.UnmarshalMap(response.AuthenticatorData.CredentialPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid credential public key: %s", err)
+	}
+	publicKey, err := ecdsaFromCOSEKey(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHKey{
+		Application: application,
+		PublicKey:   publicKey,
+		KeyHandle:   response.AuthenticatorData.CredentialID,
+		Flags:       SSHFlagUserPresenceRequired,
+		Comment:     comment,
+	}, nil
+}
+
+// Parses an unencrypted OpenSSH private key file holding an sk-ecdsa key.
+func ParseSSHKey(data []byte) (*SSHKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != sshPrivateKeyPEMType {
+		return nil, errors.New("Not an OpenSSH private key file")
+	}
+	if !strings.HasPrefix(string(block.Bytes), sshPrivateKeyMagic) {
+		return nil, errors.New("Invalid OpenSSH private key magic")
+	}
+	var file sshPrivateKeyFile
+	err := ssh.Unmarshal(block.Bytes[len(sshPrivateKeyMagic):], &file)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid OpenSSH private key: %s", err)
+	}
+	if file.CipherName != "none" || file.KdfName != "none" {
+		return nil, errors.New("Encrypted SSH keys are not supported")
+	}
+	if file.NumKeys != 1 {
+		return nil, fmt.Errorf("Expected 1 key in the file, but found %d", file.NumKeys)
+	}
+	var private sshPrivateKey
+	err = ssh.Unmarshal(file.PrivateKeys, &private)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid OpenSSH private key: %s", err)
+	}
+	if private.Check1 != private.Check2 {
+		return nil, errors.New("Invalid OpenSSH private key check bytes")
+	}
+	if private.Type != ssh.KeyAlgoSKECDSA256 {
+		return nil, fmt.Errorf("Unsupported SSH key type %s, expected %s", private.Type, ssh.KeyAlgoSKECDSA256)
+	}
+	if private.Curve != sshCurveP256 {
+		return nil, fmt.Errorf("Unsupported SSH key curve %s", private.Curve)
+	}
+	for i, b := range private.Padding {
+		if int(b) != i+1 {
+			return nil, errors.New("Invalid OpenSSH private key padding")
+		}
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), private.Point)
+	if x == nil {
+		return nil, errors.New("Invalid SSH public key point")
+	}
+	return &SSHKey{
+		Application: private.Application,
+		PublicKey:   &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+		KeyHandle:   private.KeyHandle,
+		Flags:       private.Flags,
+		Comment:     private.Comment,
+	}, nil
+}
+
+// Returns the key as an unencrypted OpenSSH private key file.
+func (k *SSHKey) MarshalPrivateKey() ([]byte, error) {
+	check := make([]byte, 4)
+	_, err := io.ReadFull(rand.Reader, check)
+	if err != nil {
+		return nil, err
+	}
+	private := sshPrivateKey{
+		Check1:      binary.BigEndian.Uint32(check),
+		Check2:      binary.BigEndian.Uint32(check),
+		Type:        ssh.KeyAlgoSKECDSA256,
+		Curve:       sshCurveP256,
+		Point:       k.point(),
+		Application: k.Application,
+		Flags:       k.Flags,
+		KeyHandle:   k.KeyHandle,
+		Reserved:    []byte{},
+		Comment:     k.Comment,
+	}
+	for i := 1; (len(ssh.Marshal(private)))%sshPrivateKeyBlockSize != 0; i++ {
+		private.Padding = append(private.Padding, byte(i))
+	}
+	file := ssh.Marshal(sshPrivateKeyFile{
+		CipherName:  "none",
+		KdfName:     "none",
+		NumKeys:     1,
+		PublicKey:   k.marshalPublicKey(),
+		PrivateKeys: ssh.Marshal(private),
+	})
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  sshPrivateKeyPEMType,
+		Bytes: append([]byte(sshPrivateKeyMagic), file...),
+	}), nil
+}
+
+// Returns the public key, which verifies signatures made by Sign.
+func (k *SSHKey) SSHPublicKey() (ssh.PublicKey, error) {
+	return ssh.ParsePublicKey(k.marshalPublicKey())
+}
+
+// Returns the public key in the authorized_keys format, followed by the comment.
+func (k *SSHKey) AuthorizedKey() ([]byte, error) {
+	publicKey, err := k.SSHPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	line := ssh.MarshalAuthorizedKey(publicKey)
+	if k.Comment != "" {
+		line = append(line[:len(line)-1], []byte(" "+k.Comment+"\n")...)
+	}
+	return line, nil
+}
+
+// Signs the data with the key handle on the authenticator, which waits for the
+// user to touch the device.
+// The signature is in the OpenSSH security key format, with the flags and
+// counter from the device following the ECDSA signature.
+func (k *SSHKey) Sign(authenticator Authenticator, data []byte) (*ssh.Signature, error) {
+	publicKey, err := k.SSHPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	response, err := authenticator.GetAssertion(&GetAssertionRequest{
+		RPID:             k.Application,
+		ClientDataHash:   sha256(data),
+		AllowList:        [][]byte{k.KeyHandle},
+		UserVerification: k.Flags&SSHFlagUserVerificationRequired != 0,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.AuthData) != authDataMinLength {
+		return nil, errors.New("The device returned extensions, which SSH signatures can not include")
+	}
+	var signature ecdsaSignature
+	_, err = asn1.Unmarshal(response.Signature, &signature)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature from the device: %s", err)
+	}
+	sshSignature := &ssh.Signature{
+		Format: ssh.KeyAlgoSKECDSA256,
+		Blob:   ssh.Marshal(signature),
+		Rest: ssh.Marshal(struct {
+			Flags   uint8
+			Counter uint32
+		}{response.AuthenticatorData.Flags, response.AuthenticatorData.SignCount}),
+	}
+	err = publicKey.Verify(data, sshSignature)
+	if err != nil {
+		return nil, &InvalidSignatureError{Reason: "the device signed with a different key"}
+	}
+	return sshSignature, nil
+}
+
+// Returns an ssh.Signer for the key on the authenticator, for use with the
+// golang.org/x/crypto/ssh client and agent packages.
+func (k *SSHKey) Signer(authenticator Authenticator) (ssh.Signer, error) {
+	publicKey, err := k.SSHPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &sshSigner{key: k, publicKey: publicKey, authenticator: authenticator}, nil
+}
+
+func (k *SSHKey) point() []byte {
+	return elliptic.Marshal(elliptic.P256(), k.PublicKey.X, k.PublicKey.Y)
+}
+
+func (k *SSHKey) marshalPublicKey() []byte {
+	return ssh.Marshal(sshPublicKey{
+		Type:        ssh.KeyAlgoSKECDSA256,
+		Curve:       sshCurveP256,
+		Point:       k.point(),
+		Application: k.Application,
+	})
+}
+
+type sshSigner struct {
+	key           *SSHKey
+	publicKey     ssh.PublicKey
+	authenticator Authenticator
+}
+
+func (s *sshSigner) PublicKey() ssh.PublicKey {
+	return s.publicKey
+}
+
+func (s *sshSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.key.Sign(s.authenticator, data)
+}
@@ -0,0 +1,141 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateSSHKey(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	key, err := GenerateSSHKey(authenticator, "", "user@host")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if key.Application != SSHApplication || key.Flags != SSHFlagUserPresenceRequired {
+		t.Errorf("Expected application %s with user presence required, but got %#v", SSHApplication, key)
+	}
+	if !bytes.Equal(token.keyHandles["key handle"], sha256([]byte(SSHApplication))) {
+		t.Errorf("Expected the key handle to be registered for %s", SSHApplication)
+	}
+	if key.PublicKey.X.Cmp(token.key.X) != 0 || key.PublicKey.Y.Cmp(token.key.Y) != 0 {
+		t.Errorf("Expected the public key of the device")
+	}
+
+	_, err = GenerateSSHKey(authenticator, "https://example.com", "")
+	if err == nil {
+		t.Errorf("Expected error for an application not starting with ssh:")
+	}
+}
+
+func TestSSHKeyFile(t *testing.T) {
+	key := sampleSSHKey(t)
+	data, err := key.MarshalPrivateKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" {
+		t.Fatalf("Expected an OPENSSH PRIVATE KEY PEM block, but got %s", data)
+	}
+	parsed, err := ParseSSHKey(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if parsed.Application != key.Application || parsed.Flags != key.Flags || parsed.Comment != key.Comment ||
+		!bytes.Equal(parsed.KeyHandle, key.KeyHandle) || parsed.PublicKey.X.Cmp(key.PublicKey.X) != 0 {
+		t.Errorf("Expected %#v, but got %#v", key, parsed)
+	}
+
+	authorizedKey, err := key.AuthorizedKey()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey(authorizedKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if publicKey.Type() != ssh.KeyAlgoSKECDSA256 || comment != "user@host" {
+		t.Errorf("Expected an %s key with a comment, but got %s", ssh.KeyAlgoSKECDSA256, authorizedKey)
+	}
+
+	for _, invalid := range [][]byte{
+		[]byte("not a key"),
+		pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte("openssh-key-v1\x00")}),
+		bytes.Replace(data, []byte("\n"), []byte("\nX"), 1),
+	} {
+		if _, err := ParseSSHKey(invalid); err == nil {
+			t.Errorf("Expected error parsing %q", invalid)
+		}
+	}
+	encrypted := ssh.Marshal(sshPrivateKeyFile{CipherName: "aes256-ctr", KdfName: "bcrypt", NumKeys: 1})
+	_, err = ParseSSHKey(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: append([]byte(sshPrivateKeyMagic), encrypted...)}))
+	if err == nil || !strings.Contains(err.Error(), "Encrypted") {
+		t.Errorf("Expected error for an encrypted key, but got %v", err)
+	}
+}
+
+func TestSSHKeySign(t *testing.T) {
+	token, _, authenticator := newTestU2FAuthenticator(t)
+	key, err := GenerateSSHKey(authenticator, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	signer, err := key.Signer(authenticator)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	data := []byte("session data")
+	signature, err := signer.Sign(rand.Reader, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if signature.Format != ssh.KeyAlgoSKECDSA256 {
+		t.Errorf("Expected format %s, but got %s", ssh.KeyAlgoSKECDSA256, signature.Format)
+	}
+	if !bytes.Equal(signature.Rest, []byte{0x01, 0, 0, 0, 0x2a}) {
+		t.Errorf("Expected the flags and counter 42, but got %x", signature.Rest)
+	}
+	err = signer.PublicKey().Verify(data, signature)
+	if err != nil {
+		t.Errorf("Expected the signature to verify, but got %s", err)
+	}
+	if signer.PublicKey().Verify([]byte("other data"), signature) == nil {
+		t.Errorf("Expected the signature not to verify other data")
+	}
+
+	// A key file with a different public key for the key handle
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key.PublicKey = &other.PublicKey
+	_, err = key.Sign(authenticator, data)
+	if _, ok := err.(*InvalidSignatureError); !ok {
+		t.Errorf("Expected InvalidSignatureError, but got %#v", err)
+	}
+
+	// A key handle the device did not create
+	delete(token.keyHandles, "key handle")
+	_, err = key.Sign(authenticator, data)
+	if _, ok := err.(*NoCredentialsError); !ok {
+		t.Errorf("Expected NoCredentialsError, but got %#v", err)
+	}
+}
+
+func sampleSSHKey(t *testing.T) *SSHKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	return &SSHKey{
+		Application: SSHApplication,
+		PublicKey:   &privateKey.PublicKey,
+		KeyHandle:   []byte("key handle"),
+		Flags:       SSHFlagUserPresenceRequired,
+		Comment:     "user@host",
+	}
+}
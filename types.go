@@ -30,6 +30,10 @@ type RegisterRequest struct {
 	// Only set to true if the client supports channel id, but the server does not.
 	// Setting to true is mutually exclusive with providing a ChannelIdPublicKey.
 	ChannelIdUnused bool
+
+	// Optional validator, when set the Facet must be allowed to use the AppId
+	// or an InvalidAppIdError is returned before the device is used.
+	AppIdValidator *AppIdValidator
 }
 
 // A response from a Register operation.
@@ -74,8 +78,26 @@ type AuthenticateRequest struct {
 	CheckOnly bool
 
 	// Optional boolean (defaults to false) to use WebAuthn authentication with U2f
-	// devices
+	// devices. The AppId is used as the RP ID, and the Challenge must be base64url encoded.
+	// The RP ID must be the Facet's host or a registrable domain suffix of it.
 	WebAuthn bool
+
+	// Optional public suffix list used to validate the RP ID in WebAuthn mode,
+	// defaults to the list embedded from golang.org/x/net/publicsuffix.
+	PublicSuffixList PublicSuffixList
+
+	// Optional U2F AppID for the WebAuthn appid extension, used when the key handle
+	// was registered with U2F. It is tried if the key handle is not found for the AppId.
+	AppIdExtension string
+
+	// Optional top level origin, set when a WebAuthn request is made from an iframe
+	// with a different origin to the Facet.
+	TopOrigin string
+
+	// Optional validator, when set the Facet must be allowed to use the AppId
+	// (or the AppIdExtension in WebAuthn mode) or an InvalidAppIdError is
+	// returned before the device is used.
+	AppIdValidator *AppIdValidator
 }
 
 // A response from an Authenticate operation.
@@ -85,6 +107,8 @@ type AuthenticateResponse struct {
 	ClientData        string `json:"clientData"`
 	SignatureData     string `json:"signatureData"`
 	AuthenticatorData string `json:"authenticatorData,omitempty"`
+	// True if the key handle was found with the AppIdExtension rather than the AppId.
+	AppIdExtensionUsed bool `json:"appid,omitempty"`
 }
 
 type JSONWebKey struct {
@@ -94,9 +118,15 @@ type JSONWebKey struct {
 	Y   string `json:"y"`
 }
 
+// U2F client data types
+const (
+	ClientDataTypeRegister     = "navigator.id.finishEnrollment"
+	ClientDataTypeAuthenticate = "navigator.id.getAssertion"
+)
+
+// The U2F client data, see CollectedClientData for WebAuthn.
 type clientData struct {
 	Typ                string      `json:"typ,omitempty"`
-	Type               string      `json:"type,omitempty"`
 	Challenge          string      `json:"challenge"`
 	ChannelIdPublicKey interface{} `json:"cid_pubkey,omitempty"`
 	Origin             string      `json:"origin"`
@@ -4,6 +4,8 @@ import (
 	sha256pkg "crypto/sha256"
 	"encoding/base64"
 	"fmt"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
 )
 
 func websafeEncode(data []byte) string {
@@ -44,3 +46,83 @@ func u2ferror(err uint16) error {
 	}
 	return fmt.Errorf("U2FError: 0x%02x", err)
 }
+
+func ctap2error(status uint8) error {
+	switch status {
+	case ctap2StatusCredentialExcluded:
+		return &CredentialExcludedError{}
+	case ctap2StatusNoCredentials:
+		return &NoCredentialsError{}
+	case ctap2StatusPinRequired:
+		return &PinRequiredError{}
+	case ctap2StatusPinInvalid:
+		return &PinInvalidError{}
+	case ctap2StatusPinBlocked, ctap2StatusPinAuthBlocked:
+		return &PinBlockedError{}
+	case ctap2StatusPinAuthInvalid:
+		return &PinAuthInvalidError{}
+	case ctap2StatusPinNotSet:
+		return &PinNotSetError{}
+	case ctap2StatusPinPolicyViolation:
+		return &PinPolicyViolationError{}
+	case ctap2StatusOperationDenied:
+		return &OperationDeniedError{}
+	case ctap2StatusInvalidOption:
+		return &InvalidOptionError{}
+	case ctap2StatusKeepAliveCancel:
+		return &KeepAliveCancelError{}
+	case ctap2StatusUserActionTimeout:
+		return &UserActionTimeoutError{}
+	case ctap2StatusNotAllowed:
+		return &NotAllowedError{}
+	}
+	return fmt.Errorf("CTAP2Error: 0x%02x", status)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the integer value for the key, or 0 if it is missing.
+func cborInt(m cbor.Map, key interface{}) int {
+	i, _ := m.Int(key)
+	return int(i)
+}
+
+// Returns the strings in the array value for the key, skipping other types.
+func cborStrings(m cbor.Map, key interface{}) []string {
+	array, _ := m.Array(key)
+	values := []string{}
+	for _, item := range array {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// Returns the integers in the array value for the key, skipping other types.
+func cborInts(m cbor.Map, key interface{}) []int {
+	array, _ := m.Array(key)
+	values := []int{}
+	for _, item := range array {
+		if i, ok := item.(int64); ok {
+			values = append(values, int(i))
+		}
+	}
+	return values
+}
@@ -75,3 +75,22 @@ func TestU2ferror(t *testing.T) {
 		t.Fatalf("Expected error \"U2FError: 0x6d00\", but got \"%s\"", err)
 	}
 }
+
+func TestCtap2error(t *testing.T) {
+	var err error
+
+	err = ctap2error(0x30)
+	if _, ok := err.(*NotAllowedError); !ok {
+		t.Fatalf("Expected NotAllowedError, but got %s", reflect.TypeOf(err))
+	}
+
+	err = ctap2error(0x2F)
+	if _, ok := err.(*UserActionTimeoutError); !ok {
+		t.Fatalf("Expected UserActionTimeoutError, but got %s", reflect.TypeOf(err))
+	}
+
+	err = ctap2error(0x01)
+	if err.Error() != "CTAP2Error: 0x01" {
+		t.Fatalf("Expected error \"CTAP2Error: 0x01\", but got \"%s\"", err)
+	}
+}
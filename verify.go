@@ -0,0 +1,129 @@
+package u2fhost
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	butil "github.com/marshallbrekka/go-u2fhost/bytes"
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// ResponseClientData is the members of U2F and WebAuthn client data that
+// relying parties check.
+type ResponseClientData struct {
+	// The typ of U2F client data, or the type of WebAuthn client data.
+	Type      string
+	Challenge string
+	Origin    string
+}
+
+// Parses the client data JSON of a U2F or WebAuthn response, returning an
+// InvalidResponseError if it is not JSON.
+func ParseResponseClientData(data []byte) (*ResponseClientData, error) {
+	var parsed struct {
+		Typ       string `json:"typ"`
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, &InvalidResponseError{Reason: "the client data is not JSON"}
+	}
+	clientData := &ResponseClientData{Type: parsed.Typ, Challenge: parsed.Challenge, Origin: parsed.Origin}
+	if parsed.Type != "" {
+		clientData.Type = parsed.Type
+	}
+	return clientData, nil
+}
+
+// Checks the base64 encoded client data of a register or authenticate response
+// has the type, challenge and origin the relying party expects, returning an
+// InvalidResponseError if not.
+// The type is ClientDataTypeRegister or ClientDataTypeAuthenticate for U2F
+// responses, and ClientDataTypeGet for WebAuthn responses, whose challenge is
+// base64url encoded.
+func VerifyClientData(clientData, typ, challenge, origin string) error {
+	data, err := websafeDecode(clientData)
+	if err != nil {
+		return &InvalidResponseError{Reason: "the client data is not base64url encoded"}
+	}
+	parsed, err := ParseResponseClientData(data)
+	if err != nil {
+		return err
+	}
+	if parsed.Type != typ {
+		return &InvalidResponseError{Reason: fmt.Sprintf("expected client data type %q but got %q", typ, parsed.Type)}
+	}
+	if parsed.Challenge != challenge {
+		return &InvalidResponseError{Reason: "the challenge does not match"}
+	}
+	if parsed.Origin != origin {
+		return &InvalidResponseError{Reason: fmt.Sprintf("expected origin %s but got %s", origin, parsed.Origin)}
+	}
+	return nil
+}
+
+// Verifies the signature of an AuthenticateResponse with the COSE_Key encoded
+// credential public key, which is the CredentialPublicKey of the authenticator
+// data from the registration.
+// The appId is the AppId, or the RP ID for WebAuthn responses, or the
+// AppIdExtension if AppIdExtensionUsed is set.
+// Returns the signed authenticator data, so the caller can check the user presence
+// flag and that the counter increased since the last authentication.
+func VerifyAuthenticateResponse(response *AuthenticateResponse, appId string, publicKey []byte) (*AuthenticatorData, error) {
+	key, err := cbor.UnmarshalMap(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key: %s", err)
+	}
+	ecdsaKey, err := ecdsaFromCOSEKey(key)
+	if err != nil {
+		return nil, err
+	}
+	clientData, err := websafeDecode(response.ClientData)
+	if err != nil {
+		return nil, &InvalidResponseError{Reason: "the client data is not base64url encoded"}
+	}
+	authData, signature, err := ParseAuthenticateResponse(response, appId)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseAuthenticatorData(authData)
+	if err != nil {
+		return nil, &InvalidResponseError{Reason: err.Error()}
+	}
+	if string(parsed.RPIDHash) != string(sha256([]byte(appId))) {
+		return nil, &InvalidResponseError{Reason: "the authenticator data is for a different AppID"}
+	}
+	signed := butil.Concat(authData, sha256(clientData))
+	if !ecdsa.VerifyASN1(ecdsaKey, sha256(signed), signature) {
+		return nil, &InvalidResponseError{Reason: "the signature is not valid"}
+	}
+	return parsed, nil
+}
+
+// Returns the signed authenticator data and the signature of an AuthenticateResponse.
+// U2F responses only include the flags and counter, so their authenticator data
+// is rebuilt with the hash of the appId.
+func ParseAuthenticateResponse(response *AuthenticateResponse, appId string) ([]byte, []byte, error) {
+	if response.AuthenticatorData != "" {
+		// WebAuthn responses have the authenticator data and signature separately
+		authData, err := base64.StdEncoding.DecodeString(response.AuthenticatorData)
+		if err != nil {
+			return nil, nil, &InvalidResponseError{Reason: "the authenticator data is not base64 encoded"}
+		}
+		signature, err := base64.StdEncoding.DecodeString(response.SignatureData)
+		if err != nil {
+			return nil, nil, &InvalidResponseError{Reason: "the signature is not base64 encoded"}
+		}
+		return authData, signature, nil
+	}
+	// U2F signature data is the user presence byte, the counter and the signature
+	signatureData, err := websafeDecode(response.SignatureData)
+	if err != nil || len(signatureData) < 5 {
+		return nil, nil, &InvalidResponseError{Reason: "invalid signature data"}
+	}
+	return butil.Concat(sha256([]byte(appId)), signatureData[:5]), signatureData[5:], nil
+}
@@ -0,0 +1,147 @@
+package u2fhost
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+// Returns a device backed by a test U2F token.
+func newTestU2FDevice(t *testing.T) *HidDevice {
+	_, _, authenticator := newTestU2FAuthenticator(t)
+	return authenticator.(*u2fAuthenticator).dev
+}
+
+// Registers with the test token and returns its credential public key.
+func testRegisteredKey(t *testing.T, dev *HidDevice, appId string) []byte {
+	req := &RegisterRequest{Challenge: testRegisterChallenge, AppId: appId, Facet: "https://example.com"}
+	response, err := dev.Register(req)
+	if err != nil {
+		t.Fatalf("Unexpected error registering: %s", err)
+	}
+	result, err := VerifyRegisterResponse(response, appId, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error verifying the registration: %s", err)
+	}
+	return result.AuthenticatorData.CredentialPublicKey
+}
+
+func TestVerifyClientData(t *testing.T) {
+	clientData := websafeEncode([]byte(`{"typ":"navigator.id.getAssertion","challenge":"abc","origin":"https://example.com"}`))
+	err := VerifyClientData(clientData, ClientDataTypeAuthenticate, "abc", "https://example.com")
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	webAuthnClientData := websafeEncode([]byte(`{"type":"webauthn.get","challenge":"abc","origin":"https://example.com"}`))
+	err = VerifyClientData(webAuthnClientData, ClientDataTypeGet, "abc", "https://example.com")
+	if err != nil {
+		t.Errorf("Unexpected error for WebAuthn client data: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		clientData string
+		typ        string
+		challenge  string
+		origin     string
+	}{
+		{"type", clientData, ClientDataTypeRegister, "abc", "https://example.com"},
+		{"challenge", clientData, ClientDataTypeAuthenticate, "abd", "https://example.com"},
+		{"origin", clientData, ClientDataTypeAuthenticate, "abc", "https://evil.com"},
+		{"encoding", "not base64!", ClientDataTypeAuthenticate, "abc", "https://example.com"},
+		{"json", websafeEncode([]byte("{")), ClientDataTypeAuthenticate, "abc", "https://example.com"},
+	}
+	for _, test := range tests {
+		err := VerifyClientData(test.clientData, test.typ, test.challenge, test.origin)
+		if _, ok := err.(*InvalidResponseError); !ok {
+			t.Errorf("%s: expected an InvalidResponseError but got %v", test.name, err)
+		}
+	}
+}
+
+func TestParseResponseClientData(t *testing.T) {
+	clientData, err := ParseResponseClientData([]byte(`{"typ":"navigator.id.finishEnrollment","challenge":"abc","origin":"https://example.com"}`))
+	if err != nil || clientData.Type != ClientDataTypeRegister || clientData.Challenge != "abc" || clientData.Origin != "https://example.com" {
+		t.Errorf("Unexpected U2F client data %#v %s", clientData, err)
+	}
+	clientData, err = ParseResponseClientData([]byte(`{"type":"webauthn.create","challenge":"abc","origin":"https://example.com"}`))
+	if err != nil || clientData.Type != ClientDataTypeCreate {
+		t.Errorf("Unexpected WebAuthn client data %#v %s", clientData, err)
+	}
+	if _, err = ParseResponseClientData([]byte("{")); err == nil {
+		t.Errorf("Expected error for invalid JSON")
+	}
+}
+
+func TestVerifyAuthenticateResponse(t *testing.T) {
+	dev := newTestU2FDevice(t)
+	appId := "https://example.com"
+	publicKey := testRegisteredKey(t, dev, appId)
+
+	req := &AuthenticateRequest{
+		Challenge: testAuthenticateChallenge,
+		AppId:     appId,
+		Facet:     "https://example.com",
+		KeyHandle: websafeEncode([]byte("key handle")),
+	}
+	response, err := dev.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Unexpected error authenticating: %s", err)
+	}
+	authData, err := VerifyAuthenticateResponse(response, appId, publicKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !authData.UserPresent() || authData.SignCount != 42 {
+		t.Errorf("Expected user presence and counter 42, but got %#v", authData)
+	}
+	err = VerifyClientData(response.ClientData, ClientDataTypeAuthenticate, req.Challenge, req.Facet)
+	if err != nil {
+		t.Errorf("Unexpected error verifying the client data: %s", err)
+	}
+
+	if _, err = VerifyAuthenticateResponse(response, "https://other.example.com", publicKey); err == nil {
+		t.Errorf("Expected error for a different AppID")
+	}
+	signedData, signature, err := ParseAuthenticateResponse(response, "https://other.example.com")
+	if err != nil || len(signedData) != 37 || len(signature) == 0 {
+		t.Errorf("Unexpected signed data %x %s", signedData, err)
+	} else if string(signedData[:32]) != string(sha256([]byte("https://other.example.com"))) {
+		t.Errorf("Expected the signed data to be rebuilt with the AppID hash, but got %x", signedData[:32])
+	}
+	tampered := *response
+	tampered.ClientData = websafeEncode([]byte(`{"typ":"navigator.id.getAssertion","challenge":"other","origin":"https://example.com"}`))
+	if _, err = VerifyAuthenticateResponse(&tampered, appId, publicKey); err == nil {
+		t.Errorf("Expected error for tampered client data")
+	}
+	otherKey := testRegisteredKey(t, newTestU2FDevice(t), appId)
+	if _, err = VerifyAuthenticateResponse(response, appId, otherKey); err == nil {
+		t.Errorf("Expected error for a different public key")
+	}
+}
+
+func TestVerifyWebAuthnAuthenticateResponse(t *testing.T) {
+	dev := newTestU2FDevice(t)
+	publicKey := testRegisteredKey(t, dev, "example.com")
+
+	req := &AuthenticateRequest{
+		Challenge: base64.RawURLEncoding.EncodeToString([]byte("challenge")),
+		AppId:     "example.com",
+		Facet:     "https://example.com",
+		KeyHandle: websafeEncode([]byte("key handle")),
+		WebAuthn:  true,
+	}
+	response, err := dev.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Unexpected error authenticating: %s", err)
+	}
+	if _, err = VerifyAuthenticateResponse(response, "example.com", publicKey); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if signedData, _, err := ParseAuthenticateResponse(response, "other.example.com"); err != nil || string(signedData[:32]) != string(sha256([]byte("example.com"))) {
+		t.Errorf("Expected the signed authenticator data of the response, but got %x %s", signedData, err)
+	}
+	err = VerifyClientData(response.ClientData, ClientDataTypeGet, req.Challenge, req.Facet)
+	if err != nil {
+		t.Errorf("Unexpected error verifying the client data: %s", err)
+	}
+}
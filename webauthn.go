@@ -0,0 +1,418 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+// The WebAuthn JSON formats are defined at the following url.
+// https://www.w3.org/TR/webauthn-3/#sctn-parseCreationOptionsFromJSON
+
+// WebAuthn enumeration values
+const (
+	residentKeyRequired                  = "required"
+	residentKeyPreferred                 = "preferred"
+	userVerificationRequired             = "required"
+	authenticatorAttachmentCrossPlatform = "cross-platform"
+	transportUSB                         = "usb"
+)
+
+// WebAuthn credProtect client extension policies
+var credentialProtectionPolicies = map[string]CredProtectPolicy{
+	"userVerificationOptional":                     CredProtectUserVerificationOptional,
+	"userVerificationOptionalWithCredentialIDList": CredProtectUserVerificationOptionalWithCredentialIDList,
+	"userVerificationRequired":                     CredProtectUserVerificationRequired,
+}
+
+// Base64URL is binary data that is encoded as unpadded base64url in JSON,
+// following the WebAuthn toJSON conventions.
+// Padded and standard base64 are also accepted when decoding.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var encoded string
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeBase64URL(encoded)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Decodes base64url, also accepting padding and the standard base64 alphabet.
+func decodeBase64URL(encoded string) ([]byte, error) {
+	encoded = strings.TrimRight(encoded, "=")
+	encoded = strings.NewReplacer("+", "-", "/", "_").Replace(encoded)
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base64url value: %s", err)
+	}
+	return decoded, nil
+}
+
+// The relying party of a PublicKeyCredentialCreationOptions.
+type PublicKeyCredentialRpEntity struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// The user account of a PublicKeyCredentialCreationOptions.
+type PublicKeyCredentialUserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// A credential type and COSE algorithm the relying party accepts.
+type PublicKeyCredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// Identifies an existing credential in an allow or exclude list.
+type PublicKeyCredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// The relying party's requirements for the authenticator creating a credential.
+type AuthenticatorSelectionCriteria struct {
+	AuthenticatorAttachment string `json:"authenticatorAttachment,omitempty"`
+	ResidentKey             string `json:"residentKey,omitempty"`
+	RequireResidentKey      bool   `json:"requireResidentKey,omitempty"`
+	UserVerification        string `json:"userVerification,omitempty"`
+}
+
+// The client extension inputs that map onto CTAP2 and U2F features.
+type AuthenticationExtensionsClientInputs struct {
+	AppID                             string    `json:"appid,omitempty"`
+	CredProps                         bool      `json:"credProps,omitempty"`
+	HmacCreateSecret                  bool      `json:"hmacCreateSecret,omitempty"`
+	CredentialProtectionPolicy        string    `json:"credentialProtectionPolicy,omitempty"`
+	EnforceCredentialProtectionPolicy bool      `json:"enforceCredentialProtectionPolicy,omitempty"`
+	CredBlob                          Base64URL `json:"credBlob,omitempty"`
+	GetCredBlob                       bool      `json:"getCredBlob,omitempty"`
+	MinPinLength                      bool      `json:"minPinLength,omitempty"`
+}
+
+// The client extension outputs returned with a credential.
+type AuthenticationExtensionsClientOutputs struct {
+	AppID            *bool                 `json:"appid,omitempty"`
+	CredProps        *CredentialProperties `json:"credProps,omitempty"`
+	HmacCreateSecret *bool                 `json:"hmacCreateSecret,omitempty"`
+	CredProtect      int                   `json:"credProtect,omitempty"`
+	CredBlob         *bool                 `json:"credBlob,omitempty"`
+	GetCredBlob      Base64URL             `json:"getCredBlob,omitempty"`
+	MinPinLength     int                   `json:"minPinLength,omitempty"`
+}
+
+// The output of the credProps extension.
+type CredentialProperties struct {
+	// True if the credential is a resident (discoverable) credential.
+	ResidentKey bool `json:"rk"`
+}
+
+// The relying party's options for creating a credential, parsed from the
+// JSON form of PublicKeyCredentialCreationOptions.
+type PublicKeyCredentialCreationOptions struct {
+	RP                     PublicKeyCredentialRpEntity           `json:"rp"`
+	User                   PublicKeyCredentialUserEntity         `json:"user"`
+	Challenge              Base64URL                             `json:"challenge"`
+	PubKeyCredParams       []PublicKeyCredentialParameters       `json:"pubKeyCredParams"`
+	Timeout                int                                   `json:"timeout,omitempty"`
+	ExcludeCredentials     []PublicKeyCredentialDescriptor       `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection *AuthenticatorSelectionCriteria       `json:"authenticatorSelection,omitempty"`
+	Hints                  []string                              `json:"hints,omitempty"`
+	Attestation            string                                `json:"attestation,omitempty"`
+	AttestationFormats     []string                              `json:"attestationFormats,omitempty"`
+	Extensions             *AuthenticationExtensionsClientInputs `json:"extensions,omitempty"`
+}
+
+// The relying party's options for signing with a credential, parsed from the
+// JSON form of PublicKeyCredentialRequestOptions.
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        Base64URL                             `json:"challenge"`
+	Timeout          int                                   `json:"timeout,omitempty"`
+	RPID             string                                `json:"rpId,omitempty"`
+	AllowCredentials []PublicKeyCredentialDescriptor       `json:"allowCredentials,omitempty"`
+	UserVerification string                                `json:"userVerification,omitempty"`
+	Hints            []string                              `json:"hints,omitempty"`
+	Extensions       *AuthenticationExtensionsClientInputs `json:"extensions,omitempty"`
+}
+
+// The response of a new credential, in the JSON form of AuthenticatorAttestationResponse.
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON     Base64URL `json:"clientDataJSON"`
+	AuthenticatorData  Base64URL `json:"authenticatorData"`
+	Transports         []string  `json:"transports"`
+	PublicKey          Base64URL `json:"publicKey,omitempty"`
+	PublicKeyAlgorithm int       `json:"publicKeyAlgorithm"`
+	AttestationObject  Base64URL `json:"attestationObject"`
+}
+
+// The response of a signature, in the JSON form of AuthenticatorAssertionResponse.
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// A newly created credential, in the JSON form of a PublicKeyCredential
+// (RegistrationResponseJSON) that is sent to the relying party.
+type RegistrationCredential struct {
+	ID                      string                                `json:"id"`
+	RawID                   Base64URL                             `json:"rawId"`
+	Type                    string                                `json:"type"`
+	AuthenticatorAttachment string                                `json:"authenticatorAttachment,omitempty"`
+	Response                AuthenticatorAttestationResponse      `json:"response"`
+	ClientExtensionResults  AuthenticationExtensionsClientOutputs `json:"clientExtensionResults"`
+}
+
+// A signature from an existing credential, in the JSON form of a PublicKeyCredential
+// (AuthenticationResponseJSON) that is sent to the relying party.
+type AuthenticationCredential struct {
+	ID                      string                                `json:"id"`
+	RawID                   Base64URL                             `json:"rawId"`
+	Type                    string                                `json:"type"`
+	AuthenticatorAttachment string                                `json:"authenticatorAttachment,omitempty"`
+	Response                AuthenticatorAssertionResponse        `json:"response"`
+	ClientExtensionResults  AuthenticationExtensionsClientOutputs `json:"clientExtensionResults"`
+}
+
+// Parses the JSON creation options, either on their own or wrapped in the
+// "publicKey" member of a CredentialCreationOptions.
+func ParseCreationOptions(data []byte) (*PublicKeyCredentialCreationOptions, error) {
+	options := &PublicKeyCredentialCreationOptions{}
+	err := unmarshalPublicKeyOptions(data, options)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PublicKeyCredentialCreationOptions: %s", err)
+	}
+	if len(options.Challenge) == 0 {
+		return nil, errors.New("Invalid PublicKeyCredentialCreationOptions: missing challenge")
+	}
+	if len(options.User.ID) == 0 {
+		return nil, errors.New("Invalid PublicKeyCredentialCreationOptions: missing user id")
+	}
+	return options, nil
+}
+
+// Parses the JSON request options, either on their own or wrapped in the
+// "publicKey" member of a CredentialRequestOptions.
+func ParseRequestOptions(data []byte) (*PublicKeyCredentialRequestOptions, error) {
+	options := &PublicKeyCredentialRequestOptions{}
+	err := unmarshalPublicKeyOptions(data, options)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PublicKeyCredentialRequestOptions: %s", err)
+	}
+	if len(options.Challenge) == 0 {
+		return nil, errors.New("Invalid PublicKeyCredentialRequestOptions: missing challenge")
+	}
+	return options, nil
+}
+
+// Parses the JSON form of a newly created credential.
+func ParseRegistrationCredential(data []byte) (*RegistrationCredential, error) {
+	credential := &RegistrationCredential{}
+	err := json.Unmarshal(data, credential)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid registration credential: %s", err)
+	}
+	if len(credential.RawID) == 0 || len(credential.Response.AttestationObject) == 0 {
+		return nil, errors.New("Invalid registration credential: missing rawId or attestationObject")
+	}
+	return credential, nil
+}
+
+// Parses the JSON form of a signature from an existing credential.
+func ParseAuthenticationCredential(data []byte) (*AuthenticationCredential, error) {
+	credential := &AuthenticationCredential{}
+	err := json.Unmarshal(data, credential)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid authentication credential: %s", err)
+	}
+	if len(credential.RawID) == 0 || len(credential.Response.Signature) == 0 {
+		return nil, errors.New("Invalid authentication credential: missing rawId or signature")
+	}
+	return credential, nil
+}
+
+func unmarshalPublicKeyOptions(data []byte, options interface{}) error {
+	var wrapper struct {
+		PublicKey json.RawMessage `json:"publicKey"`
+	}
+	err := json.Unmarshal(data, &wrapper)
+	if err != nil {
+		return err
+	}
+	if len(wrapper.PublicKey) > 0 && !bytes.Equal(wrapper.PublicKey, []byte("null")) {
+		data = wrapper.PublicKey
+	}
+	return json.Unmarshal(data, options)
+}
+
+// Returns the MakeCredentialRequest for the options and the hash of the client data.
+// The RP ID must be set, a resident credential is requested when the relying party
+// requires one, or prefers one and the device info reports the rk option, and user
+// verification is only requested when required. The info is nil for U2F devices.
+func (o *PublicKeyCredentialCreationOptions) MakeCredentialRequest(clientDataHash []byte, info *AuthenticatorInfo) (*MakeCredentialRequest, error) {
+	if o.RP.ID == "" {
+		return nil, errors.New("The rp id must be set")
+	}
+	req := &MakeCredentialRequest{
+		ClientDataHash: clientDataHash,
+		RelyingParty:   RelyingPartyEntity{ID: o.RP.ID, Name: o.RP.Name},
+		User:           UserEntity{ID: o.User.ID, Name: o.User.Name, DisplayName: o.User.DisplayName},
+		ExcludeList:    descriptorIDs(o.ExcludeCredentials),
+	}
+	for _, param := range o.PubKeyCredParams {
+		if param.Type == credentialTypePublicKey {
+			req.Algorithms = append(req.Algorithms, param.Alg)
+		}
+	}
+	if len(o.PubKeyCredParams) > 0 && len(req.Algorithms) == 0 {
+		return nil, errors.New("No supported credential types in pubKeyCredParams")
+	}
+	if selection := o.AuthenticatorSelection; selection != nil {
+		req.ResidentKey = selection.ResidentKey == residentKeyRequired || (selection.ResidentKey == "" && selection.RequireResidentKey)
+		if selection.ResidentKey == residentKeyPreferred && info != nil {
+			req.ResidentKey = info.Options["rk"]
+		}
+		req.UserVerification = selection.UserVerification == userVerificationRequired
+	}
+	if extensions := o.Extensions; extensions != nil {
+		req.Extensions.HmacSecret = extensions.HmacCreateSecret
+		req.Extensions.CredBlob = extensions.CredBlob
+		req.Extensions.MinPinLength = extensions.MinPinLength
+		if extensions.CredentialProtectionPolicy != "" {
+			policy, ok := credentialProtectionPolicies[extensions.CredentialProtectionPolicy]
+			if !ok {
+				return nil, fmt.Errorf("Unknown credentialProtectionPolicy %s", extensions.CredentialProtectionPolicy)
+			}
+			req.Extensions.CredProtect = policy
+		}
+	}
+	return req, nil
+}
+
+// Returns the GetAssertionRequest for the options and the hash of the client data.
+// The RP ID must be set, user verification is only requested when required.
+func (o *PublicKeyCredentialRequestOptions) GetAssertionRequest(clientDataHash []byte) (*GetAssertionRequest, error) {
+	if o.RPID == "" {
+		return nil, errors.New("The rpId must be set")
+	}
+	req := &GetAssertionRequest{
+		RPID:             o.RPID,
+		ClientDataHash:   clientDataHash,
+		AllowList:        descriptorIDs(o.AllowCredentials),
+		UserVerification: o.UserVerification == userVerificationRequired,
+	}
+	if extensions := o.Extensions; extensions != nil {
+		req.Extensions.AppID = extensions.AppID
+		req.Extensions.CredBlob = extensions.GetCredBlob
+	}
+	return req, nil
+}
+
+// Returns the JSON form of the new credential, given the client data that was hashed
+// for the request and the options, which may be nil.
+func NewRegistrationCredential(clientDataJSON []byte, options *PublicKeyCredentialCreationOptions, response *MakeCredentialResponse) (*RegistrationCredential, error) {
+	attestationObject, err := cbor.Marshal(cbor.Map{
+		"fmt":      response.Format,
+		"attStmt":  response.AttestationStatement,
+		"authData": response.AuthData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	credentialID := response.AuthenticatorData.CredentialID
+	credential := &RegistrationCredential{
+		ID:                      base64.RawURLEncoding.EncodeToString(credentialID),
+		RawID:                   credentialID,
+		Type:                    credentialTypePublicKey,
+		AuthenticatorAttachment: authenticatorAttachmentCrossPlatform,
+		Response: AuthenticatorAttestationResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: response.AuthData,
+			Transports:        []string{transportUSB},
+			AttestationObject: attestationObject,
+		},
+	}
+	coseKey, err := cbor.UnmarshalMap(response.AuthenticatorData.CredentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	credential.Response.PublicKeyAlgorithm = cborInt(coseKey, coseKeyAlg)
+	if publicKey, err := ecdsaFromCOSEKey(coseKey); err == nil {
+		credential.Response.PublicKey, _ = x509.MarshalPKIXPublicKey(publicKey)
+	}
+	outputs := response.Extensions
+	results := &credential.ClientExtensionResults
+	if options != nil && options.Extensions != nil {
+		if options.Extensions.CredProps {
+			results.CredProps = &CredentialProperties{ResidentKey: response.ResidentKey}
+		}
+		if options.Extensions.HmacCreateSecret {
+			results.HmacCreateSecret = &outputs.HmacSecret
+		}
+		if options.Extensions.CredBlob != nil {
+			results.CredBlob = &outputs.CredBlob
+		}
+	}
+	results.CredProtect = int(outputs.CredProtect)
+	results.MinPinLength = outputs.MinPinLength
+	return credential, nil
+}
+
+// Returns the JSON form of the signature, given the client data that was hashed
+// for the request and the options, which may be nil.
+func NewAuthenticationCredential(clientDataJSON []byte, options *PublicKeyCredentialRequestOptions, response *GetAssertionResponse) *AuthenticationCredential {
+	credential := &AuthenticationCredential{
+		ID:                      base64.RawURLEncoding.EncodeToString(response.CredentialID),
+		RawID:                   response.CredentialID,
+		Type:                    credentialTypePublicKey,
+		AuthenticatorAttachment: authenticatorAttachmentCrossPlatform,
+		Response: AuthenticatorAssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: response.AuthData,
+			Signature:         response.Signature,
+		},
+	}
+	if response.User != nil {
+		credential.Response.UserHandle = response.User.ID
+	}
+	results := &credential.ClientExtensionResults
+	if options != nil && options.Extensions != nil && options.Extensions.AppID != "" {
+		appID := response.Extensions.AppID
+		results.AppID = &appID
+	}
+	results.GetCredBlob = response.Extensions.CredBlob
+	return credential
+}
+
+// Returns the IDs of the public key credentials in the descriptors.
+func descriptorIDs(descriptors []PublicKeyCredentialDescriptor) [][]byte {
+	var ids [][]byte
+	for _, descriptor := range descriptors {
+		if descriptor.Type == credentialTypePublicKey {
+			ids = append(ids, descriptor.ID)
+		}
+	}
+	return ids
+}
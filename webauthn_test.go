@@ -0,0 +1,225 @@
+package u2fhost
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/marshallbrekka/go-u2fhost/cbor"
+)
+
+var testCreationOptionsJson = `{
+	"publicKey": {
+		"rp": {"id": "example.com", "name": "Example"},
+		"user": {"id": "AQID", "name": "user", "displayName": "User"},
+		"challenge": "vqrS6WXDe1JUs5_c3i4-LkKIHRr-3XVb3azuA5TifHo",
+		"pubKeyCredParams": [{"type": "public-key", "alg": -7}, {"type": "public-key", "alg": -257}, {"type": "other", "alg": -8}],
+		"timeout": 60000,
+		"excludeCredentials": [{"type": "public-key", "id": "ZXhjbHVkZWQ=", "transports": ["usb"]}],
+		"authenticatorSelection": {"residentKey": "required", "userVerification": "required"},
+		"attestation": "direct",
+		"extensions": {"credProps": true, "hmacCreateSecret": true, "credentialProtectionPolicy": "userVerificationRequired"}
+	}
+}`
+
+var testRequestOptionsJson = `{
+	"challenge": "opsXqUifDriAAmWclinfbS0e+USY0CgyJHe/Otd7z8o",
+	"rpId": "example.com",
+	"allowCredentials": [{"type": "public-key", "id": "dGVzdCBjcmVkZW50aWFsIGlk"}],
+	"userVerification": "preferred",
+	"extensions": {"appid": "https://example.com/appid.json"}
+}`
+
+func TestBase64URL(t *testing.T) {
+	encoded, err := json.Marshal(Base64URL{0xfb, 0xff, 0x01})
+	if err != nil || string(encoded) != `"-_8B"` {
+		t.Errorf("Expected \"-_8B\", but got %s %s", encoded, err)
+	}
+	for _, input := range []string{`"-_8B"`, `"+/8B"`, `"-_8B=="`} {
+		var decoded Base64URL
+		err = json.Unmarshal([]byte(input), &decoded)
+		if err != nil || !bytes.Equal(decoded, []byte{0xfb, 0xff, 0x01}) {
+			t.Errorf("Expected %s to decode to fbff01, but got %x %s", input, decoded, err)
+		}
+	}
+	var decoded Base64URL
+	if json.Unmarshal([]byte(`"!!"`), &decoded) == nil {
+		t.Errorf("Expected error for invalid base64url")
+	}
+}
+
+func TestParseCreationOptions(t *testing.T) {
+	options, err := ParseCreationOptions([]byte(testCreationOptionsJson))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if options.RP.ID != "example.com" || options.Timeout != 60000 || options.Attestation != "direct" {
+		t.Errorf("Unexpected options %#v", options)
+	}
+	req, err := options.MakeCredentialRequest(sha256([]byte("client data")), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := &MakeCredentialRequest{
+		ClientDataHash:   sha256([]byte("client data")),
+		RelyingParty:     RelyingPartyEntity{ID: "example.com", Name: "Example"},
+		User:             UserEntity{ID: []byte{1, 2, 3}, Name: "user", DisplayName: "User"},
+		Algorithms:       []int{-7, -257},
+		ExcludeList:      [][]byte{[]byte("excluded")},
+		ResidentKey:      true,
+		UserVerification: true,
+		Extensions: MakeCredentialExtensions{
+			HmacSecret:  true,
+			CredProtect: CredProtectUserVerificationRequired,
+		},
+	}
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("Expected %#v, but got %#v", expected, req)
+	}
+
+	// Missing fields
+	_, err = ParseCreationOptions([]byte(`{"rp": {"id": "example.com"}, "user": {"id": "AQID"}}`))
+	if err == nil {
+		t.Errorf("Expected error for options without a challenge")
+	}
+
+	// A preferred resident credential is requested if the device supports one
+	options.AuthenticatorSelection = &AuthenticatorSelectionCriteria{ResidentKey: "preferred"}
+	for _, rk := range []bool{true, false} {
+		info := &AuthenticatorInfo{Options: map[string]bool{"rk": rk}}
+		req, _ = options.MakeCredentialRequest(sha256([]byte("client data")), info)
+		if req.ResidentKey != rk {
+			t.Errorf("Expected a preferred resident credential to be requested when rk is %t", rk)
+		}
+	}
+	if req, _ = options.MakeCredentialRequest(sha256([]byte("client data")), nil); req.ResidentKey {
+		t.Errorf("Expected no resident credential to be requested without device info")
+	}
+
+	options.RP.ID = ""
+	_, err = options.MakeCredentialRequest(sha256([]byte("client data")), nil)
+	if err == nil {
+		t.Errorf("Expected error for options without an rp id")
+	}
+}
+
+func TestParseRequestOptions(t *testing.T) {
+	options, err := ParseRequestOptions([]byte(testRequestOptionsJson))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	req, err := options.GetAssertionRequest(sha256([]byte("client data")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := sampleGetAssertionRequest()
+	expected.Extensions.AppID = "https://example.com/appid.json"
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("Expected %#v, but got %#v", expected, req)
+	}
+	if _, err = ParseRequestOptions([]byte(`{"rpId": "example.com"}`)); err == nil {
+		t.Errorf("Expected error for options without a challenge")
+	}
+	if _, err = ParseRequestOptions([]byte(`[]`)); err == nil {
+		t.Errorf("Expected error for invalid JSON")
+	}
+}
+
+func TestNewRegistrationCredential(t *testing.T) {
+	authenticator, _, dev := newTestAuthenticator(t)
+	options, _ := ParseCreationOptions([]byte(testCreationOptionsJson))
+	clientDataJSON := []byte(`{"type":"webauthn.create"}`)
+	req, _ := options.MakeCredentialRequest(sha256(clientDataJSON), nil)
+	req.UserVerification = false
+	response, err := dev.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	credential, err := NewRegistrationCredential(clientDataJSON, options, response)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	encoded, _ := json.Marshal(credential)
+	parsed, err := ParseRegistrationCredential(encoded)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if parsed.ID != "dGVzdCBjcmVkZW50aWFsIGlk" || !bytes.Equal(parsed.RawID, authenticator.credentialID) {
+		t.Errorf("Expected credential id %s, but got %s", authenticator.credentialID, parsed.ID)
+	}
+	if !bytes.Equal(parsed.Response.ClientDataJSON, clientDataJSON) {
+		t.Errorf("Expected the client data JSON to round trip")
+	}
+	attestationObject, err := cbor.UnmarshalMap(parsed.Response.AttestationObject)
+	if err != nil {
+		t.Fatalf("Unexpected error decoding attestation object: %s", err)
+	}
+	if format, _ := attestationObject.String("fmt"); format != response.Format {
+		t.Errorf("Expected format %s, but got %s", response.Format, format)
+	}
+	if authData, _ := attestationObject.Bytes("authData"); !bytes.Equal(authData, response.AuthData) {
+		t.Errorf("Expected the authenticator data in the attestation object")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(parsed.Response.PublicKey)
+	if err != nil || !reflect.DeepEqual(publicKey, &authenticator.credentialKey.PublicKey) {
+		t.Errorf("Expected the credential public key, but got %s", err)
+	}
+	if parsed.Response.PublicKeyAlgorithm != coseAlgES256 {
+		t.Errorf("Expected algorithm %d, but got %d", coseAlgES256, parsed.Response.PublicKeyAlgorithm)
+	}
+	results := parsed.ClientExtensionResults
+	if results.CredProps == nil || !results.CredProps.ResidentKey {
+		t.Errorf("Expected credProps rk to be true")
+	}
+	if results.HmacCreateSecret == nil || !*results.HmacCreateSecret {
+		t.Errorf("Expected hmacCreateSecret to be true")
+	}
+
+	// credProps reports the rk option that was sent, where residentKey overrides requireResidentKey
+	options.AuthenticatorSelection = &AuthenticatorSelectionCriteria{ResidentKey: "discouraged", RequireResidentKey: true}
+	req, _ = options.MakeCredentialRequest(sha256(clientDataJSON), nil)
+	response, err = dev.MakeCredential(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	credential, _ = NewRegistrationCredential(clientDataJSON, options, response)
+	if props := credential.ClientExtensionResults.CredProps; props == nil || props.ResidentKey {
+		t.Errorf("Expected credProps rk to be false, but got %#v", props)
+	}
+
+	// credBlob reports whether the blob was stored
+	options.Extensions.CredBlob = Base64URL("blob")
+	response.Extensions.CredBlob = true
+	credential, _ = NewRegistrationCredential(clientDataJSON, options, response)
+	encoded, _ = json.Marshal(credential.ClientExtensionResults)
+	if !bytes.Contains(encoded, []byte(`"credBlob":true`)) {
+		t.Errorf("Expected credBlob to be true, but got %s", encoded)
+	}
+}
+
+func TestNewAuthenticationCredential(t *testing.T) {
+	options, _ := ParseRequestOptions([]byte(testRequestOptionsJson))
+	response := &GetAssertionResponse{
+		CredentialID: []byte("test credential id"),
+		AuthData:     []byte("auth data"),
+		Signature:    []byte("signature"),
+		User:         &UserEntity{ID: []byte{1, 2, 3}},
+	}
+	credential := NewAuthenticationCredential([]byte("{}"), options, response)
+	encoded, _ := json.Marshal(credential)
+	expected := `{"id":"dGVzdCBjcmVkZW50aWFsIGlk","rawId":"dGVzdCBjcmVkZW50aWFsIGlk","type":"public-key",` +
+		`"authenticatorAttachment":"cross-platform","response":{"clientDataJSON":"e30","authenticatorData":"YXV0aCBkYXRh",` +
+		`"signature":"c2lnbmF0dXJl","userHandle":"AQID"},"clientExtensionResults":{"appid":false}}`
+	if string(encoded) != expected {
+		t.Errorf("Expected %s, but got %s", expected, encoded)
+	}
+	parsed, err := ParseAuthenticationCredential(encoded)
+	if err != nil || !reflect.DeepEqual(parsed, credential) {
+		t.Errorf("Expected the credential to round trip, but got %#v %s", parsed, err)
+	}
+	if _, err = ParseAuthenticationCredential([]byte(`{"id": "abc"}`)); err == nil {
+		t.Errorf("Expected error for a credential without a signature")
+	}
+}